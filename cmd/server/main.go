@@ -4,12 +4,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/docker/docker/client"
 	"github.com/rs/zerolog"
@@ -17,9 +21,13 @@ import (
 	"github.com/almeidapaulopt/tsdproxy/internal/config"
 	"github.com/almeidapaulopt/tsdproxy/internal/core"
 	"github.com/almeidapaulopt/tsdproxy/internal/dashboard"
+	"github.com/almeidapaulopt/tsdproxy/internal/metrics"
 	pm "github.com/almeidapaulopt/tsdproxy/internal/proxymanager"
 )
 
+// tracingShutdownTimeout is the time to flush pending spans on shutdown.
+const tracingShutdownTimeout = 5 * time.Second
+
 type WebApp struct {
 	Log          zerolog.Logger
 	HTTP         *core.HTTPServer
@@ -27,6 +35,10 @@ type WebApp struct {
 	Docker       *client.Client
 	ProxyManager *pm.ProxyManager
 	Dashboard    *dashboard.Dashboard
+	Tracing      *core.Tracing
+	server       *http.Server
+	configFile   *config.ConfigFile
+	reloadMtx    sync.Mutex
 }
 
 func InitializeApp() (*WebApp, error) {
@@ -36,6 +48,11 @@ func InitializeApp() (*WebApp, error) {
 	}
 	logger := core.NewLog()
 
+	tracing, err := core.NewTracing(logger)
+	if err != nil {
+		return nil, err
+	}
+
 	httpServer := core.NewHTTPServer(logger)
 	httpServer.Use(core.SessionMiddleware)
 
@@ -55,6 +72,7 @@ func InitializeApp() (*WebApp, error) {
 		Health:       health,
 		ProxyManager: proxymanager,
 		Dashboard:    dash,
+		Tracing:      tracing,
 	}
 	return webApp, nil
 }
@@ -72,11 +90,25 @@ func main() {
 	app.Start()
 	defer app.Stop()
 
-	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 10 seconds.
+	// Reload the configuration on SIGHUP
+	//
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	// Wait for interrupt signal to gracefully shutdown the server with the drain timeout.
 	//
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
+
+	for {
+		select {
+		case <-reload:
+			app.Log.Info().Msg("SIGHUP received, reloading configuration")
+			app.Reload()
+		case <-quit:
+			return
+		}
+	}
 }
 
 func (app *WebApp) Start() {
@@ -85,19 +117,22 @@ func (app *WebApp) Start() {
 
 	// Start the webserver
 	//
+	// dashboard event streams are closed when the shutdown starts
+	ctx, cancel := context.WithCancel(context.Background())
+	httpConfig := config.Config.Load().HTTP
+	app.server = &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", httpConfig.Hostname, httpConfig.Port),
+		ReadHeaderTimeout: core.ReadHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	app.server.RegisterOnShutdown(cancel)
+
 	go func() {
 		app.Log.Info().Msg("Initializing WebServer")
 
-		// Start the webserver
-		//
-		srv := http.Server{
-			Addr:              fmt.Sprintf("%s:%d", config.Config.HTTP.Hostname, config.Config.HTTP.Port),
-			ReadHeaderTimeout: core.ReadHeaderTimeout,
-		}
-
 		app.Health.SetReady()
 
-		if err := app.HTTP.StartServer(&srv); errors.Is(err, http.ErrServerClosed) {
+		if err := app.HTTP.StartServer(app.server); !errors.Is(err, http.ErrServerClosed) {
 			app.Log.Fatal().Err(err).Msg("shutting down the server")
 		}
 	}()
@@ -112,20 +147,81 @@ func (app *WebApp) Start() {
 	//
 	app.ProxyManager.WatchEvents()
 
+	// Reload the configuration when the file changes
+	//
+	app.configFile = config.Watch(app.Reload)
+
 	// Add Routes
 	//
 	app.Dashboard.AddRoutes()
 	core.PprofAddRoutes(app.HTTP)
+	metrics.AddRoutes(app.HTTP)
+}
+
+// Reload loads the configuration file again and applies the changes.
+// The current configuration is kept if the new one is invalid.
+func (app *WebApp) Reload() {
+	app.reloadMtx.Lock()
+	defer app.reloadMtx.Unlock()
+
+	err := config.Reload(func(changes config.Changes) error {
+		if err := app.ProxyManager.ApplyConfig(changes); err != nil {
+			return err
+		}
+
+		if changes.LogLevel {
+			level := config.Config.Load().Log.Level
+			if err := core.SetLogLevel(level); err != nil {
+				app.Log.Error().Err(err).Msg("Error changing log level")
+			}
+			app.Log.Info().Str("Log level", level).Msg("Log level changed")
+		}
+
+		for _, option := range changes.Restart {
+			app.Log.Warn().Str("option", option).Msg("Configuration change requires a restart")
+		}
+
+		return nil
+	})
+	if err != nil {
+		app.Log.Error().Err(err).Msg("Invalid configuration, keeping the current configuration")
+		return
+	}
+
+	app.Log.Info().Msg("Configuration reloaded")
 }
 
 func (app *WebApp) Stop() {
 	app.Log.Info().Msg("Shutdown server")
 
+	if err := app.configFile.Close(); err != nil {
+		app.Log.Error().Err(err).Msg("Error closing configuration watcher")
+	}
+
 	app.Health.SetNotReady()
 
 	// Shutdown things here
 	//
-	app.ProxyManager.StopAllProxies()
+	drainTimeout := config.Config.Load().DrainTimeout
+	app.Log.Info().Dur("timeout", drainTimeout).Msg("Draining connections")
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer drainCancel()
+
+	app.ProxyManager.StopAllProxies(drainCtx)
+
+	// the dashboard is the last to stop, to report not ready while draining
+	if err := app.server.Shutdown(drainCtx); err != nil {
+		app.Log.Warn().Err(err).Msg("Closing active dashboard requests")
+		if err := app.server.Close(); err != nil {
+			app.Log.Error().Err(err).Msg("Error stopping the dashboard server")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := app.Tracing.Shutdown(ctx); err != nil {
+		app.Log.Error().Err(err).Msg("Error flushing traces")
+	}
 
 	app.Log.Info().Msg("Server was shutdown successfully")
 }
@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package accesslog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+)
+
+// Special outputs of the access log.
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+// proxyPlaceholder is replaced by the proxy name in the output file name.
+const proxyPlaceholder = "{proxy}"
+
+type (
+	// Logger writes access log entries.
+	Logger interface {
+		Log(e *Entry)
+	}
+
+	// Manager creates the access loggers of the proxies and keeps the
+	// output files open while they are in use.
+	Manager struct {
+		log    zerolog.Logger
+		format formatter
+		sinks  map[string]*sink
+		cfg    config.AccessLogConfig
+		mtx    sync.Mutex
+	}
+
+	// sink is an output shared by the loggers writing to the same file.
+	sink struct {
+		w    io.Writer
+		refs int
+		mtx  sync.Mutex
+	}
+
+	// writerLogger writes formatted entries to a sink.
+	writerLogger struct {
+		log    zerolog.Logger
+		sink   *sink
+		format formatter
+	}
+
+	// zerologLogger writes entries to the general log.
+	zerologLogger struct {
+		log zerolog.Logger
+	}
+)
+
+// New returns a Manager of the access log configuration.
+func New(log zerolog.Logger, cfg config.AccessLogConfig) (*Manager, error) {
+	format, err := newFormatter(cfg.Format, cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		log:    log.With().Str("module", "accesslog").Logger(),
+		cfg:    cfg,
+		format: format,
+		sinks:  make(map[string]*sink),
+	}, nil
+}
+
+// Logger returns the access logger of a proxy. Loggers of files must be
+// released with Release when the proxy is closed.
+// Entries are written to log if the output is the general log or can't be opened.
+func (m *Manager) Logger(log zerolog.Logger, proxy string) Logger {
+	if m == nil || m.cfg.Output == "" {
+		return &zerologLogger{log: log}
+	}
+
+	name := m.outputName(proxy)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	s, ok := m.sinks[name]
+	if !ok {
+		w, err := m.openOutput(name)
+		if err != nil {
+			m.log.Error().Err(err).Str("output", name).Msg("error opening access log, using general log")
+			return &zerologLogger{log: log}
+		}
+		s = &sink{w: w}
+		m.sinks[name] = s
+	}
+	s.refs++
+
+	return &writerLogger{log: m.log, sink: s, format: m.format}
+}
+
+// Release closes the output of the proxy if there are no other loggers using it.
+func (m *Manager) Release(proxy string) error {
+	if m == nil || m.cfg.Output == "" {
+		return nil
+	}
+
+	name := m.outputName(proxy)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	s, ok := m.sinks[name]
+	if !ok {
+		return nil
+	}
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+
+	delete(m.sinks, name)
+	return closeOutput(s.w)
+}
+
+// Close closes all outputs.
+func (m *Manager) Close() error {
+	if m == nil {
+		return nil
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var errs error
+	for name, s := range m.sinks {
+		errs = errors.Join(errs, closeOutput(s.w))
+		delete(m.sinks, name)
+	}
+	return errs
+}
+
+func (m *Manager) outputName(proxy string) string {
+	return strings.ReplaceAll(m.cfg.Output, proxyPlaceholder, proxy)
+}
+
+func (m *Manager) openOutput(name string) (io.Writer, error) {
+	switch name {
+	case OutputStdout:
+		return os.Stdout, nil
+	case OutputStderr:
+		return os.Stderr, nil
+	}
+
+	return newRotatingFile(name, m.cfg.MaxSize, m.cfg.MaxBackups, m.cfg.MaxAge, m.cfg.RotateEvery)
+}
+
+func closeOutput(w io.Writer) error {
+	if f, ok := w.(*rotatingFile); ok {
+		return f.Close()
+	}
+	return nil
+}
+
+func (l *writerLogger) Log(e *Entry) {
+	var buf bytes.Buffer
+	if err := l.format(&buf, e); err != nil {
+		l.log.Error().Err(err).Msg("error formatting access log entry")
+		return
+	}
+	buf.WriteByte('\n')
+
+	l.sink.mtx.Lock()
+	defer l.sink.mtx.Unlock()
+
+	if _, err := l.sink.w.Write(buf.Bytes()); err != nil {
+		l.log.Error().Err(err).Msg("error writing access log entry")
+	}
+}
+
+func (l *zerologLogger) Log(e *Entry) {
+	var event *zerolog.Event
+	if e.Status >= http.StatusBadRequest {
+		event = l.log.Error() //nolint:zerologlint
+	} else {
+		event = l.log.Info() //nolint:zerologlint
+	}
+
+	event.
+		Str("port", e.Port).
+		Int("status", e.Status).
+		Str("method", e.Method).
+		Str("host", e.Host).
+		Str("client", e.Client).
+		Str("url", e.URI).
+		Str("username", e.User).
+		Str("target", e.Target).
+		Int64("bytesIn", e.BytesIn).
+		Int64("bytesOut", e.BytesOut).
+		Dur("latency", e.Latency).
+		Msg("request")
+}
@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+type (
+	// Entry is an access log entry of a proxied request, or of a TCP
+	// connection or UDP session, without the HTTP fields.
+	Entry struct {
+		Time        time.Time     `json:"time"`
+		Proxy       string        `json:"proxy"`
+		Port        string        `json:"port"`
+		Client      string        `json:"client"`
+		User        string        `json:"user,omitempty"`
+		DisplayName string        `json:"displayName,omitempty"`
+		Node        string        `json:"node,omitempty"`
+		Method      string        `json:"method"`
+		Host        string        `json:"host"`
+		URI         string        `json:"uri"`
+		Proto       string        `json:"proto"`
+		Referer     string        `json:"referer,omitempty"`
+		UserAgent   string        `json:"userAgent,omitempty"`
+		Target      string        `json:"target,omitempty"`
+		Latency     time.Duration `json:"-"`
+		Status      int           `json:"status"`
+		BytesIn     int64         `json:"bytesIn"`
+		BytesOut    int64         `json:"bytesOut"`
+	}
+
+	// formatter writes an entry as a single line.
+	formatter func(buf *bytes.Buffer, e *Entry) error
+)
+
+// Access log formats.
+const (
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+	FormatJSON     = "json"
+	FormatTemplate = "template"
+)
+
+// clfTimeFormat is the time format of the Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// newFormatter returns the formatter of the format.
+func newFormatter(format, tmpl string) (formatter, error) {
+	switch format {
+	case FormatCommon:
+		return formatCommon, nil
+	case FormatCombined, "":
+		return formatCombined, nil
+	case FormatJSON:
+		return formatJSON, nil
+	case FormatTemplate:
+		t, err := template.New("accesslog").Option("missingkey=zero").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access log template: %w", err)
+		}
+		return func(buf *bytes.Buffer, e *Entry) error {
+			return t.Execute(buf, e)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown access log format: %q", format)
+}
+
+// formatCommon writes the entry in the Common Log Format.
+func formatCommon(buf *bytes.Buffer, e *Entry) error {
+	buf.WriteString(orDash(e.clientHost()))
+	buf.WriteString(" - ")
+	writeField(buf, e.User)
+	buf.WriteString(" [")
+	buf.WriteString(e.Time.Format(clfTimeFormat))
+	buf.WriteString(`] "`)
+	writeField(buf, e.Method)
+	buf.WriteByte(' ')
+	writeField(buf, e.URI)
+	buf.WriteByte(' ')
+	writeField(buf, e.Proto)
+	buf.WriteString(`" `)
+	if e.Status > 0 {
+		buf.WriteString(strconv.Itoa(e.Status))
+	} else {
+		buf.WriteByte('-')
+	}
+	buf.WriteByte(' ')
+	if e.BytesOut > 0 {
+		buf.WriteString(strconv.FormatInt(e.BytesOut, 10))
+	} else {
+		buf.WriteByte('-')
+	}
+	return nil
+}
+
+// formatCombined writes the entry in the Combined Log Format, followed by
+// the upstream target and the latency in milliseconds.
+func formatCombined(buf *bytes.Buffer, e *Entry) error {
+	_ = formatCommon(buf, e)
+
+	buf.WriteString(` "`)
+	writeField(buf, e.Referer)
+	buf.WriteString(`" "`)
+	writeField(buf, e.UserAgent)
+	buf.WriteString(`" "`)
+	writeField(buf, e.Target)
+	buf.WriteString(`" `)
+	buf.WriteString(strconv.FormatInt(e.Latency.Milliseconds(), 10))
+	buf.WriteString("ms")
+	return nil
+}
+
+// formatJSON writes the entry as a JSON object.
+func formatJSON(buf *bytes.Buffer, e *Entry) error {
+	type jsonEntry struct {
+		*Entry
+		LatencyMs float64 `json:"latencyMs"`
+	}
+
+	b, err := json.Marshal(jsonEntry{Entry: e, LatencyMs: float64(e.Latency.Microseconds()) / 1000}) //nolint:mnd
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+// clientHost returns the client address without the port.
+func (e *Entry) clientHost() string {
+	host, _, err := net.SplitHostPort(e.Client)
+	if err != nil {
+		return e.Client
+	}
+	return host
+}
+
+// writeField writes a field of the client request, or a dash if it's empty.
+// Quotes, backslashes and control bytes are escaped like Apache does, so a
+// field can't break the quoted fields of the line.
+func writeField(buf *bytes.Buffer, s string) {
+	if s == "" {
+		buf.WriteByte('-')
+		return
+	}
+
+	const hex = "0123456789abcdef"
+	for i := range len(s) {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 0x20 || c == 0x7f: //nolint:mnd
+			buf.WriteString(`\x`)
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xf])
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package accesslog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	ts := time.Date(2025, time.January, 2, 15, 4, 5, 0, time.UTC)
+
+	request := &Entry{
+		Time:      ts,
+		Proxy:     "app",
+		Port:      "443/https",
+		Client:    "100.64.0.1:50000",
+		User:      "user@example.com",
+		Method:    "GET",
+		Host:      "app.example.ts.net",
+		URI:       "/index.html?q=1",
+		Proto:     "HTTP/1.1",
+		Referer:   "https://example.com/",
+		UserAgent: "curl/8.0",
+		Target:    "http://app:8080",
+		Latency:   1500 * time.Microsecond,
+		Status:    200,
+		BytesIn:   10,
+		BytesOut:  512,
+	}
+	connection := &Entry{
+		Time:     ts,
+		Proxy:    "db",
+		Port:     "5432/tcp",
+		Client:   "[fd7a:115c:a1e0::1]:50000",
+		Proto:    "TCP",
+		Target:   "tcp://db:5432",
+		Latency:  2 * time.Second,
+		BytesIn:  100,
+		BytesOut: 200,
+	}
+
+	quoted := *request
+	quoted.User = `evil"user`
+	quoted.Referer = `https://example.com/\"`
+	quoted.UserAgent = "agent\" \"x\n"
+
+	tests := []struct {
+		name    string
+		format  string
+		tmpl    string
+		entry   *Entry
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "common",
+			format: FormatCommon,
+			entry:  request,
+			want:   `100.64.0.1 - user@example.com [02/Jan/2025:15:04:05 +0000] "GET /index.html?q=1 HTTP/1.1" 200 512`,
+		},
+		{
+			name:   "common connection",
+			format: FormatCommon,
+			entry:  connection,
+			want:   `fd7a:115c:a1e0::1 - - [02/Jan/2025:15:04:05 +0000] "- - TCP" - 200`,
+		},
+		{
+			name:   "combined",
+			format: FormatCombined,
+			entry:  request,
+			want: `100.64.0.1 - user@example.com [02/Jan/2025:15:04:05 +0000] "GET /index.html?q=1 HTTP/1.1" 200 512` +
+				` "https://example.com/" "curl/8.0" "http://app:8080" 1ms`,
+		},
+		{
+			name:   "combined escapes request fields",
+			format: FormatCombined,
+			entry:  &quoted,
+			want: `100.64.0.1 - evil\"user [02/Jan/2025:15:04:05 +0000] "GET /index.html?q=1 HTTP/1.1" 200 512` +
+				` "https://example.com/\\\"" "agent\" \"x\x0a" "http://app:8080" 1ms`,
+		},
+		{
+			name:  "combined is the default",
+			entry: connection,
+			want:  `fd7a:115c:a1e0::1 - - [02/Jan/2025:15:04:05 +0000] "- - TCP" - 200 "-" "-" "tcp://db:5432" 2000ms`,
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			entry:  connection,
+			want: `{"time":"2025-01-02T15:04:05Z","proxy":"db","port":"5432/tcp","client":"[fd7a:115c:a1e0::1]:50000",` +
+				`"method":"","host":"","uri":"","proto":"TCP","target":"tcp://db:5432","status":0,"bytesIn":100,"bytesOut":200,` +
+				`"latencyMs":2000}`,
+		},
+		{
+			name:   "template",
+			format: FormatTemplate,
+			tmpl:   `{{.Proxy}} {{.User}} {{.Status}} {{.Latency}}`,
+			entry:  request,
+			want:   `app user@example.com 200 1.5ms`,
+		},
+		{
+			name:    "invalid template",
+			format:  FormatTemplate,
+			tmpl:    `{{.Proxy`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown format",
+			format:  "apache",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newFormatter(tt.format, tt.tmpl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var buf bytes.Buffer
+			if err := f(&buf, tt.entry); err != nil {
+				t.Fatalf("error formatting entry: %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
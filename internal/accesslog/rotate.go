@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/consts"
+)
+
+// backupTimeFormat is the timestamp added to the name of rotated files.
+const backupTimeFormat = "20060102T150405"
+
+// backupGlob matches the timestamp of rotated files.
+const backupGlob = "[0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9]T[0-9][0-9][0-9][0-9][0-9][0-9]*"
+
+// megabyte is the unit of maxSize.
+const megabyte = 1024 * 1024
+
+type (
+	// rotatingFile is an io.WriteCloser that writes to a file and rotates it
+	// by size or time. Rotated files are renamed with a timestamp and removed
+	// when they exceed maxBackups or maxAge.
+	rotatingFile struct {
+		file        *os.File
+		openedAt    time.Time
+		filename    string
+		maxSize     int64
+		size        int64
+		maxBackups  int
+		maxAge      time.Duration
+		rotateEvery time.Duration
+		mtx         sync.Mutex
+	}
+)
+
+func newRotatingFile(filename string, maxSizeMB, maxBackups int, maxAge, rotateEvery time.Duration) (*rotatingFile, error) {
+	f := &rotatingFile{
+		filename:    filename,
+		maxSize:     int64(maxSizeMB) * megabyte,
+		maxBackups:  maxBackups,
+		maxAge:      maxAge,
+		rotateEvery: rotateEvery,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *rotatingFile) shouldRotate(n int64) bool {
+	if f.maxSize > 0 && f.size > 0 && f.size+n > f.maxSize {
+		return true
+	}
+	if f.rotateEvery > 0 && time.Since(f.openedAt) >= f.rotateEvery {
+		return true
+	}
+	return false
+}
+
+// open opens or creates the log file, appending to existing content.
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.filename), consts.PermOwnerAll); err != nil {
+		return fmt.Errorf("error creating access log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(f.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, consts.PermAllRead+consts.PermOwnerWrite)
+	if err != nil {
+		return fmt.Errorf("error opening access log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error opening access log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	if f.rotateEvery > 0 && f.size > 0 {
+		// keep the rotation schedule of existing files
+		f.openedAt = info.ModTime().Truncate(f.rotateEvery)
+	}
+
+	return nil
+}
+
+// rotate renames the current file with a timestamp and opens a new one.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if err := os.Rename(f.filename, f.backupName(time.Now())); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error rotating access log file: %w", err)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.removeBackups()
+	return nil
+}
+
+// backupName returns the name of a rotated file, like access-20250102T150405.log.
+func (f *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.filename)
+	prefix := strings.TrimSuffix(f.filename, ext)
+
+	name := prefix + "-" + t.Format(backupTimeFormat) + ext
+	// don't overwrite a backup of the same second
+	for i := 1; fileExists(name); i++ {
+		name = fmt.Sprintf("%s-%s.%d%s", prefix, t.Format(backupTimeFormat), i, ext)
+	}
+	return name
+}
+
+// removeBackups removes the rotated files over maxBackups or older than maxAge.
+func (f *rotatingFile) removeBackups() {
+	if f.maxBackups <= 0 && f.maxAge <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(f.filename)
+	backups, err := filepath.Glob(strings.TrimSuffix(f.filename, ext) + "-" + backupGlob + ext)
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		modTime time.Time
+		name    string
+	}
+
+	list := make([]backup, 0, len(backups))
+	for _, name := range backups {
+		if info, err := os.Stat(name); err == nil {
+			list = append(list, backup{name: name, modTime: info.ModTime()})
+		}
+	}
+
+	// newest first
+	slices.SortFunc(list, func(a, b backup) int {
+		return b.modTime.Compare(a.modTime)
+	})
+
+	for i, b := range list {
+		if (f.maxBackups > 0 && i >= f.maxBackups) || (f.maxAge > 0 && time.Since(b.modTime) > f.maxAge) {
+			_ = os.Remove(b.name)
+		}
+	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
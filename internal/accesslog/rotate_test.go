@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package accesslog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	line := bytes.Repeat([]byte("x"), megabyte/2)
+
+	tests := []struct {
+		name        string
+		maxSizeMB   int
+		maxBackups  int
+		rotateEvery time.Duration
+		// elapsed is the time since the file was opened before each write
+		// after the first one
+		elapsed     time.Duration
+		writes      int
+		wantBackups int
+		wantSize    int64
+	}{
+		{
+			name:     "no rotation",
+			writes:   4,
+			wantSize: 4 * megabyte / 2,
+		},
+		{
+			name:        "rotate by size",
+			maxSizeMB:   1,
+			writes:      3,
+			wantBackups: 1,
+			wantSize:    megabyte / 2,
+		},
+		{
+			name:        "keep max backups",
+			maxSizeMB:   1,
+			maxBackups:  2,
+			writes:      10,
+			wantBackups: 2,
+			wantSize:    megabyte,
+		},
+		{
+			name:        "rotate by time",
+			rotateEvery: time.Hour,
+			elapsed:     2 * time.Hour,
+			writes:      2,
+			wantBackups: 1,
+			wantSize:    megabyte / 2,
+		},
+		{
+			name:        "not time to rotate",
+			rotateEvery: time.Hour,
+			elapsed:     time.Minute,
+			writes:      2,
+			wantSize:    megabyte,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "access.log")
+
+			f, err := newRotatingFile(filename, tt.maxSizeMB, tt.maxBackups, 0, tt.rotateEvery)
+			if err != nil {
+				t.Fatalf("error opening file: %v", err)
+			}
+			defer f.Close()
+
+			for i := range tt.writes {
+				if i > 0 {
+					f.openedAt = time.Now().Add(-tt.elapsed)
+				}
+				if _, err := f.Write(line); err != nil {
+					t.Fatalf("error writing: %v", err)
+				}
+			}
+
+			backups, err := filepath.Glob(filepath.Join(filepath.Dir(filename), "access-"+backupGlob+".log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(backups) != tt.wantBackups {
+				t.Errorf("got %d backups, want %d", len(backups), tt.wantBackups)
+			}
+
+			info, err := os.Stat(filename)
+			if err != nil {
+				t.Fatalf("error reading file: %v", err)
+			}
+			if info.Size() != tt.wantSize {
+				t.Errorf("got file size %d, want %d", info.Size(), tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestBackupName(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Date(2025, time.January, 2, 15, 4, 5, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		filename string
+		existing []string
+		want     string
+	}{
+		{
+			name:     "with extension",
+			filename: "access.log",
+			want:     "access-20250102T150405.log",
+		},
+		{
+			name:     "without extension",
+			filename: "access",
+			want:     "access-20250102T150405",
+		},
+		{
+			name:     "backup of the same second",
+			filename: "proxy.log",
+			existing: []string{"proxy-20250102T150405.log", "proxy-20250102T150405.1.log"},
+			want:     "proxy-20250102T150405.2.log",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f := &rotatingFile{filename: filepath.Join(dir, tt.filename)}
+			if got := f.backupName(ts); got != filepath.Join(dir, tt.want) {
+				t.Errorf("got %s, want %s", got, filepath.Join(dir, tt.want))
+			}
+		})
+	}
+}
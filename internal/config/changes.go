@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"reflect"
+	"slices"
+)
+
+type (
+	// Changes stores the differences between two configurations.
+	Changes struct {
+		Docker    ProviderChanges
+		Lists     ProviderChanges
+		Tailscale ProviderChanges
+
+		// Restart lists the changed options that only apply after a restart.
+		Restart []string
+
+		DefaultProxyProvider bool
+		LogLevel             bool
+		LAN                  bool
+		DNS                  bool
+		Retry                bool
+		HostnameCollision    bool
+		DrainTimeout         bool
+		ProxyAccessLog       bool
+	}
+
+	// ProviderChanges stores the names of the added, removed and changed providers.
+	ProviderChanges struct {
+		Added   []string
+		Removed []string
+		Changed []string
+	}
+)
+
+// IsEmpty returns true if there are no changes.
+func (c ProviderChanges) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// diff returns the changes from old to c.
+func diff(old, c *config) Changes {
+	changes := Changes{
+		Docker:               diffProviders(old.Docker, c.Docker),
+		Lists:                diffProviders(old.Lists, c.Lists),
+		Tailscale:            diffProviders(old.Tailscale.Providers, c.Tailscale.Providers),
+		DefaultProxyProvider: old.DefaultProxyProvider != c.DefaultProxyProvider,
+		LogLevel:             old.Log.Level != c.Log.Level,
+		LAN:                  !reflect.DeepEqual(old.LAN, c.LAN),
+		DNS:                  !reflect.DeepEqual(old.DNS, c.DNS),
+		Retry:                old.Retry != c.Retry,
+		HostnameCollision:    old.HostnameCollision != c.HostnameCollision,
+		DrainTimeout:         old.DrainTimeout != c.DrainTimeout,
+		ProxyAccessLog:       old.ProxyAccessLog != c.ProxyAccessLog,
+	}
+
+	if old.HTTP != c.HTTP {
+		changes.Restart = append(changes.Restart, "http")
+	}
+	if old.Log.JSON != c.Log.JSON {
+		changes.Restart = append(changes.Restart, "log.json")
+	}
+	if old.Log.Access != c.Log.Access {
+		changes.Restart = append(changes.Restart, "log.access")
+	}
+	if !reflect.DeepEqual(old.Tracing, c.Tracing) {
+		changes.Restart = append(changes.Restart, "tracing")
+	}
+	if old.Tailscale.DataDir != c.Tailscale.DataDir {
+		changes.Restart = append(changes.Restart, "tailscale.dataDir")
+	}
+
+	return changes
+}
+
+// diffProviders returns the changes of the providers from old to c.
+func diffProviders[T any](old, c map[string]*T) ProviderChanges {
+	var changes ProviderChanges
+
+	for name, cfg := range c {
+		oldCfg, ok := old[name]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, name)
+		case !reflect.DeepEqual(oldCfg, cfg):
+			changes.Changed = append(changes.Changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := c[name]; !ok {
+			changes.Removed = append(changes.Removed, name)
+		}
+	}
+
+	slices.Sort(changes.Added)
+	slices.Sort(changes.Removed)
+	slices.Sort(changes.Changed)
+
+	return changes
+}
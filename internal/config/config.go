@@ -9,8 +9,12 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"reflect"
+	"sync/atomic"
+	"time"
 
 	"github.com/creasty/defaults"
+	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
 )
 
@@ -24,17 +28,59 @@ type (
 		Lists     map[string]*ListTargetProviderConfig   `validate:"dive,required" yaml:"lists"`
 		Tailscale TailscaleProxyProviderConfig           `yaml:"tailscale"`
 
-		HTTP HTTPConfig `yaml:"http"`
-		LAN  LANConfig  `yaml:"lanListener"`
-		Log  LogConfig  `yaml:"log"`
+		HTTP    HTTPConfig    `yaml:"http"`
+		LAN     LANConfig     `yaml:"lanListener"`
+		DNS     DNSConfig     `yaml:"dns"`
+		Log     LogConfig     `yaml:"log"`
+		Tracing TracingConfig `yaml:"tracing"`
+		Retry   RetryConfig   `yaml:"retry"`
 
+		// HostnameCollision is the policy of targets with the hostname of another target.
+		HostnameCollision string `validate:"oneof=reject suffix firstWins" default:"reject" yaml:"hostnameCollision"`
+
+		// DrainTimeout is the time to wait for active connections on shutdown.
+		DrainTimeout time.Duration `validate:"min=0" default:"5s" yaml:"drainTimeout"`
+
+		// ProxyAccessLog is the access log default of the Docker containers.
 		ProxyAccessLog bool `validate:"boolean" default:"true" yaml:"proxyAccessLog"`
 	}
 
 	// LogConfig stores logging configuration.
 	LogConfig struct {
-		Level string `validate:"required,oneof=debug info warn error fatal panic trace" default:"info" yaml:"level"`
-		JSON  bool   `validate:"boolean" default:"false" yaml:"json"`
+		Level  string          `validate:"required,oneof=debug info warn error fatal panic trace" default:"info" yaml:"level"`
+		Access AccessLogConfig `yaml:"access"`
+		JSON   bool            `validate:"boolean" default:"false" yaml:"json"`
+	}
+
+	// AccessLogConfig stores proxy access log configuration.
+	// Access entries are written to the general log if Output is empty.
+	AccessLogConfig struct {
+		Output      string        `validate:"omitempty" yaml:"output,omitempty"`
+		Format      string        `validate:"oneof=common combined json template" default:"combined" yaml:"format"`
+		Template    string        `validate:"required_if=Format template" yaml:"template,omitempty"`
+		MaxSize     int           `validate:"min=0" yaml:"maxSize,omitempty"`
+		MaxBackups  int           `validate:"min=0" yaml:"maxBackups,omitempty"`
+		MaxAge      time.Duration `validate:"min=0" yaml:"maxAge,omitempty"`
+		RotateEvery time.Duration `validate:"min=0" yaml:"rotateEvery,omitempty"`
+	}
+
+	// TracingConfig stores OpenTelemetry tracing configuration.
+	TracingConfig struct {
+		Endpoint    string            `validate:"omitempty,url" yaml:"endpoint,omitempty"`
+		Headers     map[string]string `validate:"dive,keys,required,endkeys" yaml:"headers,omitempty"`
+		ServiceName string            `validate:"required" default:"tsdproxy" yaml:"serviceName"`
+		SampleRatio float64           `validate:"min=0,max=1" default:"1" yaml:"sampleRatio"`
+		Enabled     bool              `validate:"boolean" default:"false" yaml:"enabled"`
+	}
+
+	// RetryConfig stores how proxies that fail to start are retried.
+	// The delay between retries doubles from InitialDelay up to MaxDelay.
+	RetryConfig struct {
+		InitialDelay time.Duration `validate:"min=0" default:"5s" yaml:"initialDelay"`
+		MaxDelay     time.Duration `validate:"min=0" default:"5m" yaml:"maxDelay"`
+		// MaxAttempts is the number of retries, 0 retries forever.
+		MaxAttempts int  `validate:"min=0" default:"0" yaml:"maxAttempts"`
+		Enabled     bool `validate:"boolean" default:"true" yaml:"enabled"`
 	}
 
 	// HTTPConfig stores HTTP configuration.
@@ -43,11 +89,83 @@ type (
 		Port     uint16 `validate:"numeric,min=1,max=65535,required" default:"8080" yaml:"port"`
 	}
 
+	// DNSConfig stores the DNS server configuration.
+	DNSConfig struct {
+		Enabled bool `validate:"boolean" default:"false" yaml:"enabled"`
+		// Hostname is the bind address, the LAN listener hostname if empty.
+		Hostname string `validate:"omitempty,ip|hostname" yaml:"hostname,omitempty"`
+		Port     uint16 `validate:"numeric,min=1,max=65535,required" default:"53" yaml:"port"`
+		// Zone is answered with <hostname>.<zone> for each proxy.
+		Zone string `validate:"omitempty,hostname" yaml:"zone,omitempty"`
+		// IPs are the addresses of the records, the LAN listener hostname by default.
+		IPs []string `validate:"dive,ip" yaml:"ips,omitempty"`
+		// Upstreams are the resolvers of the other queries.
+		Upstreams []string `validate:"dive,hostname_port" yaml:"upstreams,omitempty"`
+		// AllowedNetworks are the client networks whose queries are forwarded,
+		// loopback and private networks if empty.
+		AllowedNetworks []string      `validate:"dive,cidr" yaml:"allowedNetworks,omitempty"`
+		TTL             time.Duration `validate:"min=1s" default:"60s" yaml:"ttl"`
+	}
+
 	// LANConfig stores LAN listener configuration.
 	LANConfig struct {
 		Enabled  bool   `validate:"boolean" default:"true" yaml:"enabled"`
 		Hostname string `validate:"ip|hostname,required" default:"0.0.0.0" yaml:"hostname"`
 		Port     uint16 `validate:"numeric,min=1,max=65535,required" default:"443" yaml:"port"`
+
+		// ExtraPorts are served with the proxy ports of the same number.
+		ExtraPorts []uint16 `validate:"dive,min=1,max=65535" yaml:"extraPorts,omitempty"`
+		// Domains are custom domains, where each proxy is <hostname>.<domain>.
+		Domains []string `validate:"dive,hostname" yaml:"domains,omitempty"`
+
+		HTTP         LANHTTPConfig         `yaml:"http"`
+		Certificates LANCertificatesConfig `yaml:"certificates"`
+		MDNS         LANMDNSConfig         `yaml:"mdns"`
+	}
+
+	// LANHTTPConfig stores the plain HTTP LAN listener configuration.
+	LANHTTPConfig struct {
+		Enabled bool   `validate:"boolean" default:"false" yaml:"enabled"`
+		Port    uint16 `validate:"numeric,min=1,max=65535,required" default:"80" yaml:"port"`
+		// Mode is redirect, to redirect to the HTTPS LAN listener, or serve.
+		Mode string `validate:"oneof=redirect serve" default:"redirect" yaml:"mode"`
+		// ACMEChallengeDir is the directory of the ACME HTTP-01 challenge files.
+		ACMEChallengeDir string `validate:"omitempty" yaml:"acmeChallengeDir,omitempty"`
+	}
+
+	// LANMDNSConfig stores the multicast DNS configuration of the LAN listener.
+	LANMDNSConfig struct {
+		Enabled bool `validate:"boolean" default:"false" yaml:"enabled"`
+		// Services enables the DNS-SD _https._tcp service records.
+		Services bool `validate:"boolean" default:"false" yaml:"services"`
+		// Interfaces are the network interfaces to answer on, all if empty.
+		Interfaces []string      `yaml:"interfaces,omitempty"`
+		TTL        time.Duration `validate:"min=1s" default:"120s" yaml:"ttl"`
+	}
+
+	// LANCertificatesConfig stores the certificates configuration of the LAN listener.
+	LANCertificatesConfig struct {
+		// Source is tailscale, files or ca.
+		Source string `validate:"oneof=tailscale files ca" default:"tailscale" yaml:"source"`
+		// Dir is a directory of certificate and key files, of the files source.
+		Dir string `validate:"omitempty" yaml:"dir,omitempty"`
+		// Files are certificate and key files, of the files source.
+		Files []LANCertificateFile `validate:"dive" yaml:"files,omitempty"`
+		CA    LANCAConfig          `yaml:"ca"`
+	}
+
+	// LANCertificateFile stores the files of a certificate.
+	LANCertificateFile struct {
+		Cert string `validate:"required" yaml:"cert"`
+		Key  string `validate:"required" yaml:"key"`
+	}
+
+	// LANCAConfig stores the configuration of the local CA of the ca source.
+	LANCAConfig struct {
+		// Dir is the directory of the CA certificate and key, created if needed.
+		Dir string `validate:"required" default:"/data/lanca" yaml:"dir"`
+		// Validity is the validity of the issued certificates.
+		Validity time.Duration `validate:"min=1h" default:"2160h" yaml:"validity"`
 	}
 
 	// DockerTargetProviderConfig struct stores Docker target provider configuration.
@@ -83,19 +201,21 @@ type (
 )
 
 // Config  is a global variable to store configuration.
-var Config *config
+// It's replaced on reload, so it's read with Config.Load().
+var Config atomic.Pointer[config]
+
+// configFile is the configuration file name.
+var configFile string
 
 // GetConfig loads, validates and returns configuration.
 func InitializeConfig() error {
-	Config = &config{}
-	Config.Tailscale.Providers = make(map[string]*TailscaleServerConfig)
-	Config.Docker = make(map[string]*DockerTargetProviderConfig)
-	Config.Lists = make(map[string]*ListTargetProviderConfig)
+	c := newConfig()
 
 	file := flag.String("config", "/config/tsdproxy.yaml", "loag configuration from file")
 	flag.Parse()
+	configFile = *file
 
-	fileConfig := NewConfigFile(log.Logger, *file, Config)
+	fileConfig := NewConfigFile(log.Logger, *file, c)
 
 	println("loading configuration from:", *file)
 
@@ -105,31 +225,93 @@ func InitializeConfig() error {
 		}
 		println("Generating default configuration to:", *file)
 
-		if err := defaults.Set(Config); err != nil {
+		if err := defaults.Set(c); err != nil {
 			fmt.Printf("Error loading defaults: %v", err)
 		}
 
-		Config.generateDefaultProviders()
+		c.generateDefaultProviders()
 		if err := fileConfig.Save(); err != nil {
 			return err
 		}
 	}
 
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	Config.Store(c)
+
+	return nil
+}
+
+// Reload loads the configuration file again and replaces Config with it.
+// apply is called with the changes after Config is replaced, and the previous
+// configuration is restored if the new configuration is invalid or apply
+// returns an error.
+func Reload(apply func(Changes) error) error {
+	c := newConfig()
+
+	if err := NewConfigFile(log.Logger, configFile, c).Load(); err != nil {
+		return err
+	}
+
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	old := Config.Load()
+	if reflect.DeepEqual(old, c) {
+		return nil
+	}
+	changes := diff(old, c)
+
+	Config.Store(c)
+	if err := apply(changes); err != nil {
+		Config.Store(old)
+		return err
+	}
+
+	return nil
+}
+
+// Watch calls onChange when the configuration file changes.
+func Watch(onChange func()) *ConfigFile {
+	f := NewConfigFile(log.Logger, configFile, nil)
+	f.OnChange(func(fsnotify.Event) {
+		onChange()
+	})
+	f.Watch()
+
+	return f
+}
+
+func newConfig() *config {
+	c := &config{}
+	c.Tailscale.Providers = make(map[string]*TailscaleServerConfig)
+	c.Docker = make(map[string]*DockerTargetProviderConfig)
+	c.Lists = make(map[string]*ListTargetProviderConfig)
+
+	return c
+}
+
+// prepare sets the default values, loads the auth keys from files and
+// validates the configuration.
+func (c *config) prepare() error {
 	// Load default values.
 	// Make sure to set default values after loading from file
 	// unless defaults of map type are not loaded.
-	if err := defaults.Set(Config); err != nil {
+	if err := defaults.Set(c); err != nil {
 		fmt.Printf("Error loading defaults: %v", err)
 	}
 
 	// load auth keys from files
-	for _, d := range Config.Tailscale.Providers {
+	for _, d := range c.Tailscale.Providers {
 		if d != nil && d.ClientSecret != "" && d.ClientID != "" {
 			continue
 		}
 
 		if d != nil && d.AuthKeyFile != "" {
-			authkey, err := Config.getAuthKeyFromFile(d.AuthKeyFile)
+			authkey, err := c.getAuthKeyFromFile(d.AuthKeyFile)
 			if err != nil {
 				return err
 			}
@@ -138,7 +320,7 @@ func InitializeConfig() error {
 	}
 
 	// validate config
-	if err := Config.validate(); err != nil {
+	if err := c.validate(); err != nil {
 		return err
 	}
 
@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/creasty/defaults"
+)
+
+// testConfig returns a configuration with the default values and a tailscale
+// provider.
+func testConfig(t *testing.T) *config {
+	t.Helper()
+
+	c := newConfig()
+	if err := defaults.Set(c); err != nil {
+		t.Fatal(err)
+	}
+	c.Tailscale.Providers["default"] = &TailscaleServerConfig{AuthKey: "key"}
+	c.Docker["local"] = &DockerTargetProviderConfig{Host: "unix:///var/run/docker.sock"}
+	return c
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *config)
+		want   Changes
+	}{
+		{
+			name:   "no changes",
+			change: func(*config) {},
+		},
+		{
+			name: "providers",
+			change: func(c *config) {
+				c.Docker["remote"] = &DockerTargetProviderConfig{Host: "tcp://remote:2375"}
+				delete(c.Docker, "local")
+				c.Tailscale.Providers["default"] = &TailscaleServerConfig{AuthKey: "other"}
+			},
+			want: Changes{
+				Docker:    ProviderChanges{Added: []string{"remote"}, Removed: []string{"local"}},
+				Tailscale: ProviderChanges{Changed: []string{"default"}},
+			},
+		},
+		{
+			name: "applied options",
+			change: func(c *config) {
+				c.Log.Level = "debug"
+				c.LAN.Domains = []string{"home.example.com"}
+				c.Retry.MaxAttempts = 3
+				c.HostnameCollision = "suffix"
+				c.DrainTimeout = time.Minute
+			},
+			want: Changes{
+				LogLevel:          true,
+				LAN:               true,
+				Retry:             true,
+				HostnameCollision: true,
+				DrainTimeout:      true,
+			},
+		},
+		{
+			name: "options applied after a restart",
+			change: func(c *config) {
+				c.HTTP.Port = 9090
+				c.Log.JSON = true
+				c.Tracing.Enabled = true
+				c.Tailscale.DataDir = "/other/"
+			},
+			want: Changes{
+				Restart: []string{"http", "log.json", "tracing", "tailscale.dataDir"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := testConfig(t)
+			c := testConfig(t)
+			tt.change(c)
+
+			if got := diff(old, c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got changes %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	configFile = filepath.Join(dir, "tsdproxy.yaml")
+
+	previous := Config.Load()
+	t.Cleanup(func() { Config.Store(previous) })
+
+	// writeConfig writes the configuration file with the log level.
+	writeConfig := func(t *testing.T, level string) {
+		t.Helper()
+
+		data := "defaultProxyProvider: default\n" +
+			"tailscale:\n  dataDir: " + dir + "\n  providers:\n    default:\n      authKey: key\n" +
+			"log:\n  level: " + level + "\n"
+		if err := os.WriteFile(configFile, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		level     string
+		applyErr  error
+		wantApply bool
+		wantErr   bool
+		wantLevel string
+	}{
+		{
+			name:      "applied",
+			level:     "debug",
+			wantApply: true,
+			wantLevel: "debug",
+		},
+		{
+			name:      "no changes",
+			level:     "debug",
+			wantLevel: "debug",
+		},
+		{
+			name:      "apply error restores the configuration",
+			level:     "warn",
+			applyErr:  errors.New("apply error"),
+			wantApply: true,
+			wantErr:   true,
+			wantLevel: "debug",
+		},
+		{
+			name:      "invalid configuration",
+			level:     "debug\nhostnameCollision: other",
+			wantErr:   true,
+			wantLevel: "debug",
+		},
+	}
+
+	// the first reload replaces the initial configuration
+	writeConfig(t, "info")
+	Config.Store(testConfig(t))
+	if err := Reload(func(Changes) error { return nil }); err != nil {
+		t.Fatalf("error loading configuration: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, tt.level)
+
+			applied := false
+			err := Reload(func(changes Changes) error {
+				applied = true
+				if !changes.LogLevel {
+					t.Errorf("got changes %+v, want log level", changes)
+				}
+				return tt.applyErr
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if applied != tt.wantApply {
+				t.Errorf("got applied %v, want %v", applied, tt.wantApply)
+			}
+			if got := Config.Load().Log.Level; got != tt.wantLevel {
+				t.Errorf("got log level %s, want %s", got, tt.wantLevel)
+			}
+		})
+	}
+}
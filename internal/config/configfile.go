@@ -23,6 +23,7 @@ type ConfigFile struct {
 	log  zerolog.Logger
 
 	onChange func(fsnotify.Event)
+	watcher  *fsnotify.Watcher
 
 	filename string
 
@@ -95,6 +96,10 @@ func (f *ConfigFile) Watch() {
 		}
 		defer watcher.Close()
 
+		f.mtx.Lock()
+		f.watcher = watcher
+		f.mtx.Unlock()
+
 		file := filepath.Clean(f.filename)
 		dir, _ := filepath.Split(file)
 
@@ -118,6 +123,18 @@ func (f *ConfigFile) Watch() {
 	initWG.Wait()
 }
 
+// Close stops watching the config file.
+func (f *ConfigFile) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.watcher == nil {
+		return nil
+	}
+
+	return f.watcher.Close()
+}
+
 func (f *ConfigFile) watchEvents(watcher *fsnotify.Watcher, file string, eventsWG *sync.WaitGroup) {
 	realFile, _ := filepath.EvalSymlinks(f.filename)
 	for {
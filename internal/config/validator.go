@@ -26,7 +26,7 @@ func (c *config) validate() error {
 	println("Validating configuration...")
 	validate := validator.New()
 
-	if err := validate.Struct(Config); err != nil {
+	if err := validate.Struct(c); err != nil {
 		// validationErrors := err.(validator.ValidationErrors)
 		var validationErrors validator.ValidationErrors
 		if errors.As(err, &validationErrors) {
@@ -23,14 +23,15 @@ func NewLog() zerolog.Logger {
 
 	var logger zerolog.Logger
 
-	if config.Config.Log.JSON {
+	cfg := config.Config.Load().Log
+	if cfg.JSON {
 		logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
 	} else {
 		logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Logger()
 	}
 
 	log.Logger = logger
-	logLevel, err := zerolog.ParseLevel(config.Config.Log.Level)
+	logLevel, err := zerolog.ParseLevel(cfg.Level)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Could not parse log level")
 	}
@@ -40,11 +41,23 @@ func NewLog() zerolog.Logger {
 	}
 
 	zerolog.SetGlobalLevel(logLevel)
-	logger.Info().Str("Log level", config.Config.Log.Level).Msg("Log Settings")
+	logger.Info().Str("Log level", cfg.Level).Msg("Log Settings")
 
 	return logger
 }
 
+// SetLogLevel changes the level of all loggers.
+func SetLogLevel(level string) error {
+	logLevel, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	zerolog.SetGlobalLevel(logLevel)
+
+	return nil
+}
+
 // LogRecord warps a http.ResponseWriter and records the status.
 type LogRecord struct {
 	err error
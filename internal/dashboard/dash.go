@@ -4,6 +4,9 @@
 package dashboard
 
 import (
+	"errors"
+	"net/http"
+	"slices"
 	"sync"
 
 	"github.com/almeidapaulopt/tsdproxy/internal/core"
@@ -15,6 +18,9 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// dashboardHistorySize is the number of status transitions shown in the proxy details.
+const dashboardHistorySize = 20
+
 type Dashboard struct {
 	Log        zerolog.Logger
 	HTTP       *core.HTTPServer
@@ -39,9 +45,63 @@ func NewDashboard(http *core.HTTPServer, log zerolog.Logger, pm *proxymanager.Pr
 // AddRoutes method add dashboard related routes to the http server
 func (dash *Dashboard) AddRoutes() {
 	dash.HTTP.Get("/stream", dash.streamHandler())
+	dash.HTTP.Post("/proxies/{name}/retry", dash.retryHandler())
+	dash.HTTP.Get("/proxies/{name}/history", dash.historyHandler())
+	dash.HTTP.Get("/lan/ca.crt", dash.lanCAHandler())
 	dash.HTTP.Get("/", web.Static)
 }
 
+// historyHandler is the HandlerFunc to get the status history of a proxy
+func (dash *Dashboard) historyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		history, ok := dash.pm.GetStatusHistory(name)
+		if !ok {
+			dash.HTTP.JSONResponseCode(w, r, map[string]string{"status": "NOK", "error": proxymanager.ErrProxyNotFound.Error()}, http.StatusNotFound)
+			return
+		}
+
+		dash.HTTP.JSONResponse(w, r, map[string]any{
+			"proxy":   name,
+			"history": history,
+		})
+	}
+}
+
+// lanCAHandler is the HandlerFunc to download the certificate of the LAN CA
+func (dash *Dashboard) lanCAHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cert, ok := dash.pm.GetLANRootCA()
+		if !ok {
+			dash.HTTP.JSONResponseCode(w, r, map[string]string{"status": "NOK", "error": "LAN CA not enabled"}, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		w.Header().Set("Content-Disposition", `attachment; filename="tsdproxy-lan-ca.crt"`)
+		if _, err := w.Write(cert); err != nil {
+			dash.Log.Error().Err(err).Msg("Error writing LAN CA certificate")
+		}
+	}
+}
+
+// retryHandler is the HandlerFunc to retry a proxy that failed to start
+func (dash *Dashboard) retryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := dash.pm.RetryProxy(r.PathValue("name"))
+
+		switch {
+		case errors.Is(err, proxymanager.ErrProxyNotFound):
+			dash.HTTP.JSONResponseCode(w, r, map[string]string{"status": "NOK", "error": err.Error()}, http.StatusNotFound)
+		case errors.Is(err, proxymanager.ErrProxyNotFailed):
+			dash.HTTP.JSONResponseCode(w, r, map[string]string{"status": "NOK", "error": err.Error()}, http.StatusConflict)
+		default:
+			dash.HTTP.JSONResponseCode(w, r, map[string]string{"status": "OK"}, http.StatusOK)
+		}
+	}
+}
+
 // index is the HandlerFunc to index page of dashboard
 func (dash *Dashboard) renderList(ch chan SSEMessage) {
 	dash.mtx.RLock()
@@ -56,7 +116,7 @@ func (dash *Dashboard) renderList(ch chan SSEMessage) {
 	proxies := dash.pm.GetProxies()
 	_ = proxies
 	for name, p := range dash.pm.Proxies {
-		if p.Config.Dashboard.Visible {
+		if p.GetConfig().Dashboard.Visible {
 			dash.renderProxy(ch, name, EventAppend)
 		}
 	}
@@ -77,25 +137,38 @@ func (dash *Dashboard) renderProxy(ch chan SSEMessage, name string, ev EventType
 		url = p.GetAuthURL()
 	}
 
-	icon := p.Config.Dashboard.Icon
+	cfg := p.GetConfig()
+
+	icon := cfg.Dashboard.Icon
 	if icon == "" {
 		icon = model.DefaultDashboardIcon
 	}
 
-	label := p.Config.Dashboard.Label
+	label := cfg.Dashboard.Label
 	if label == "" {
 		label = name
 	}
 
-	ports := make([]model.PortConfig, len(p.Config.Ports))
-	i := 0
-	for _, target := range p.Config.Ports {
-		ports[i] = target
-		i++
+	ports := make([]pages.PortData, 0, len(cfg.Ports))
+	for key, port := range cfg.Ports {
+		ports = append(ports, pages.PortData{
+			Name:    port.String(),
+			State:   p.GetPortState(key),
+			Targets: p.GetPortHealth(key),
+		})
 	}
 
 	enabled := status == model.ProxyStatusAuthenticating || status == model.ProxyStatusRunning
 
+	retry, _ := dash.pm.GetRetryState(name)
+
+	// newest transitions first
+	history, _ := dash.pm.GetStatusHistory(name)
+	if len(history) > dashboardHistorySize {
+		history = history[len(history)-dashboardHistorySize:]
+	}
+	slices.Reverse(history)
+
 	a := pages.ProxyData{
 		Enabled:     enabled,
 		Name:        name,
@@ -104,6 +177,9 @@ func (dash *Dashboard) renderProxy(ch chan SSEMessage, name string, ev EventType
 		Icon:        icon,
 		Label:       label,
 		Ports:       ports,
+		Retry:       retry,
+		History:     history,
+		Collisions:  dash.pm.GetCollisions(name),
 	}
 
 	ch <- SSEMessage{
@@ -139,6 +139,12 @@ func (dash *Dashboard) streamProxyUpdates() {
 	for event := range dash.pm.SubscribeStatusEvents() {
 		dash.mtx.RLock()
 		for _, sseClient := range dash.sseClients {
+			// port events only update the proxy
+			if event.Port != "" {
+				dash.renderProxy(sseClient.channel, event.ID, EventMerge)
+				continue
+			}
+
 			switch event.Status {
 			case model.ProxyStatusInitializing:
 				dash.renderProxy(sseClient.channel, event.ID, EventAppend)
@@ -0,0 +1,473 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+// Package dnsserver is a split-horizon DNS server for the LAN. It answers the
+// names of the proxies with the LAN listener addresses, and forwards the other
+// queries to upstream resolvers.
+package dnsserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+)
+
+// forwardTimeout is the timeout of a query to an upstream resolver.
+const forwardTimeout = 5 * time.Second
+
+var ErrNoAddresses = errors.New("no addresses for the DNS records, set dns.ips")
+
+type (
+	// Server is the DNS server.
+	Server struct {
+		log zerolog.Logger
+
+		udp *dns.Server
+		tcp *dns.Server
+
+		settings settings
+		serial   uint32
+
+		// fqdns are the MagicDNS FQDNs by proxy hostname, names the proxy
+		// hostnames by record name, and records the record names by proxy
+		// hostname
+		fqdns   map[string]string
+		names   map[string]string
+		records map[string][]string
+		mtx     sync.RWMutex
+	}
+
+	// settings are the options of a DNS configuration.
+	settings struct {
+		addr      string
+		zone      string
+		ips       []net.IP
+		upstreams []string
+		// allowed are the client networks whose queries are forwarded,
+		// loopback and private networks if empty
+		allowed []netip.Prefix
+		ttl     uint32
+	}
+
+	// Update is a configuration change of a running Server, prepared by
+	// Prepare. It's applied with Apply, or discarded with Abort.
+	Update struct {
+		server   *Server
+		settings settings
+		// udp and tcp listen on the new address, if it changed
+		udp *dns.Server
+		tcp *dns.Server
+	}
+)
+
+// New creates a Server. It listens on the configured hostname, or lanHost if
+// empty, and the records have the configured IPs, or lanHost if it's a
+// specific IP.
+func New(log zerolog.Logger, cfg config.DNSConfig, lanHost string) (*Server, error) {
+	st, err := newSettings(cfg, lanHost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		log:      log.With().Str("module", "dnsserver").Logger(),
+		settings: st,
+		serial:   uint32(time.Now().Unix()), //nolint:gosec
+		fqdns:    make(map[string]string),
+		names:    make(map[string]string),
+		records:  make(map[string][]string),
+	}, nil
+}
+
+func newSettings(cfg config.DNSConfig, lanHost string) (settings, error) {
+	var ips []net.IP
+	for _, ip := range cfg.IPs {
+		ips = append(ips, net.ParseIP(ip))
+	}
+	if len(ips) == 0 {
+		ip := net.ParseIP(lanHost)
+		if ip == nil || ip.IsUnspecified() {
+			return settings{}, ErrNoAddresses
+		}
+		ips = append(ips, ip)
+	}
+
+	allowed := make([]netip.Prefix, 0, len(cfg.AllowedNetworks))
+	for _, network := range cfg.AllowedNetworks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return settings{}, fmt.Errorf("invalid allowed network %s: %w", network, err)
+		}
+		allowed = append(allowed, prefix.Masked())
+	}
+
+	zone := ""
+	if cfg.Zone != "" {
+		zone = dns.CanonicalName(cfg.Zone)
+	}
+
+	hostname := cfg.Hostname
+	if hostname == "" {
+		hostname = lanHost
+	}
+
+	return settings{
+		addr:      net.JoinHostPort(hostname, strconv.Itoa(int(cfg.Port))),
+		zone:      zone,
+		ips:       ips,
+		upstreams: cfg.Upstreams,
+		allowed:   allowed,
+		ttl:       uint32(cfg.TTL.Seconds()),
+	}, nil
+}
+
+// Start starts listening on UDP and TCP.
+func (s *Server) Start() error {
+	s.mtx.RLock()
+	st := s.settings
+	s.mtx.RUnlock()
+
+	udp, tcp, err := s.listen(st.addr)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	s.udp, s.tcp = udp, tcp
+	s.mtx.Unlock()
+
+	s.serve(udp, tcp)
+	s.log.Info().Str("addr", st.addr).Str("zone", st.zone).Msg("DNS server started")
+
+	return nil
+}
+
+// Close stops the server, waiting for the active queries until ctx is done.
+func (s *Server) Close(ctx context.Context) error {
+	s.mtx.RLock()
+	servers := []*dns.Server{s.udp, s.tcp}
+	s.mtx.RUnlock()
+
+	var err error
+	for _, server := range servers {
+		if server != nil {
+			err = errors.Join(err, server.ShutdownContext(ctx))
+		}
+	}
+
+	return err
+}
+
+// Prepare prepares a configuration change of the running server. Nothing is
+// changed until the Update is applied, but the new address is listened on
+// if it changed, so a configuration that can't be applied returns an error.
+func (s *Server) Prepare(cfg config.DNSConfig, lanHost string) (*Update, error) {
+	st, err := newSettings(cfg, lanHost)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &Update{server: s, settings: st}
+
+	s.mtx.RLock()
+	addr := s.settings.addr
+	s.mtx.RUnlock()
+	if st.addr != addr {
+		if u.udp, u.tcp, err = s.listen(st.addr); err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// Apply applies the configuration change, keeping the records of the proxies.
+// The previous address is closed if it changed.
+func (u *Update) Apply() {
+	s := u.server
+
+	s.mtx.Lock()
+	zoneChanged := s.settings.zone != u.settings.zone
+	s.settings = u.settings
+	if zoneChanged {
+		for hostname, fqdn := range s.fqdns {
+			s.setNames(hostname, recordNames(hostname, fqdn, u.settings.zone))
+		}
+	}
+	s.serial++
+	oldUDP, oldTCP := s.udp, s.tcp
+	if u.udp != nil {
+		s.udp, s.tcp = u.udp, u.tcp
+	}
+	s.mtx.Unlock()
+
+	if u.udp == nil {
+		s.log.Info().Str("zone", u.settings.zone).Msg("DNS server reconfigured")
+		return
+	}
+
+	s.serve(u.udp, u.tcp)
+	s.log.Info().Str("addr", u.settings.addr).Str("zone", u.settings.zone).Msg("DNS server started")
+
+	ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
+	defer cancel()
+	for _, server := range []*dns.Server{oldUDP, oldTCP} {
+		if server == nil {
+			continue
+		}
+		if err := server.ShutdownContext(ctx); err != nil {
+			s.log.Debug().Err(err).Msg("Error stopping DNS server on the previous address")
+		}
+	}
+}
+
+// Abort discards the configuration change.
+func (u *Update) Abort() {
+	if u.udp != nil {
+		u.udp.PacketConn.Close()
+		u.tcp.Listener.Close()
+	}
+}
+
+// listen listens on UDP and TCP, and returns the servers to serve them.
+func (s *Server) listen(addr string) (*dns.Server, *dns.Server, error) {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listening DNS on UDP: %w", err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		return nil, nil, fmt.Errorf("error listening DNS on TCP: %w", err)
+	}
+
+	return &dns.Server{PacketConn: pc, Handler: s}, &dns.Server{Listener: ln, Handler: s}, nil
+}
+
+func (s *Server) serve(servers ...*dns.Server) {
+	for _, server := range servers {
+		go func() {
+			if err := server.ActivateAndServe(); err != nil && !errors.Is(err, net.ErrClosed) {
+				s.log.Error().Err(err).Msg("DNS server stopped with error")
+			}
+		}()
+	}
+}
+
+// Set sets the records of a proxy: <hostname>.<zone> and its MagicDNS FQDN,
+// if not empty.
+func (s *Server) Set(hostname, fqdn string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.fqdns[hostname] = fqdn
+	if s.setNames(hostname, recordNames(hostname, fqdn, s.settings.zone)) {
+		s.serial++
+		s.log.Info().Str("proxy", hostname).Strs("names", s.records[hostname]).Msg("DNS records updated")
+	}
+}
+
+// Remove removes the records of a proxy.
+func (s *Server) Remove(hostname string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	names, ok := s.records[hostname]
+	if !ok {
+		return
+	}
+	for _, name := range names {
+		delete(s.names, name)
+	}
+	delete(s.records, hostname)
+	delete(s.fqdns, hostname)
+	s.serial++
+
+	s.log.Info().Str("proxy", hostname).Msg("DNS records removed")
+}
+
+// setNames replaces the record names of a proxy, and returns whether they
+// changed. It must be called with the lock held.
+func (s *Server) setNames(hostname string, names []string) bool {
+	current := s.records[hostname]
+	for _, name := range current {
+		delete(s.names, name)
+	}
+	for _, name := range names {
+		s.names[name] = hostname
+	}
+	s.records[hostname] = names
+
+	return !slices.Equal(current, names)
+}
+
+// recordNames returns the record names of a proxy in a zone.
+func recordNames(hostname, fqdn, zone string) []string {
+	var names []string
+	if zone != "" {
+		names = append(names, dns.CanonicalName(hostname+"."+zone))
+	}
+	if fqdn != "" {
+		names = append(names, dns.CanonicalName(fqdn))
+	}
+
+	return names
+}
+
+// ServeDNS answers the queries of the proxy names and the zone, and forwards
+// the others.
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if len(req.Question) != 1 || req.Opcode != dns.OpcodeQuery {
+		s.reply(w, new(dns.Msg).SetRcode(req, dns.RcodeNotImplemented))
+		return
+	}
+
+	q := req.Question[0]
+	name := strings.ToLower(q.Name)
+
+	s.mtx.RLock()
+	_, isProxy := s.names[name]
+	st := s.settings
+	serial := s.serial
+	s.mtx.RUnlock()
+
+	switch {
+	case isProxy:
+		s.reply(w, st.answer(req, q, serial))
+	case st.zone != "" && dns.IsSubDomain(st.zone, name):
+		s.reply(w, st.answerZone(req, q, serial))
+	default:
+		s.forward(w, req, st)
+	}
+}
+
+// answer answers a query of a proxy name.
+func (st settings) answer(req *dns.Msg, q dns.Question, serial uint32) *dns.Msg {
+	resp := new(dns.Msg).SetReply(req)
+	resp.Authoritative = true
+
+	for _, ip := range st.ips {
+		hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: st.ttl}
+		ip4 := ip.To4()
+
+		switch {
+		case ip4 != nil && (q.Qtype == dns.TypeA || q.Qtype == dns.TypeANY):
+			hdr.Rrtype = dns.TypeA
+			resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: ip4})
+		case ip4 == nil && (q.Qtype == dns.TypeAAAA || q.Qtype == dns.TypeANY):
+			hdr.Rrtype = dns.TypeAAAA
+			resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+
+	if len(resp.Answer) == 0 && st.zone != "" && dns.IsSubDomain(st.zone, strings.ToLower(q.Name)) {
+		resp.Ns = []dns.RR{st.soa(serial)}
+	}
+
+	return resp
+}
+
+// answerZone answers a query of a name of the zone that isn't a proxy name.
+func (st settings) answerZone(req *dns.Msg, q dns.Question, serial uint32) *dns.Msg {
+	resp := new(dns.Msg).SetReply(req)
+	resp.Authoritative = true
+
+	if strings.ToLower(q.Name) != st.zone {
+		resp.Rcode = dns.RcodeNameError
+		resp.Ns = []dns.RR{st.soa(serial)}
+		return resp
+	}
+
+	if q.Qtype == dns.TypeSOA || q.Qtype == dns.TypeANY {
+		resp.Answer = []dns.RR{st.soa(serial)}
+	} else {
+		resp.Ns = []dns.RR{st.soa(serial)}
+	}
+
+	return resp
+}
+
+// forward answers a query with the answer of the first upstream resolver
+// that responds. Queries of clients outside the allowed networks are refused,
+// to not be an open resolver.
+func (s *Server) forward(w dns.ResponseWriter, req *dns.Msg, st settings) {
+	if len(st.upstreams) == 0 || !st.allowedClient(w.RemoteAddr()) {
+		s.reply(w, new(dns.Msg).SetRcode(req, dns.RcodeRefused))
+		return
+	}
+
+	client := &dns.Client{Net: "udp", Timeout: forwardTimeout}
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		client.Net = "tcp"
+	}
+
+	for _, upstream := range st.upstreams {
+		// truncated answers are returned, for the client to retry on TCP
+		resp, _, err := client.Exchange(req, upstream)
+		if err != nil {
+			s.log.Debug().Err(err).Str("upstream", upstream).Str("question", req.Question[0].String()).Msg("Error forwarding DNS query")
+			continue
+		}
+
+		resp.Id = req.Id
+		s.reply(w, resp)
+		return
+	}
+
+	s.reply(w, new(dns.Msg).SetRcode(req, dns.RcodeServerFailure))
+}
+
+// allowedClient returns whether the queries of a client can be forwarded.
+func (st settings) allowedClient(addr net.Addr) bool {
+	var ip netip.Addr
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip, _ = netip.AddrFromSlice(a.IP)
+	case *net.TCPAddr:
+		ip, _ = netip.AddrFromSlice(a.IP)
+	}
+	ip = ip.Unmap()
+	if !ip.IsValid() {
+		return false
+	}
+
+	if len(st.allowed) == 0 {
+		return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+	}
+
+	return slices.ContainsFunc(st.allowed, func(prefix netip.Prefix) bool {
+		return prefix.Contains(ip)
+	})
+}
+
+func (s *Server) reply(w dns.ResponseWriter, resp *dns.Msg) {
+	if err := w.WriteMsg(resp); err != nil {
+		s.log.Debug().Err(err).Msg("Error writing DNS answer")
+	}
+}
+
+// soa returns the SOA record of the zone.
+func (st settings) soa(serial uint32) dns.RR {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: st.zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: st.ttl},
+		Ns:      "ns." + st.zone,
+		Mbox:    "hostmaster." + st.zone,
+		Serial:  serial,
+		Refresh: st.ttl,
+		Retry:   st.ttl,
+		Expire:  st.ttl,
+		Minttl:  st.ttl,
+	}
+}
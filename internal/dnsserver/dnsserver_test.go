@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package dnsserver
+
+import (
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+)
+
+// recorder is a dns.ResponseWriter that records the answer of a query.
+type recorder struct {
+	dns.ResponseWriter
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (r *recorder) RemoteAddr() net.Addr {
+	return r.remote
+}
+
+func (r *recorder) WriteMsg(m *dns.Msg) error {
+	r.msg = m
+	return nil
+}
+
+// startUpstream starts a resolver that answers all A queries with 198.51.100.1.
+func startUpstream(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := new(dns.Msg).SetReply(req)
+			resp.Answer = []dns.RR{&dns.A{
+				Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.IPv4(198, 51, 100, 1),
+			}}
+			_ = w.WriteMsg(resp)
+		}),
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func TestServeDNS(t *testing.T) {
+	s, err := New(zerolog.Nop(), config.DNSConfig{
+		Zone:      "lan.example.com",
+		IPs:       []string{"192.168.1.10", "fd00::10"},
+		Upstreams: []string{startUpstream(t)},
+		TTL:       time.Minute,
+	}, "0.0.0.0")
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+	s.Set("app", "app.tailnet.ts.net")
+	s.Set("old", "")
+	s.Remove("old")
+
+	private := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 50000}
+	public := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 1), Port: 50000}
+
+	tests := []struct {
+		name    string
+		qname   string
+		qtype   uint16
+		client  net.Addr
+		noQuery bool
+		rcode   int
+		answers []string
+		// soa is true if the SOA of the zone is in the authority section
+		soa bool
+	}{
+		{
+			name:    "A of proxy",
+			qname:   "app.lan.example.com.",
+			qtype:   dns.TypeA,
+			answers: []string{"app.lan.example.com.\t60\tIN\tA\t192.168.1.10"},
+		},
+		{
+			name:    "AAAA of proxy",
+			qname:   "app.lan.example.com.",
+			qtype:   dns.TypeAAAA,
+			answers: []string{"app.lan.example.com.\t60\tIN\tAAAA\tfd00::10"},
+		},
+		{
+			name:  "ANY of proxy",
+			qname: "app.lan.example.com.",
+			qtype: dns.TypeANY,
+			answers: []string{
+				"app.lan.example.com.\t60\tIN\tA\t192.168.1.10",
+				"app.lan.example.com.\t60\tIN\tAAAA\tfd00::10",
+			},
+		},
+		{
+			name:    "names are case insensitive",
+			qname:   "App.LAN.example.com.",
+			qtype:   dns.TypeA,
+			answers: []string{"App.LAN.example.com.\t60\tIN\tA\t192.168.1.10"},
+		},
+		{
+			name:    "MagicDNS name",
+			qname:   "app.tailnet.ts.net.",
+			qtype:   dns.TypeA,
+			answers: []string{"app.tailnet.ts.net.\t60\tIN\tA\t192.168.1.10"},
+		},
+		{
+			name:  "other type of proxy",
+			qname: "app.lan.example.com.",
+			qtype: dns.TypeMX,
+			soa:   true,
+		},
+		{
+			name:  "unknown name of zone",
+			qname: "other.lan.example.com.",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeNameError,
+			soa:   true,
+		},
+		{
+			name:  "removed proxy",
+			qname: "old.lan.example.com.",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeNameError,
+			soa:   true,
+		},
+		{
+			name:  "SOA of zone",
+			qname: "lan.example.com.",
+			qtype: dns.TypeSOA,
+			answers: []string{
+				"lan.example.com.\t60\tIN\tSOA\tns.lan.example.com. hostmaster.lan.example.com. " +
+					"1 60 60 60 60",
+			},
+		},
+		{
+			name:    "forwarded",
+			qname:   "example.org.",
+			qtype:   dns.TypeA,
+			client:  private,
+			answers: []string{"example.org.\t300\tIN\tA\t198.51.100.1"},
+		},
+		{
+			name:   "not forwarded to public clients",
+			qname:  "example.org.",
+			qtype:  dns.TypeA,
+			client: public,
+			rcode:  dns.RcodeRefused,
+		},
+		{
+			name:    "not a query",
+			qname:   "app.lan.example.com.",
+			noQuery: true,
+			rcode:   dns.RcodeNotImplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := new(dns.Msg).SetQuestion(tt.qname, tt.qtype)
+			if tt.noQuery {
+				req.Opcode = dns.OpcodeNotify
+			}
+			client := tt.client
+			if client == nil {
+				client = public
+			}
+			// the serial changes on each update of the records
+			s.mtx.Lock()
+			s.serial = 1
+			s.mtx.Unlock()
+
+			w := &recorder{remote: client}
+			s.ServeDNS(w, req)
+			if w.msg == nil {
+				t.Fatal("no answer")
+			}
+
+			if w.msg.Rcode != tt.rcode {
+				t.Errorf("got rcode %s, want %s", dns.RcodeToString[w.msg.Rcode], dns.RcodeToString[tt.rcode])
+			}
+
+			var answers []string
+			for _, rr := range w.msg.Answer {
+				answers = append(answers, rr.String())
+			}
+			if !slices.Equal(answers, tt.answers) {
+				t.Errorf("got answers %q, want %q", answers, tt.answers)
+			}
+
+			soa := len(w.msg.Ns) == 1 && w.msg.Ns[0].Header().Rrtype == dns.TypeSOA
+			if soa != tt.soa {
+				t.Errorf("got authority %v, want SOA %v", w.msg.Ns, tt.soa)
+			}
+		})
+	}
+}
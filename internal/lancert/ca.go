@@ -0,0 +1,291 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package lancert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+	"github.com/almeidapaulopt/tsdproxy/internal/consts"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// CACertFile is the file of the CA certificate, to install on the clients.
+	CACertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+
+	caName     = "TSDProxy LAN CA"
+	caValidity = 10 * 365 * 24 * time.Hour
+
+	// certBackdate is subtracted from the start of the validity, for clients
+	// with clock skew.
+	certBackdate = time.Hour
+)
+
+// caDomains are the domains permitted by the CA name constraints, besides the
+// configured LAN domains: the multicast DNS names and the MagicDNS names.
+var caDomains = []string{"local", "ts.net"}
+
+// CA is a Store of certificates issued by a local CA. The CA is created on the
+// first start, and each hostname gets a certificate when it's first requested.
+// Certificates are issued again when less than a third of the validity is left.
+type CA struct {
+	log      zerolog.Logger
+	cert     *x509.Certificate
+	key      crypto.Signer
+	rootPEM  []byte
+	validity time.Duration
+
+	certs map[string]*tls.Certificate
+	// expiryLogged is set when the CA expiry was logged
+	expiryLogged bool
+	mtx          sync.Mutex
+}
+
+var _ Store = (*CA)(nil)
+
+// NewCA loads the CA of the configured directory, or creates it. A created CA
+// can only issue certificates for the LAN domains, the multicast DNS names and
+// the MagicDNS names.
+func NewCA(log zerolog.Logger, cfg config.LANCAConfig, domains []string) (*CA, error) {
+	ca := &CA{
+		log:      log,
+		validity: cfg.Validity,
+		certs:    make(map[string]*tls.Certificate),
+	}
+
+	certFile := filepath.Join(cfg.Dir, CACertFile)
+	keyFile := filepath.Join(cfg.Dir, caKeyFile)
+
+	if _, err := os.Stat(certFile); errors.Is(err, os.ErrNotExist) {
+		if err := createCA(cfg.Dir, certFile, keyFile, domains); err != nil {
+			return nil, fmt.Errorf("error creating LAN CA: %w", err)
+		}
+		log.Info().Str("cert", certFile).Msg("LAN CA created")
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading LAN CA: %w", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("error loading LAN CA: unsupported key")
+	}
+
+	ca.cert = pair.Leaf
+	ca.key = key
+	ca.rootPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.Leaf.Raw})
+
+	if time.Now().After(ca.cert.NotAfter) {
+		log.Warn().Str("cert", certFile).Time("notAfter", ca.cert.NotAfter).Msg("LAN CA expired")
+	}
+	for _, domain := range domains {
+		if !ca.permits(domain) {
+			log.Warn().Str("cert", certFile).Str("domain", domain).
+				Msg("LAN CA doesn't permit the domain, remove the CA directory to create it again")
+		}
+	}
+
+	return ca, nil
+}
+
+// GetCertificate returns the certificate of a hostname, issuing it if needed.
+func (ca *CA) GetCertificate(hostname string) (*tls.Certificate, error) {
+	ca.mtx.Lock()
+	defer ca.mtx.Unlock()
+
+	cert, ok := ca.certs[hostname]
+	if ok && ca.fresh(cert.Leaf) {
+		return cert, nil
+	}
+
+	cert, err := ca.issue(hostname)
+	if err != nil {
+		return nil, fmt.Errorf("error issuing certificate for %s: %w", hostname, err)
+	}
+	ca.certs[hostname] = cert
+
+	ca.log.Info().Str("hostname", hostname).Time("notAfter", cert.Leaf.NotAfter).Msg("Certificate issued")
+
+	if cert.Leaf.NotAfter.Equal(ca.cert.NotAfter) && !ca.expiryLogged {
+		ca.expiryLogged = true
+		ca.log.Warn().Time("notAfter", ca.cert.NotAfter).
+			Msg("LAN CA expires before the certificates validity, remove the CA directory to create it again")
+	}
+
+	return cert, nil
+}
+
+// fresh returns whether an issued certificate is kept. Certificates capped at
+// the CA expiry are always kept, since a new one wouldn't last longer.
+func (ca *CA) fresh(leaf *x509.Certificate) bool {
+	if leaf.NotAfter.Equal(ca.cert.NotAfter) {
+		return true
+	}
+
+	return time.Until(leaf.NotAfter) > ca.validity/3
+}
+
+// permits returns whether the CA name constraints permit a domain.
+func (ca *CA) permits(domain string) bool {
+	if len(ca.cert.PermittedDNSDomains) == 0 {
+		return true
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, permitted := range ca.cert.PermittedDNSDomains {
+		if domain == permitted || strings.HasSuffix(domain, "."+permitted) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RootPEM returns the CA certificate, to install on the clients.
+func (ca *CA) RootPEM() []byte {
+	return ca.rootPEM
+}
+
+// Close does nothing, issued certificates are only kept in memory.
+func (ca *CA) Close() error {
+	return nil
+}
+
+func (ca *CA) issue(hostname string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(ca.validity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hostname},
+		NotBefore:    now.Add(-certBackdate),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(hostname); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{hostname}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// createCA creates the CA certificate and key files. The CA is constrained to
+// the domains and caDomains, so its key can't issue certificates trusted for
+// other names.
+func createCA(dir, certFile, keyFile string, domains []string) error {
+	if err := os.MkdirAll(dir, consts.PermOwnerAll); err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: caName, Organization: []string{"TSDProxy"}},
+		NotBefore:             now.Add(-certBackdate),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         permittedDomains(domains),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, consts.PermOwnerRead+consts.PermOwnerWrite); err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return os.WriteFile(certFile, certPEM, consts.PermAllRead+consts.PermOwnerWrite)
+}
+
+// permittedDomains returns the domains of the CA name constraints.
+func permittedDomains(domains []string) []string {
+	permitted := make([]string, 0, len(domains)+len(caDomains))
+	for _, domain := range slices.Concat(domains, caDomains) {
+		domain = strings.ToLower(strings.Trim(domain, "."))
+		if domain != "" && !slices.Contains(permitted, domain) {
+			permitted = append(permitted, domain)
+		}
+	}
+
+	return permitted
+}
+
+// newSerial returns a random certificate serial number.
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)) //nolint:mnd
+}
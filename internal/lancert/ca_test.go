@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package lancert
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+// newTestCA returns a CA created in a temporary directory.
+func newTestCA(t *testing.T) *CA {
+	t.Helper()
+
+	ca, err := NewCA(zerolog.Nop(), config.LANCAConfig{Dir: t.TempDir(), Validity: 90 * 24 * time.Hour},
+		[]string{"home.example.com"})
+	if err != nil {
+		t.Fatalf("error creating CA: %v", err)
+	}
+	return ca
+}
+
+func TestCAIssue(t *testing.T) {
+	ca := newTestCA(t)
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca.RootPEM()) {
+		t.Fatal("invalid CA certificate")
+	}
+
+	tests := []struct {
+		name     string
+		hostname string
+		wantIP   bool
+		// wantInvalid is true if the certificate isn't valid for the clients,
+		// because the CA name constraints don't permit the hostname
+		wantInvalid bool
+	}{
+		{
+			name:     "LAN domain",
+			hostname: "app.home.example.com",
+		},
+		{
+			name:     "multicast DNS name",
+			hostname: "app.local",
+		},
+		{
+			name:     "MagicDNS name",
+			hostname: "app.tailnet.ts.net",
+		},
+		{
+			name:     "IP address",
+			hostname: "192.168.1.10",
+			wantIP:   true,
+		},
+		{
+			name:        "other domain",
+			hostname:    "app.example.org",
+			wantInvalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := ca.GetCertificate(tt.hostname)
+			if err != nil {
+				t.Fatalf("error issuing certificate: %v", err)
+			}
+
+			if tt.wantIP {
+				if len(cert.Leaf.IPAddresses) != 1 || !cert.Leaf.IPAddresses[0].Equal(net.ParseIP(tt.hostname)) {
+					t.Errorf("got IP addresses %v, want %s", cert.Leaf.IPAddresses, tt.hostname)
+				}
+			} else if len(cert.Leaf.DNSNames) != 1 || cert.Leaf.DNSNames[0] != tt.hostname {
+				t.Errorf("got DNS names %v, want %s", cert.Leaf.DNSNames, tt.hostname)
+			}
+
+			_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: tt.hostname, Roots: roots})
+			if (err != nil) != tt.wantInvalid {
+				t.Errorf("got verify error %v, want invalid %v", err, tt.wantInvalid)
+			}
+
+			again, err := ca.GetCertificate(tt.hostname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != cert {
+				t.Error("certificate was issued again")
+			}
+		})
+	}
+}
+
+func TestCARenew(t *testing.T) {
+	tests := []struct {
+		name string
+		// left is the validity left of the cached certificate
+		left time.Duration
+		// caLeft is the validity left of the CA, 0 to keep it
+		caLeft  time.Duration
+		wantNew bool
+	}{
+		{
+			name: "fresh certificate",
+			left: 60 * 24 * time.Hour,
+		},
+		{
+			name:    "less than a third left",
+			left:    20 * 24 * time.Hour,
+			wantNew: true,
+		},
+		{
+			name:    "expired",
+			left:    -time.Hour,
+			wantNew: true,
+		},
+		{
+			name:   "capped at the CA expiry",
+			caLeft: 10 * 24 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca := newTestCA(t)
+			if tt.caLeft != 0 {
+				expiring := *ca.cert
+				expiring.NotAfter = time.Now().Add(tt.caLeft).Truncate(time.Second)
+				ca.cert = &expiring
+			}
+
+			cert, err := ca.GetCertificate("app.home.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.left != 0 {
+				cert.Leaf.NotAfter = time.Now().Add(tt.left)
+			}
+
+			again, err := ca.GetCertificate("app.home.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (again != cert) != tt.wantNew {
+				t.Errorf("got new certificate %v, want %v", again != cert, tt.wantNew)
+			}
+		})
+	}
+}
+
+func TestNewCALoadsCA(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.LANCAConfig{Dir: dir, Validity: time.Hour}
+
+	created, err := NewCA(zerolog.Nop(), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewCA(zerolog.Nop(), cfg, []string{"home.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(created.RootPEM()) != string(loaded.RootPEM()) {
+		t.Error("CA was created again")
+	}
+	if loaded.permits("app.home.example.com") {
+		t.Error("domain added after the CA was created is permitted")
+	}
+	if !loaded.permits("app.local") {
+		t.Error("multicast DNS names aren't permitted")
+	}
+}
@@ -0,0 +1,243 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package lancert
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+// reloadDelay is the time to wait for more changes before reloading the files.
+const reloadDelay = 500 * time.Millisecond
+
+// Files is a Store of certificate and key files, reloaded when they change.
+//
+// The directory has <name>.crt or <name>.pem certificates with <name>.key
+// keys, and subdirectories with fullchain.pem and privkey.pem, like the
+// certbot live directory.
+type Files struct {
+	log     zerolog.Logger
+	dir     string
+	files   []config.LANCertificateFile
+	watcher *fsnotify.Watcher
+	timer   *time.Timer
+
+	// certs are the certificates by DNS name, including wildcards
+	certs map[string]*tls.Certificate
+	mtx   sync.RWMutex
+}
+
+var _ Store = (*Files)(nil)
+
+// NewFiles loads the certificates of a directory and files, and watches
+// them for changes.
+func NewFiles(log zerolog.Logger, dir string, files []config.LANCertificateFile) (*Files, error) {
+	f := &Files{
+		log:   log,
+		dir:   dir,
+		files: files,
+	}
+
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error watching certificates: %w", err)
+	}
+	f.watcher = watcher
+
+	for _, path := range f.watchedDirs() {
+		if err := watcher.Add(path); err != nil {
+			f.log.Warn().Err(err).Str("dir", path).Msg("Error watching certificates directory")
+		}
+	}
+
+	go f.watch()
+
+	return f, nil
+}
+
+// GetCertificate returns the certificate of a hostname, or of its wildcard.
+func (f *Files) GetCertificate(hostname string) (*tls.Certificate, error) {
+	f.mtx.RLock()
+	defer f.mtx.RUnlock()
+
+	if cert, ok := f.certs[hostname]; ok {
+		return cert, nil
+	}
+
+	return f.certs[wildcard(hostname)], nil
+}
+
+// Close stops watching the files.
+func (f *Files) Close() error {
+	f.mtx.Lock()
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	f.mtx.Unlock()
+
+	return f.watcher.Close()
+}
+
+// load loads all the certificates. The current certificates are kept if any
+// of them fails.
+func (f *Files) load() error {
+	pairs := f.files
+	if f.dir != "" {
+		dirPairs, err := scanDir(f.dir)
+		if err != nil {
+			return err
+		}
+		pairs = append(dirPairs, pairs...)
+	}
+
+	certs := make(map[string]*tls.Certificate)
+	for _, pair := range pairs {
+		cert, err := tls.LoadX509KeyPair(pair.Cert, pair.Key)
+		if err != nil {
+			return fmt.Errorf("error loading certificate %s: %w", pair.Cert, err)
+		}
+
+		for _, name := range cert.Leaf.DNSNames {
+			name = strings.ToLower(name)
+			// the certificate valid for longer is used
+			if current, ok := certs[name]; ok && current.Leaf.NotAfter.After(cert.Leaf.NotAfter) {
+				continue
+			}
+			certs[name] = &cert
+		}
+
+		if time.Now().After(cert.Leaf.NotAfter) {
+			f.log.Warn().Str("cert", pair.Cert).Time("notAfter", cert.Leaf.NotAfter).Msg("Certificate expired")
+		}
+	}
+
+	f.mtx.Lock()
+	f.certs = certs
+	f.mtx.Unlock()
+
+	f.log.Info().Int("certificates", len(pairs)).Int("names", len(certs)).Msg("Certificates loaded")
+
+	return nil
+}
+
+// watch reloads the certificates after changes of the watched directories.
+func (f *Files) watch() {
+	for {
+		select {
+		case event, ok := <-f.watcher.Events:
+			if !ok {
+				return
+			}
+			f.log.Trace().Str("file", event.Name).Str("op", event.Op.String()).Msg("Certificates changed")
+
+			// new subdirectories are watched too
+			if event.Has(fsnotify.Create) && filepath.Dir(event.Name) == filepath.Clean(f.dir) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					_ = f.watcher.Add(event.Name)
+				}
+			}
+
+			f.mtx.Lock()
+			if f.timer == nil {
+				f.timer = time.AfterFunc(reloadDelay, f.reload)
+			} else {
+				f.timer.Reset(reloadDelay)
+			}
+			f.mtx.Unlock()
+
+		case err, ok := <-f.watcher.Errors:
+			if !ok {
+				return
+			}
+			f.log.Error().Err(err).Msg("Error watching certificates")
+		}
+	}
+}
+
+func (f *Files) reload() {
+	if err := f.load(); err != nil {
+		f.log.Error().Err(err).Msg("Error reloading certificates, keeping the current certificates")
+	}
+}
+
+// watchedDirs returns the directories with certificates.
+func (f *Files) watchedDirs() []string {
+	dirs := make(map[string]struct{})
+
+	if f.dir != "" {
+		dirs[f.dir] = struct{}{}
+		entries, _ := os.ReadDir(f.dir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs[filepath.Join(f.dir, entry.Name())] = struct{}{}
+			}
+		}
+	}
+	for _, pair := range f.files {
+		dirs[filepath.Dir(pair.Cert)] = struct{}{}
+		dirs[filepath.Dir(pair.Key)] = struct{}{}
+	}
+
+	list := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		list = append(list, dir)
+	}
+
+	return list
+}
+
+// scanDir returns the certificate and key pairs of a directory.
+func scanDir(dir string) ([]config.LANCertificateFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificates directory: %w", err)
+	}
+
+	var pairs []config.LANCertificateFile
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		if entry.IsDir() {
+			pair := config.LANCertificateFile{
+				Cert: filepath.Join(path, "fullchain.pem"),
+				Key:  filepath.Join(path, "privkey.pem"),
+			}
+			if exists(pair.Cert) && exists(pair.Key) {
+				pairs = append(pairs, pair)
+			}
+			continue
+		}
+
+		ext := filepath.Ext(entry.Name())
+		if ext != ".crt" && ext != ".pem" {
+			continue
+		}
+		key := strings.TrimSuffix(path, ext) + ".key"
+		if exists(key) {
+			pairs = append(pairs, config.LANCertificateFile{Cert: path, Key: key})
+		}
+	}
+
+	return pairs, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package lancert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+// writeCert writes a self-signed certificate of the names and its key.
+func writeCert(t *testing.T, certFile, keyFile string, notAfter time.Time, names ...string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: names[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     names,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	extra := t.TempDir()
+	year := time.Now().Add(365 * 24 * time.Hour)
+
+	writeCert(t, filepath.Join(dir, "app.crt"), filepath.Join(dir, "app.key"), year, "app.example.com")
+	writeCert(t, filepath.Join(dir, "home", "fullchain.pem"), filepath.Join(dir, "home", "privkey.pem"), year,
+		"*.home.example.com")
+	// the certificate valid for longer is used
+	writeCert(t, filepath.Join(dir, "old.pem"), filepath.Join(dir, "old.key"), time.Now().Add(time.Hour),
+		"old.example.com")
+	writeCert(t, filepath.Join(extra, "cert.pem"), filepath.Join(extra, "key.pem"), year,
+		"old.example.com", "extra.example.com")
+
+	f, err := NewFiles(zerolog.Nop(), dir, []config.LANCertificateFile{
+		{Cert: filepath.Join(extra, "cert.pem"), Key: filepath.Join(extra, "key.pem")},
+	})
+	if err != nil {
+		t.Fatalf("error loading certificates: %v", err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name     string
+		hostname string
+		// want are the DNS names of the certificate, nil if there's none
+		want []string
+	}{
+		{
+			name:     "certificate and key of directory",
+			hostname: "app.example.com",
+			want:     []string{"app.example.com"},
+		},
+		{
+			name:     "wildcard of subdirectory",
+			hostname: "app.home.example.com",
+			want:     []string{"*.home.example.com"},
+		},
+		{
+			name:     "wildcard covers one label",
+			hostname: "a.app.home.example.com",
+		},
+		{
+			name:     "file",
+			hostname: "extra.example.com",
+			want:     []string{"old.example.com", "extra.example.com"},
+		},
+		{
+			name:     "certificate valid for longer",
+			hostname: "old.example.com",
+			want:     []string{"old.example.com", "extra.example.com"},
+		},
+		{
+			name:     "unknown hostname",
+			hostname: "other.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := f.GetCertificate(tt.hostname)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			if cert != nil {
+				got = cert.Leaf.DNSNames
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got certificate of %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilesReload(t *testing.T) {
+	dir := t.TempDir()
+	year := time.Now().Add(365 * 24 * time.Hour)
+	writeCert(t, filepath.Join(dir, "app.crt"), filepath.Join(dir, "app.key"), year, "app.example.com")
+
+	f, err := NewFiles(zerolog.Nop(), dir, nil)
+	if err != nil {
+		t.Fatalf("error loading certificates: %v", err)
+	}
+	defer f.Close()
+
+	// renewed certificates are loaded
+	writeCert(t, filepath.Join(dir, "app.crt"), filepath.Join(dir, "app.key"), year, "app.example.com",
+		"new.example.com")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if cert, _ := f.GetCertificate("new.example.com"); cert != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("renewed certificate wasn't loaded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// invalid files keep the current certificates
+	if err := os.WriteFile(filepath.Join(dir, "app.crt"), []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * reloadDelay)
+
+	if cert, _ := f.GetCertificate("new.example.com"); cert == nil {
+		t.Error("certificates weren't kept after an invalid change")
+	}
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+// Package lancert provides the certificates of the LAN listener, for the
+// hostnames that the Tailscale certificates don't cover.
+package lancert
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	SourceTailscale = "tailscale"
+	SourceFiles     = "files"
+	SourceCA        = "ca"
+)
+
+// Store provides certificates by hostname.
+type Store interface {
+	// GetCertificate returns the certificate of a hostname, or nil if the
+	// store doesn't have one.
+	GetCertificate(hostname string) (*tls.Certificate, error)
+	Close() error
+}
+
+// New returns the Store of the configured source, or nil for the Tailscale
+// certificates. domains are the LAN domains, permitted by a created CA.
+func New(log zerolog.Logger, cfg config.LANCertificatesConfig, domains []string) (Store, error) {
+	log = log.With().Str("module", "lancert").Str("source", cfg.Source).Logger()
+
+	switch cfg.Source {
+	case SourceFiles:
+		return NewFiles(log, cfg.Dir, cfg.Files)
+	case SourceCA:
+		return NewCA(log, cfg.CA, domains)
+	default:
+		return nil, nil //nolint:nilnil
+	}
+}
+
+// wildcard returns the wildcard name that covers a hostname.
+func wildcard(hostname string) string {
+	_, domain, ok := strings.Cut(hostname, ".")
+	if !ok {
+		return ""
+	}
+
+	return "*." + domain
+}
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package mdns
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	mdnsPort = 5353
+	// mdnsHopLimit is the TTL of the multicast packets, as required by RFC 6762.
+	mdnsHopLimit = 255
+)
+
+var (
+	groupIPv4 = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+	groupIPv6 = &net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: mdnsPort}
+)
+
+type (
+	// conn is a multicast DNS socket, that receives and sends packets on
+	// specific interfaces.
+	conn interface {
+		// read reads a packet, and returns the index of the interface it was
+		// received on.
+		read(b []byte) (n int, ifIndex int, src net.Addr, err error)
+		// write writes a packet to dst on an interface.
+		write(b []byte, ifIndex int, dst net.Addr) error
+		// group returns the multicast group address.
+		group() net.Addr
+		close() error
+	}
+
+	conn4 struct {
+		pc *ipv4.PacketConn
+	}
+
+	conn6 struct {
+		pc *ipv6.PacketConn
+	}
+)
+
+// listen4 joins the IPv4 multicast DNS group on the interfaces.
+func listen4(ifaces []net.Interface) (*conn4, error) {
+	udp, err := net.ListenMulticastUDP("udp4", nil, groupIPv4)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := ipv4.NewPacketConn(udp)
+	joined := 0
+	for i := range ifaces {
+		// the default interface is already joined by ListenMulticastUDP
+		if err := pc.JoinGroup(&ifaces[i], groupIPv4); err == nil || isAlreadyJoined(err) {
+			joined++
+		}
+	}
+	if joined == 0 {
+		udp.Close()
+		return nil, errNoInterfaces
+	}
+
+	if err := pc.SetControlMessage(ipv4.FlagInterface, true); err != nil {
+		udp.Close()
+		return nil, err
+	}
+	_ = pc.SetMulticastTTL(mdnsHopLimit)
+	_ = pc.SetMulticastLoopback(true)
+
+	return &conn4{pc: pc}, nil
+}
+
+func (c *conn4) read(b []byte) (int, int, net.Addr, error) {
+	n, cm, src, err := c.pc.ReadFrom(b)
+	if err != nil || cm == nil {
+		return n, 0, src, err
+	}
+
+	return n, cm.IfIndex, src, nil
+}
+
+func (c *conn4) write(b []byte, ifIndex int, dst net.Addr) error {
+	_, err := c.pc.WriteTo(b, &ipv4.ControlMessage{IfIndex: ifIndex}, dst)
+	return err
+}
+
+func (c *conn4) group() net.Addr {
+	return groupIPv4
+}
+
+func (c *conn4) close() error {
+	return c.pc.Close()
+}
+
+// listen6 joins the IPv6 multicast DNS group on the interfaces.
+func listen6(ifaces []net.Interface) (*conn6, error) {
+	udp, err := net.ListenMulticastUDP("udp6", nil, groupIPv6)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := ipv6.NewPacketConn(udp)
+	joined := 0
+	for i := range ifaces {
+		if err := pc.JoinGroup(&ifaces[i], groupIPv6); err == nil || isAlreadyJoined(err) {
+			joined++
+		}
+	}
+	if joined == 0 {
+		udp.Close()
+		return nil, errNoInterfaces
+	}
+
+	if err := pc.SetControlMessage(ipv6.FlagInterface, true); err != nil {
+		udp.Close()
+		return nil, err
+	}
+	_ = pc.SetMulticastHopLimit(mdnsHopLimit)
+	_ = pc.SetMulticastLoopback(true)
+
+	return &conn6{pc: pc}, nil
+}
+
+func (c *conn6) read(b []byte) (int, int, net.Addr, error) {
+	n, cm, src, err := c.pc.ReadFrom(b)
+	if err != nil || cm == nil {
+		return n, 0, src, err
+	}
+
+	return n, cm.IfIndex, src, nil
+}
+
+func (c *conn6) write(b []byte, ifIndex int, dst net.Addr) error {
+	_, err := c.pc.WriteTo(b, &ipv6.ControlMessage{IfIndex: ifIndex}, dst)
+	return err
+}
+
+func (c *conn6) group() net.Addr {
+	return groupIPv6
+}
+
+func (c *conn6) close() error {
+	return c.pc.Close()
+}
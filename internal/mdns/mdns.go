@@ -0,0 +1,464 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+// Package mdns answers multicast DNS (RFC 6762) queries for the <hostname>.local
+// names of the LAN listener, and optionally advertises them as DNS-SD
+// (RFC 6763) _https._tcp services.
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// probeCount and probeInterval are the number of probe queries sent
+	// before claiming a hostname and the interval between them.
+	probeCount    = 3
+	probeInterval = 250 * time.Millisecond
+
+	// announceCount and announceInterval are the number of unsolicited
+	// announcements of a new hostname and the interval between them.
+	announceCount    = 2
+	announceInterval = time.Second
+
+	// legacyTTL is the maximum TTL of the answers to legacy unicast queries.
+	legacyTTL = 10
+
+	// maxPacketSize is the maximum size of a multicast DNS packet.
+	maxPacketSize = 9000
+)
+
+var errNoInterfaces = errors.New("no network interface to join the multicast DNS group")
+
+// Responder answers the multicast DNS queries of its hostnames.
+type Responder struct {
+	log      zerolog.Logger
+	ttl      uint32
+	services bool
+	port     uint16
+	// bindIP restricts the addresses to the LAN listener address, if it isn't
+	// a wildcard address
+	bindIP net.IP
+
+	ifaces []net.Interface
+	conns  []conn
+
+	hosts map[string]struct{}
+	// probing stores the hostnames being probed, with a channel closed when
+	// another host answers for them
+	probing map[string]chan struct{}
+	mtx     sync.RWMutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New starts a Responder on the configured interfaces, with the addresses of
+// the LAN listener on bindHost and the service port.
+func New(log zerolog.Logger, cfg config.LANMDNSConfig, bindHost string, port uint16) (*Responder, error) {
+	ifaces, err := multicastInterfaces(cfg.Interfaces)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Responder{
+		log:      log.With().Str("module", "mdns").Logger(),
+		ttl:      uint32(cfg.TTL.Seconds()),
+		services: cfg.Services,
+		port:     port,
+		bindIP:   net.ParseIP(bindHost),
+		ifaces:   ifaces,
+		hosts:    make(map[string]struct{}),
+		probing:  make(map[string]chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	if r.bindIP != nil && r.bindIP.IsUnspecified() {
+		r.bindIP = nil
+	}
+
+	if c, err := listen4(ifaces); err != nil {
+		r.log.Warn().Err(err).Msg("Error listening multicast DNS on IPv4")
+	} else {
+		r.conns = append(r.conns, c)
+	}
+	if c, err := listen6(ifaces); err != nil {
+		r.log.Debug().Err(err).Msg("Error listening multicast DNS on IPv6")
+	} else {
+		r.conns = append(r.conns, c)
+	}
+	if len(r.conns) == 0 {
+		cancel()
+		return nil, errors.New("error listening multicast DNS")
+	}
+
+	for _, c := range r.conns {
+		r.wg.Add(1)
+		go r.serve(c)
+	}
+
+	names := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		names = append(names, iface.Name)
+	}
+	r.log.Info().Strs("interfaces", names).Bool("services", r.services).Msg("Multicast DNS started")
+
+	return r, nil
+}
+
+// Add probes a hostname, answered as <hostname>.local, and announces it if no
+// other host uses it.
+func (r *Responder) Add(hostname string) {
+	hostname = strings.ToLower(hostname)
+
+	r.mtx.Lock()
+	_, ok := r.hosts[hostname]
+	_, probing := r.probing[hostname]
+	conflict := make(chan struct{})
+	if !ok && !probing {
+		r.probing[hostname] = conflict
+	}
+	r.mtx.Unlock()
+	if ok || probing {
+		return
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if !r.probe(hostname, conflict) {
+			return
+		}
+
+		r.log.Info().Str("hostname", hostname+".local").Msg("Multicast DNS hostname added")
+
+		for i := range announceCount {
+			if i > 0 {
+				select {
+				case <-r.ctx.Done():
+					return
+				case <-time.After(announceInterval):
+				}
+			}
+
+			r.mtx.RLock()
+			_, ok := r.hosts[hostname]
+			r.mtx.RUnlock()
+			if !ok {
+				return
+			}
+			r.announce(hostname, r.ttl)
+		}
+	}()
+}
+
+// probe sends the probe queries of a hostname (RFC 6762 section 8.1), and adds
+// it to the hostnames if no other host answered for it.
+// Returns false if the hostname wasn't added.
+func (r *Responder) probe(hostname string, conflict chan struct{}) bool {
+	delay := rand.N(probeInterval)
+wait:
+	for i := range probeCount + 1 {
+		select {
+		case <-r.ctx.Done():
+			return false
+		case <-conflict:
+			break wait
+		case <-time.After(delay):
+		}
+		delay = probeInterval
+
+		if i < probeCount {
+			r.sendProbe(hostname)
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	// removed while probing
+	if r.probing[hostname] != conflict {
+		return false
+	}
+	delete(r.probing, hostname)
+
+	select {
+	case <-conflict:
+		r.log.Warn().Str("hostname", hostname+".local").Msg("Multicast DNS hostname used by another host, not announced")
+		return false
+	default:
+	}
+
+	r.hosts[hostname] = struct{}{}
+	return true
+}
+
+// Remove removes a hostname, and announces that its records are withdrawn.
+func (r *Responder) Remove(hostname string) {
+	hostname = strings.ToLower(hostname)
+
+	r.mtx.Lock()
+	_, ok := r.hosts[hostname]
+	delete(r.hosts, hostname)
+	delete(r.probing, hostname)
+	r.mtx.Unlock()
+	if !ok {
+		return
+	}
+
+	r.announce(hostname, 0)
+	r.log.Info().Str("hostname", hostname+".local").Msg("Multicast DNS hostname removed")
+}
+
+// Close withdraws all the hostnames and stops the Responder.
+func (r *Responder) Close() error {
+	r.cancel()
+
+	r.mtx.Lock()
+	hosts := make([]string, 0, len(r.hosts))
+	for host := range r.hosts {
+		hosts = append(hosts, host)
+	}
+	r.hosts = make(map[string]struct{})
+	r.mtx.Unlock()
+
+	for _, host := range hosts {
+		r.announce(host, 0)
+	}
+
+	var err error
+	for _, c := range r.conns {
+		err = errors.Join(err, c.close())
+	}
+	r.wg.Wait()
+
+	return err
+}
+
+// serve answers the queries received on a conn until it's closed.
+func (r *Responder) serve(c conn) {
+	defer r.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, ifIndex, src, err := c.read(buf)
+		if err != nil {
+			if r.ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				r.log.Error().Err(err).Msg("Error reading multicast DNS")
+			}
+			return
+		}
+		if !r.hasInterface(ifIndex) {
+			continue
+		}
+
+		var query dns.Msg
+		if err := query.Unpack(buf[:n]); err != nil {
+			r.log.Trace().Err(err).Msg("Invalid multicast DNS packet")
+			continue
+		}
+		if query.Opcode != dns.OpcodeQuery {
+			continue
+		}
+		if query.Response {
+			r.checkConflicts(&query)
+			continue
+		}
+
+		r.respond(c, &query, ifIndex, src)
+	}
+}
+
+// respond sends the answers of a query, if there are any.
+func (r *Responder) respond(c conn, query *dns.Msg, ifIndex int, src net.Addr) {
+	resp := new(dns.Msg)
+	resp.Response = true
+	resp.Authoritative = true
+
+	unicast := false
+	for _, q := range query.Question {
+		if q.Qclass&qClassUnicast != 0 {
+			unicast = true
+		}
+		answer, extra := r.answer(q, ifIndex)
+		resp.Answer = appendUnique(resp.Answer, answer...)
+		resp.Extra = appendUnique(resp.Extra, extra...)
+	}
+	if len(resp.Answer) == 0 {
+		return
+	}
+	resp.Extra = slices.DeleteFunc(resp.Extra, func(rr dns.RR) bool {
+		return slices.ContainsFunc(resp.Answer, func(a dns.RR) bool { return dns.IsDuplicate(a, rr) })
+	})
+
+	dst := c.group()
+	if udp, ok := src.(*net.UDPAddr); ok && udp.Port != mdnsPort {
+		// legacy unicast queries are answered like unicast DNS
+		resp.Id = query.Id
+		resp.Question = query.Question
+		for _, rr := range slices.Concat(resp.Answer, resp.Extra) {
+			rr.Header().Class &^= classCacheFlush
+			rr.Header().Ttl = min(rr.Header().Ttl, legacyTTL)
+		}
+		dst = src
+	} else if unicast {
+		dst = src
+	}
+
+	r.log.Trace().Str("question", query.Question[0].String()).Int("answers", len(resp.Answer)).Msg("Multicast DNS answer")
+	r.send(c, resp, ifIndex, dst)
+}
+
+// announce sends the records of a hostname on all interfaces. A ttl of zero
+// withdraws the records.
+func (r *Responder) announce(hostname string, ttl uint32) {
+	for _, iface := range r.ifaces {
+		resp := new(dns.Msg)
+		resp.Response = true
+		resp.Authoritative = true
+		resp.Answer = r.hostRecords(hostname, iface.Index, ttl, dns.TypeANY)
+		if r.services {
+			resp.Answer = append(resp.Answer, r.serviceRecords(hostname, ttl)...)
+		}
+		if len(resp.Answer) == 0 {
+			continue
+		}
+
+		for _, c := range r.conns {
+			r.send(c, resp, iface.Index, c.group())
+		}
+	}
+}
+
+// sendProbe sends a probe query of a hostname on all interfaces, with the
+// proposed records in the authority section.
+func (r *Responder) sendProbe(hostname string) {
+	for _, iface := range r.ifaces {
+		query := new(dns.Msg)
+		query.Question = []dns.Question{{
+			Name:   hostname + "." + localDomain,
+			Qtype:  dns.TypeANY,
+			Qclass: dns.ClassINET | qClassUnicast,
+		}}
+		query.Ns = r.hostRecords(hostname, iface.Index, r.ttl, dns.TypeANY)
+		if len(query.Ns) == 0 {
+			continue
+		}
+		// the cache flush bit is only set in answers
+		for _, rr := range query.Ns {
+			rr.Header().Class &^= classCacheFlush
+		}
+
+		for _, c := range r.conns {
+			r.send(c, query, iface.Index, c.group())
+		}
+	}
+}
+
+// checkConflicts signals the hostnames being probed that are answered by
+// another host in a response.
+func (r *Responder) checkConflicts(resp *dns.Msg) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if len(r.probing) == 0 {
+		return
+	}
+
+	for _, rr := range slices.Concat(resp.Answer, resp.Extra) {
+		host, ok := strings.CutSuffix(strings.ToLower(rr.Header().Name), "."+localDomain)
+		if !ok {
+			continue
+		}
+		conflict, ok := r.probing[host]
+		// withdrawn records and our own records aren't conflicts
+		if !ok || rr.Header().Ttl == 0 || r.isOwnRecord(rr) {
+			continue
+		}
+
+		select {
+		case <-conflict:
+		default:
+			close(conflict)
+		}
+	}
+}
+
+func (r *Responder) send(c conn, msg *dns.Msg, ifIndex int, dst net.Addr) {
+	b, err := msg.Pack()
+	if err != nil {
+		r.log.Error().Err(err).Msg("Error packing multicast DNS message")
+		return
+	}
+
+	if err := c.write(b, ifIndex, dst); err != nil {
+		r.log.Debug().Err(err).Int("interface", ifIndex).Str("dst", dst.String()).Msg("Error sending multicast DNS message")
+	}
+}
+
+// isOwnRecord returns true if rr is an address record with an address of the
+// Responder.
+func (r *Responder) isOwnRecord(rr dns.RR) bool {
+	var ip net.IP
+	switch rr := rr.(type) {
+	case *dns.A:
+		ip = rr.A
+	case *dns.AAAA:
+		ip = rr.AAAA
+	default:
+		return false
+	}
+
+	return slices.ContainsFunc(r.addresses(0), ip.Equal)
+}
+
+func (r *Responder) hasInterface(ifIndex int) bool {
+	return ifIndex == 0 || slices.ContainsFunc(r.ifaces, func(iface net.Interface) bool {
+		return iface.Index == ifIndex
+	})
+}
+
+// multicastInterfaces returns the running multicast interfaces, filtered by
+// names if set.
+func multicastInterfaces(names []string) ([]net.Interface, error) {
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("error listing network interfaces: %w", err)
+	}
+
+	var ifaces []net.Interface
+	for _, iface := range all {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if len(names) > 0 && !slices.Contains(names, iface.Name) {
+			continue
+		}
+		ifaces = append(ifaces, iface)
+	}
+	if len(ifaces) == 0 {
+		return nil, errNoInterfaces
+	}
+
+	return ifaces, nil
+}
+
+func isAlreadyJoined(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
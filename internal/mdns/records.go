@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package mdns
+
+import (
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// qClassUnicast is the bit of the question class that asks for a unicast
+	// answer, and classCacheFlush the bit of the record class that replaces
+	// the cached records of the same name and type.
+	qClassUnicast   = 1 << 15
+	classCacheFlush = 1 << 15
+
+	localDomain  = "local."
+	serviceType  = "_https._tcp.local."
+	servicesEnum = "_services._dns-sd._udp.local."
+)
+
+// answer returns the answers and additional records of a question, with the
+// addresses of the interface it was received on.
+func (r *Responder) answer(q dns.Question, ifIndex int) ([]dns.RR, []dns.RR) {
+	name := strings.ToLower(q.Name)
+	qtype := q.Qtype
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	// <hostname>.local
+	if host, ok := strings.CutSuffix(name, "."+localDomain); ok && r.hasHost(host) {
+		if qtype != dns.TypeA && qtype != dns.TypeAAAA && qtype != dns.TypeANY {
+			return nil, nil
+		}
+		answer := r.hostRecords(host, ifIndex, r.ttl, qtype)
+		var extra []dns.RR
+		if qtype != dns.TypeANY {
+			extra = slices.DeleteFunc(r.hostRecords(host, ifIndex, r.ttl, dns.TypeANY), func(rr dns.RR) bool {
+				return rr.Header().Rrtype == qtype
+			})
+		}
+		return answer, extra
+	}
+
+	if !r.services || len(r.hosts) == 0 {
+		return nil, nil
+	}
+
+	switch {
+	case name == servicesEnum && (qtype == dns.TypePTR || qtype == dns.TypeANY):
+		return []dns.RR{&dns.PTR{
+			Hdr: dns.RR_Header{Name: servicesEnum, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: r.ttl},
+			Ptr: serviceType,
+		}}, nil
+
+	case name == serviceType && (qtype == dns.TypePTR || qtype == dns.TypeANY):
+		var answer, extra []dns.RR
+		for _, host := range r.sortedHosts() {
+			records := r.serviceRecords(host, r.ttl)
+			answer = append(answer, records[0])
+			extra = append(extra, records[1:]...)
+			extra = append(extra, r.hostRecords(host, ifIndex, r.ttl, dns.TypeANY)...)
+		}
+		return answer, extra
+
+	default:
+		host, ok := strings.CutSuffix(name, "."+serviceType)
+		if !ok || !r.hasHost(host) {
+			return nil, nil
+		}
+		var answer []dns.RR
+		for _, rr := range r.serviceRecords(host, r.ttl)[1:] {
+			if qtype == dns.TypeANY || rr.Header().Rrtype == qtype {
+				answer = append(answer, rr)
+			}
+		}
+		if len(answer) == 0 {
+			return nil, nil
+		}
+		return answer, r.hostRecords(host, ifIndex, r.ttl, dns.TypeANY)
+	}
+}
+
+// hostRecords returns the address records of a hostname of type qtype, A,
+// AAAA or ANY, with the addresses of an interface, or of all interfaces if
+// ifIndex is zero.
+func (r *Responder) hostRecords(host string, ifIndex int, ttl uint32, qtype uint16) []dns.RR {
+	name := host + "." + localDomain
+
+	var records []dns.RR
+	for _, ip := range r.addresses(ifIndex) {
+		hdr := dns.RR_Header{Name: name, Class: dns.ClassINET | classCacheFlush, Ttl: ttl}
+
+		if ip4 := ip.To4(); ip4 != nil {
+			if qtype == dns.TypeA || qtype == dns.TypeANY {
+				hdr.Rrtype = dns.TypeA
+				records = append(records, &dns.A{Hdr: hdr, A: ip4})
+			}
+			continue
+		}
+		if qtype == dns.TypeAAAA || qtype == dns.TypeANY {
+			hdr.Rrtype = dns.TypeAAAA
+			records = append(records, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+
+	return records
+}
+
+// serviceRecords returns the DNS-SD records of a hostname: the PTR record of
+// the service type, and the SRV and TXT records of the service instance.
+func (r *Responder) serviceRecords(host string, ttl uint32) []dns.RR {
+	instance := host + "." + serviceType
+
+	return []dns.RR{
+		&dns.PTR{
+			Hdr: dns.RR_Header{Name: serviceType, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl},
+			Ptr: instance,
+		},
+		&dns.SRV{
+			Hdr:    dns.RR_Header{Name: instance, Rrtype: dns.TypeSRV, Class: dns.ClassINET | classCacheFlush, Ttl: ttl},
+			Port:   r.port,
+			Target: host + "." + localDomain,
+		},
+		&dns.TXT{
+			Hdr: dns.RR_Header{Name: instance, Rrtype: dns.TypeTXT, Class: dns.ClassINET | classCacheFlush, Ttl: ttl},
+			Txt: []string{"path=/"},
+		},
+	}
+}
+
+// addresses returns the addresses of an interface, or of all interfaces if
+// ifIndex is zero.
+func (r *Responder) addresses(ifIndex int) []net.IP {
+	var ips []net.IP
+	for _, iface := range r.ifaces {
+		if ifIndex != 0 && iface.Index != ifIndex {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLoopback() {
+				continue
+			}
+			// IPv6 link-local addresses need a zone, that clients don't know
+			if ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			if r.bindIP != nil && !r.bindIP.Equal(ipNet.IP) {
+				continue
+			}
+			ips = append(ips, ipNet.IP)
+		}
+	}
+
+	return ips
+}
+
+func (r *Responder) hasHost(host string) bool {
+	_, ok := r.hosts[host]
+	return ok
+}
+
+func (r *Responder) sortedHosts() []string {
+	hosts := make([]string, 0, len(r.hosts))
+	for host := range r.hosts {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+
+	return hosts
+}
+
+// appendUnique appends the records that aren't in records yet.
+func appendUnique(records []dns.RR, rrs ...dns.RR) []dns.RR {
+	for _, rr := range rrs {
+		if !slices.ContainsFunc(records, func(a dns.RR) bool { return dns.IsDuplicate(a, rr) }) {
+			records = append(records, rr)
+		}
+	}
+
+	return records
+}
@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+// Package metrics exports the Prometheus metrics of TSDProxy.
+package metrics
+
+import (
+	"github.com/almeidapaulopt/tsdproxy/internal/core"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry stores the metrics exported by the metrics endpoint.
+var Registry = prometheus.NewRegistry()
+
+// Factory creates metrics registered in Registry.
+var Factory = promauto.With(Registry)
+
+// AddRoutes adds the metrics endpoint.
+func AddRoutes(http *core.HTTPServer) {
+	http.Get("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package model
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+type (
+	// Access stores the allow and deny rules of a proxy or port.
+	//
+	// Rules match the Tailscale identity of the client:
+	//   - "user:<login>" or "<login>" matches the login name, wildcards are
+	//     allowed (ex: "*@example.com")
+	//   - "tag:<name>" matches a node tag
+	//   - "node:<name>" matches the node name, wildcards are allowed
+	//   - "*" matches everyone
+	//
+	// Deny rules take precedence. If there are allow rules, only clients that
+	// match one of them are allowed. Clients without a Tailscale identity,
+	// like LAN and Funnel clients, are denied if there are any rules.
+	Access struct {
+		Allow []string `validate:"dive,required" yaml:"allow,omitempty"`
+		Deny  []string `validate:"dive,required" yaml:"deny,omitempty"`
+	}
+)
+
+const (
+	AccessRuleUser = "user:"
+	AccessRuleTag  = "tag:"
+	AccessRuleNode = "node:"
+	AccessRuleAll  = "*"
+)
+
+// IsEmpty returns true if there are no rules.
+func (a Access) IsEmpty() bool {
+	return len(a.Allow) == 0 && len(a.Deny) == 0
+}
+
+// Allowed returns true if the client is allowed by the rules.
+func (a Access) Allowed(who Whois) bool {
+	if a.IsEmpty() {
+		return true
+	}
+
+	// clients without identity can't be matched by deny rules
+	if !identified(who) {
+		return false
+	}
+
+	for _, rule := range a.Deny {
+		if matchAccessRule(rule, who) {
+			return false
+		}
+	}
+
+	if len(a.Allow) == 0 {
+		return true
+	}
+
+	for _, rule := range a.Allow {
+		if matchAccessRule(rule, who) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// identified returns true if the client has a Tailscale identity.
+func identified(who Whois) bool {
+	return who.ID != "" || who.Username != "" || who.NodeName != "" || len(who.Tags) > 0
+}
+
+func matchAccessRule(rule string, who Whois) bool {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+
+	switch {
+	case rule == AccessRuleAll:
+		return true
+	case strings.HasPrefix(rule, AccessRuleTag):
+		return slices.ContainsFunc(who.Tags, func(tag string) bool {
+			return strings.EqualFold(tag, rule)
+		})
+	case strings.HasPrefix(rule, AccessRuleNode):
+		name := strings.ToLower(strings.TrimSuffix(who.NodeName, "."))
+		pattern := strings.TrimPrefix(rule, AccessRuleNode)
+		// match the full name or only the machine name
+		shortName, _, _ := strings.Cut(name, ".")
+		return matchPattern(pattern, name) || matchPattern(pattern, shortName)
+	default:
+		return matchPattern(strings.TrimPrefix(rule, AccessRuleUser), strings.ToLower(who.Username))
+	}
+}
+
+func matchPattern(pattern, value string) bool {
+	if value == "" {
+		return false
+	}
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
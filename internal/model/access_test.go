@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package model
+
+import "testing"
+
+func TestAccessAllowed(t *testing.T) {
+	alice := Whois{ID: "1", Username: "alice@example.com", NodeName: "laptop.tailnet.ts.net."}
+	server := Whois{ID: "2", NodeName: "server.tailnet.ts.net.", Tags: []string{"tag:server"}}
+	anonymous := Whois{}
+
+	tests := []struct {
+		name   string
+		access Access
+		who    Whois
+		want   bool
+	}{
+		{
+			name: "no rules",
+			who:  anonymous,
+			want: true,
+		},
+		{
+			name:   "client without identity",
+			access: Access{Allow: []string{"*"}},
+			who:    anonymous,
+		},
+		{
+			name:   "user",
+			access: Access{Allow: []string{"user:alice@example.com"}},
+			who:    alice,
+			want:   true,
+		},
+		{
+			name:   "user without prefix",
+			access: Access{Allow: []string{"Alice@Example.com"}},
+			who:    alice,
+			want:   true,
+		},
+		{
+			name:   "user pattern",
+			access: Access{Allow: []string{"user:*@example.com"}},
+			who:    alice,
+			want:   true,
+		},
+		{
+			name:   "other user",
+			access: Access{Allow: []string{"user:bob@example.com"}},
+			who:    alice,
+		},
+		{
+			name:   "tag",
+			access: Access{Allow: []string{"tag:server"}},
+			who:    server,
+			want:   true,
+		},
+		{
+			name:   "tag is case insensitive",
+			access: Access{Allow: []string{"TAG:Server"}},
+			who:    server,
+			want:   true,
+		},
+		{
+			name:   "machine name",
+			access: Access{Allow: []string{"node:laptop"}},
+			who:    alice,
+			want:   true,
+		},
+		{
+			name:   "full node name",
+			access: Access{Allow: []string{"node:laptop.tailnet.ts.net"}},
+			who:    alice,
+			want:   true,
+		},
+		{
+			name:   "node pattern",
+			access: Access{Allow: []string{"node:serv*"}},
+			who:    alice,
+		},
+		{
+			name:   "deny only",
+			access: Access{Deny: []string{"tag:server"}},
+			who:    alice,
+			want:   true,
+		},
+		{
+			name:   "deny wins over allow",
+			access: Access{Allow: []string{"*"}, Deny: []string{"tag:server"}},
+			who:    server,
+		},
+		{
+			name:   "invalid pattern",
+			access: Access{Allow: []string{"user:[alice"}},
+			who:    alice,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.access.Allowed(tt.who); got != tt.want {
+				t.Errorf("got allowed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@
 
 package model
 
+import "time"
+
 const (
 	// Default values to proxyconfig
 	//
@@ -17,6 +19,25 @@ const (
 	DefaultTailscaleFunnel       = false
 	DefaultTailscaleControlURL   = ""
 
+	// Load balancer defaults
+	DefaultLoadBalancerMethod = LoadBalancerRoundRobin
+	DefaultStickyCookieName   = "tsdproxy_sticky"
+
+	// Health check defaults
+	DefaultHealthCheckPath               = "/"
+	DefaultHealthCheckInterval           = 10 * time.Second
+	DefaultHealthCheckTimeout            = 2 * time.Second
+	DefaultHealthCheckHealthyThreshold   = 2
+	DefaultHealthCheckUnhealthyThreshold = 3
+
+	// Rate limit defaults
+	DefaultRateLimitKey    = RateLimitUser
+	DefaultRateLimitPeriod = time.Second
+
+	// UDP defaults
+	DefaultUDPIdleTimeout = time.Minute
+	DefaultUDPMaxSessions = 1024
+
 	// Dashboard defauts
 	DefaultDashboardVisible = true
 	DefaultDashboardIcon    = "tsdproxy"
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type (
@@ -20,11 +21,89 @@ type (
 		TLSValidate   bool          `validate:"boolean" yaml:"tlsValidate"`
 		IsRedirect    bool          `validate:"boolean" yaml:"isRedirect"`
 		Tailscale     TailscalePort `validate:"dive" yaml:"tailscale"`
+		LoadBalancer  LoadBalancer  `validate:"dive" yaml:"loadBalancer"`
+		HealthCheck   HealthCheck   `validate:"dive" yaml:"healthCheck"`
+		IdleTimeout   time.Duration `validate:"min=0" yaml:"idleTimeout"`
+		MaxSessions   int           `validate:"min=0" yaml:"maxSessions"`
+		ProxyHeader   ProxyHeader   `validate:"dive" yaml:"proxyHeader"`
+		Access        Access        `validate:"dive" yaml:"access"`
+		Routes        []Route       `validate:"dive" yaml:"routes"`
+		Headers       Headers       `validate:"dive" yaml:"headers"`
+		RateLimit     RateLimit     `validate:"dive" yaml:"rateLimit"`
 	}
 
 	TailscalePort struct {
 		Funnel bool `validate:"boolean" yaml:"funnel"`
 	}
+
+	// LoadBalancer stores how requests are distributed across the targets of a port.
+	LoadBalancer struct {
+		Method     string `validate:"omitempty,oneof=round_robin least_conn random" yaml:"method,omitempty"`
+		CookieName string `validate:"omitempty" yaml:"cookieName,omitempty"`
+		Weights    []int  `validate:"dive,min=1" yaml:"weights,omitempty"`
+		Sticky     bool   `validate:"boolean" yaml:"sticky,omitempty"`
+	}
+
+	// ProxyHeader stores the HAProxy PROXY protocol header sent to upstreams.
+	// No header is sent when Version is 0.
+	ProxyHeader struct {
+		Version      int  `validate:"oneof=0 1 2" yaml:"version,omitempty"`
+		TailscaleTLV bool `validate:"boolean" yaml:"tailscaleTLV,omitempty"`
+	}
+
+	// Headers stores the rules to rewrite the headers of the requests sent
+	// to the targets and of the responses sent back to the clients.
+	Headers struct {
+		Request  HeaderRules `validate:"dive" yaml:"request,omitempty"`
+		Response HeaderRules `validate:"dive" yaml:"response,omitempty"`
+	}
+
+	// HeaderRules stores the headers to set, add and remove.
+	// Values of set and add are text/template templates, with .User (Whois)
+	// and .Request (*http.Request) as data.
+	HeaderRules struct {
+		Set    map[string]string `validate:"dive,keys,required,endkeys" yaml:"set,omitempty"`
+		Add    map[string]string `validate:"dive,keys,required,endkeys" yaml:"add,omitempty"`
+		Remove []string          `validate:"dive,required" yaml:"remove,omitempty"`
+	}
+
+	// RateLimit stores the token bucket rate limit of a port.
+	// Rate limits are disabled when Requests is 0.
+	RateLimit struct {
+		Key      string        `validate:"omitempty,oneof=user ip global" yaml:"key,omitempty"`
+		Requests int           `validate:"min=0" yaml:"requests,omitempty"`
+		Period   time.Duration `validate:"min=0" yaml:"period,omitempty"`
+		Burst    int           `validate:"min=0" yaml:"burst,omitempty"`
+	}
+
+	// HealthCheck stores the active health check of the targets of a port.
+	// Health checks are disabled when Type is empty.
+	HealthCheck struct {
+		Type               string        `validate:"omitempty,oneof=http tcp" yaml:"type,omitempty"`
+		Path               string        `validate:"omitempty" yaml:"path,omitempty"`
+		Interval           time.Duration `validate:"min=0" yaml:"interval,omitempty"`
+		Timeout            time.Duration `validate:"min=0" yaml:"timeout,omitempty"`
+		HealthyThreshold   int           `validate:"min=0" yaml:"healthyThreshold,omitempty"`
+		UnhealthyThreshold int           `validate:"min=0" yaml:"unhealthyThreshold,omitempty"`
+	}
+)
+
+const (
+	ProtocolHTTP  = "http"
+	ProtocolHTTPS = "https"
+	ProtocolTCP   = "tcp"
+	ProtocolUDP   = "udp"
+
+	LoadBalancerRoundRobin = "round_robin"
+	LoadBalancerLeastConn  = "least_conn"
+	LoadBalancerRandom     = "random"
+
+	HealthCheckHTTP = "http"
+	HealthCheckTCP  = "tcp"
+
+	RateLimitUser   = "user"
+	RateLimitIP     = "ip"
+	RateLimitGlobal = "global"
 )
 
 const (
@@ -44,6 +123,8 @@ var (
 // The input string `s` must follow one of these formats:
 // 1. "<proxy port>/<proxy protocol>:<target port>/<target protocol>"
 //   - Example: "443/https:80/http"
+//   - Example: "5432/tcp:5432/tcp" proxies raw tcp connections.
+//   - Example: "53/udp:53/udp" forwards udp packets.
 //
 // 2. "<proxy port>:<target port>"
 //   - Example: "443:80"
@@ -107,6 +188,11 @@ func (p *PortConfig) String() string {
 	return p.name
 }
 
+// IsHTTP returns true if the port proxies http or https requests.
+func (p *PortConfig) IsHTTP() bool {
+	return p.ProxyProtocol == ProtocolHTTP || p.ProxyProtocol == ProtocolHTTPS
+}
+
 // defaultPortConfig initializes a PortConfig with default values.
 func defaultPortConfig(name string) PortConfig {
 	return PortConfig{
@@ -114,6 +200,11 @@ func defaultPortConfig(name string) PortConfig {
 		ProxyProtocol: "https",
 		ProxyPort:     443, //nolint:mnd
 		IsRedirect:    false,
+		LoadBalancer: LoadBalancer{
+			Method:     DefaultLoadBalancerMethod,
+			CookieName: DefaultStickyCookieName,
+		},
+		HealthCheck: DefaultHealthCheck(""),
 	}
 }
 
@@ -194,6 +285,82 @@ func (p *PortConfig) GetFirstTarget() *url.URL {
 	return &url.URL{}
 }
 
+// DefaultHealthCheck returns a HealthCheck of the given type with default values.
+func DefaultHealthCheck(checkType string) HealthCheck {
+	return HealthCheck{
+		Type:               checkType,
+		Path:               DefaultHealthCheckPath,
+		Interval:           DefaultHealthCheckInterval,
+		Timeout:            DefaultHealthCheckTimeout,
+		HealthyThreshold:   DefaultHealthCheckHealthyThreshold,
+		UnhealthyThreshold: DefaultHealthCheckUnhealthyThreshold,
+	}
+}
+
+// WithDefaults returns a copy of the HealthCheck with unset values replaced by defaults.
+func (h HealthCheck) WithDefaults() HealthCheck {
+	d := DefaultHealthCheck(h.Type)
+	if h.Path == "" {
+		h.Path = d.Path
+	}
+	if h.Interval <= 0 {
+		h.Interval = d.Interval
+	}
+	if h.Timeout <= 0 {
+		h.Timeout = d.Timeout
+	}
+	if h.HealthyThreshold <= 0 {
+		h.HealthyThreshold = d.HealthyThreshold
+	}
+	if h.UnhealthyThreshold <= 0 {
+		h.UnhealthyThreshold = d.UnhealthyThreshold
+	}
+	return h
+}
+
+// ParseRateLimit parses a rate in the "<requests>/<period>" format and
+// returns a RateLimit with the default key and burst.
+//
+// Examples: "10/s", "100/1m", "5/30s"
+func ParseRateLimit(s string) (RateLimit, error) {
+	rl := RateLimit{Key: DefaultRateLimitKey}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return rl, fmt.Errorf("invalid rate limit %q, expected '<requests>/<period>'", s)
+	}
+
+	var err error
+	if rl.Requests, err = strconv.Atoi(strings.TrimSpace(requests)); err != nil || rl.Requests < 0 {
+		return rl, fmt.Errorf("invalid rate limit requests %q", requests)
+	}
+
+	period = strings.TrimSpace(period)
+	// allow units without value, ex: 10/s
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	if rl.Period, err = time.ParseDuration(period); err != nil || rl.Period <= 0 {
+		return rl, fmt.Errorf("invalid rate limit period %q", period)
+	}
+
+	return rl, nil
+}
+
+// IsEmpty returns true if there are no rules.
+func (h *HeaderRules) IsEmpty() bool {
+	return len(h.Set) == 0 && len(h.Add) == 0 && len(h.Remove) == 0
+}
+
+// GetTargetWeight returns the weight of the target at index i.
+// Targets without a configured weight default to 1.
+func (l *LoadBalancer) GetTargetWeight(i int) int {
+	if i < len(l.Weights) && l.Weights[i] > 0 {
+		return l.Weights[i]
+	}
+	return 1
+}
+
 func (p *PortConfig) AddTarget(target *url.URL) {
 	p.targets = append(p.targets, target)
 }
@@ -207,3 +374,11 @@ func (p *PortConfig) ReplaceTarget(origin, target *url.URL) {
 		}
 	}
 }
+
+// WithoutTargets returns a copy of the port configuration without targets
+// and target weights, to compare the settings that don't depend on them.
+func (p PortConfig) WithoutTargets() PortConfig {
+	p.targets = nil
+	p.LoadBalancer.Weights = nil
+	return p
+}
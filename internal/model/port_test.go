@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    RateLimit
+		wantErr bool
+	}{
+		{
+			name:  "requests per second",
+			value: "10/1s",
+			want:  RateLimit{Key: DefaultRateLimitKey, Requests: 10, Period: time.Second},
+		},
+		{
+			name:  "unit without value",
+			value: "100/m",
+			want:  RateLimit{Key: DefaultRateLimitKey, Requests: 100, Period: time.Minute},
+		},
+		{
+			name:  "longer period",
+			value: "5/30s",
+			want:  RateLimit{Key: DefaultRateLimitKey, Requests: 5, Period: 30 * time.Second},
+		},
+		{
+			name:  "spaces",
+			value: " 20 / h ",
+			want:  RateLimit{Key: DefaultRateLimitKey, Requests: 20, Period: time.Hour},
+		},
+		{
+			name:  "zero requests",
+			value: "0/s",
+			want:  RateLimit{Key: DefaultRateLimitKey, Requests: 0, Period: time.Second},
+		},
+		{
+			name:    "missing period",
+			value:   "10",
+			wantErr: true,
+		},
+		{
+			name:    "empty period",
+			value:   "10/",
+			wantErr: true,
+		},
+		{
+			name:    "invalid requests",
+			value:   "ten/s",
+			wantErr: true,
+		},
+		{
+			name:    "negative requests",
+			value:   "-1/s",
+			wantErr: true,
+		},
+		{
+			name:    "invalid unit",
+			value:   "10/day",
+			wantErr: true,
+		},
+		{
+			name:    "zero period",
+			value:   "10/0s",
+			wantErr: true,
+		},
+		{
+			name:    "negative period",
+			value:   "10/-1s",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRateLimit(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got rate limit %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ type (
 		Hostname       string
 		Dashboard      Dashboard `validate:"dive"`
 		Tailscale      Tailscale `validate:"dive"`
+		Access         Access    `validate:"dive"`
 		ProxyAccessLog bool      `default:"true" validate:"boolean"`
 	}
 
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+type (
+	// Route sends the requests of a port that match the path prefix, and
+	// optionally the methods and headers, to its own targets.
+	Route struct {
+		Name          string            `yaml:"name,omitempty"`
+		Path          string            `validate:"required,startswith=/" yaml:"path"`
+		Methods       []string          `yaml:"methods,omitempty"`
+		Headers       map[string]string `validate:"dive,keys,required,endkeys" yaml:"headers,omitempty"`
+		ReplacePrefix string            `validate:"omitempty,startswith=/" yaml:"replacePrefix,omitempty"`
+		targets       []*url.URL
+		StripPrefix   bool `validate:"boolean" yaml:"stripPrefix,omitempty"`
+	}
+)
+
+const routeSeparator = "->"
+
+var ErrInvalidRouteConfig = errors.New("invalid route configuration, expected '<path> -> <target>'")
+
+// NewRouteLabel parses a route configuration string and returns a Route struct.
+//
+// The input string `s` must follow the format "<path> -> <target>", where
+// target is a URL or "<target port>/<target protocol>".
+//
+// Examples:
+// 1. "/api -> 8080/http" -> Path="/api", Target=http://0.0.0.0:8080
+// 2. "/api -> http://api:8080" -> Path="/api", Target=http://api:8080
+func NewRouteLabel(name, s string) (Route, error) {
+	route := Route{Name: name}
+
+	path, target, ok := strings.Cut(s, routeSeparator)
+	if !ok {
+		return route, ErrInvalidRouteConfig
+	}
+
+	route.Path = strings.TrimSpace(path)
+	if !strings.HasPrefix(route.Path, "/") {
+		return route, fmt.Errorf("invalid route path: %q", route.Path)
+	}
+
+	target = strings.TrimSpace(target)
+	if targetURL, err := url.Parse(target); err == nil && targetURL.Scheme != "" && targetURL.Host != "" {
+		route.AddTarget(targetURL)
+		return route, nil
+	}
+
+	var port PortConfig
+	if err := parseTargetSegment(target, &port); err != nil {
+		return route, err
+	}
+	route.targets = port.targets
+
+	return route, nil
+}
+
+func (r *Route) GetTargets() []*url.URL {
+	return r.targets
+}
+
+func (r *Route) AddTarget(target *url.URL) {
+	r.targets = append(r.targets, target)
+}
+
+// ReplaceTarget replaces a target URL with a new one.
+func (r *Route) ReplaceTarget(origin, target *url.URL) {
+	for k, v := range r.targets {
+		if v.String() == origin.String() {
+			r.targets[k] = target
+		}
+	}
+}
+
+// MatchPath returns true if the path is equal to the route path or is inside it.
+func (r *Route) MatchPath(path string) bool {
+	prefix := strings.TrimSuffix(r.Path, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Match returns true if the request matches the route path, methods and headers.
+func (r *Route) Match(req *http.Request) bool {
+	if !r.MatchPath(req.URL.Path) {
+		return false
+	}
+
+	if len(r.Methods) > 0 && !slices.ContainsFunc(r.Methods, func(m string) bool {
+		return strings.EqualFold(m, req.Method)
+	}) {
+		return false
+	}
+
+	for name, value := range r.Headers {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RewritePath returns the path to be sent to the targets, with the route
+// prefix stripped or replaced.
+func (r *Route) RewritePath(path string) string {
+	if !r.StripPrefix && r.ReplacePrefix == "" {
+		return path
+	}
+
+	rest := strings.TrimPrefix(path, strings.TrimSuffix(r.Path, "/"))
+	prefix := strings.TrimSuffix(r.ReplacePrefix, "/")
+
+	path = prefix + rest
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
@@ -2,14 +2,60 @@
 // SPDX-License-Identifier: MIT
 package model
 
+import "time"
+
 type (
 	ProxyStatus int
 
+	// PortStatus is the lifecycle state of a proxy port.
+	PortStatus int
+
+	// ProxyEvent is a change of a proxy or, if Port is set, of one of its ports.
 	ProxyEvent struct {
 		ID      string
 		Port    string
 		AuthURL string
-		Status  ProxyStatus
+		// Reason describes why the status changed.
+		Reason string
+		// Error is the error that caused the status change.
+		Error     string
+		Targets   []TargetHealth
+		PortState PortState
+		Retry     RetryState
+		Status    ProxyStatus
+	}
+
+	// StatusTransition is an entry of the status history of a proxy.
+	// Port is set on transitions of a port of the proxy.
+	StatusTransition struct {
+		Time   time.Time `json:"time"`
+		Port   string    `json:"port,omitempty"`
+		Status string    `json:"status"`
+		Reason string    `json:"reason,omitempty"`
+		Error  string    `json:"error,omitempty"`
+	}
+
+	// RetryState stores the retries of a proxy that failed to start.
+	RetryState struct {
+		// NextRetry is the time of the next retry, zero if there are no more retries.
+		NextRetry time.Time
+		LastError string
+		Attempt   int
+	}
+
+	// PortState stores the state of a proxy port.
+	PortState struct {
+		// Addr is the address of the port listener.
+		Addr string
+		// Error is the last error of the port.
+		Error  string
+		Status PortStatus
+	}
+
+	// TargetHealth stores the health state of a port target.
+	TargetHealth struct {
+		URL     string
+		Healthy bool
 	}
 )
 
@@ -23,6 +69,13 @@ const (
 	ProxyStatusError
 )
 
+const (
+	PortStatusStarting PortStatus = iota
+	PortStatusListening
+	PortStatusStopped
+	PortStatusError
+)
+
 var proxyStatusStrings = []string{
 	"Initializing",
 	"Starting",
@@ -36,3 +89,14 @@ var proxyStatusStrings = []string{
 func (s *ProxyStatus) String() string {
 	return proxyStatusStrings[int(*s)]
 }
+
+var portStatusStrings = []string{
+	"Starting",
+	"Listening",
+	"Stopped",
+	"Error",
+}
+
+func (s PortStatus) String() string {
+	return portStatusStrings[int(s)]
+}
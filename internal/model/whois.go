@@ -11,6 +11,8 @@ type (
 		DisplayName   string
 		Username      string
 		ProfilePicURL string
+		NodeName      string
+		Tags          []string
 	}
 )
 
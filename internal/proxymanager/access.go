@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"net/http"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+	"github.com/almeidapaulopt/tsdproxy/internal/ui"
+	"github.com/almeidapaulopt/tsdproxy/internal/ui/pages"
+
+	"github.com/rs/zerolog"
+)
+
+// accessControl checks the access rules of a proxy and of its port.
+// A client must be allowed by all the rules.
+// A nil accessControl allows everyone.
+type accessControl struct {
+	hostname string
+	rules    []model.Access
+}
+
+func newAccessControl(hostname string, rules ...model.Access) *accessControl {
+	ac := &accessControl{hostname: hostname}
+	for _, r := range rules {
+		if !r.IsEmpty() {
+			ac.rules = append(ac.rules, r)
+		}
+	}
+
+	if len(ac.rules) == 0 {
+		return nil
+	}
+	return ac
+}
+
+// allowed returns true if the client is allowed to access the port.
+func (ac *accessControl) allowed(who model.Whois) bool {
+	if ac == nil {
+		return true
+	}
+
+	for _, r := range ac.rules {
+		if !r.Allowed(who) {
+			return false
+		}
+	}
+	return true
+}
+
+// middleware answers with 403 Forbidden to requests from clients that aren't allowed.
+func (ac *accessControl) middleware(log zerolog.Logger, next http.Handler) http.Handler {
+	if ac == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		who, _ := model.WhoisFromContext(r.Context())
+		if !ac.allowed(who) {
+			log.Info().
+				Str("username", who.Username).
+				Str("node", who.NodeName).
+				Str("client", r.RemoteAddr).
+				Str("path", r.URL.RequestURI()).
+				Msg("access denied")
+
+			if err := ui.RenderTemplStatus(w, r, http.StatusForbidden, pages.Forbidden(ac.hostname, who.Username)); err != nil {
+				log.Error().Err(err).Msg("error rendering forbidden page")
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/accesslog"
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+type (
+	accessLogEntryKey struct{}
+
+	// bodyCounter counts the bytes read from a request body.
+	bodyCounter struct {
+		io.ReadCloser
+		n atomic.Int64
+	}
+)
+
+// accessLogMiddleware writes an access log entry of each request.
+// Returns next if logger is nil.
+func accessLogMiddleware(logger accesslog.Logger, proxy, port string, next http.Handler) http.Handler {
+	if logger == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		entry := &accesslog.Entry{
+			Time:      start,
+			Proxy:     proxy,
+			Port:      port,
+			Client:    r.RemoteAddr,
+			Method:    r.Method,
+			Host:      r.Host,
+			URI:       r.URL.RequestURI(),
+			Proto:     r.Proto,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		}
+		if who, ok := model.WhoisFromContext(r.Context()); ok {
+			entry.User = who.Username
+			entry.DisplayName = who.DisplayName
+			entry.Node = who.NodeName
+		}
+
+		var body *bodyCounter
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &bodyCounter{ReadCloser: r.Body}
+			r.Body = body
+		}
+
+		rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), accessLogEntryKey{}, entry)))
+
+		entry.Status = rw.status
+		entry.BytesOut = int64(rw.size)
+		entry.Latency = time.Since(start)
+		if body != nil {
+			entry.BytesIn = body.n.Load()
+		}
+
+		logger.Log(entry)
+	})
+}
+
+// connectionLogEntry returns the access log entry of a TCP connection or UDP
+// session of a client, started at start.
+func connectionLogEntry(stats *portMetrics, proto, client string, who model.Whois, start time.Time) *accesslog.Entry {
+	return &accesslog.Entry{
+		Time:        start,
+		Proxy:       stats.proxy,
+		Port:        stats.port,
+		Client:      client,
+		User:        who.Username,
+		DisplayName: who.DisplayName,
+		Node:        who.NodeName,
+		Proto:       proto,
+	}
+}
+
+// setAccessLogTarget records the upstream target in the access log entry of the request.
+func setAccessLogTarget(ctx context.Context, target string) {
+	if entry, ok := ctx.Value(accessLogEntryKey{}).(*accesslog.Entry); ok {
+		entry.Target = target
+	}
+}
+
+func (b *bodyCounter) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
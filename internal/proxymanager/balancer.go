@@ -0,0 +1,283 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+type (
+	// upstream is a single target of a port.
+	upstream struct {
+		url     *url.URL
+		id      string
+		weight  int
+		active  atomic.Int64
+		healthy atomic.Bool
+		// removed is set when the target is removed from the port
+		removed atomic.Bool
+	}
+
+	// balancer distributes requests across the upstreams of a port.
+	balancer struct {
+		upstreams []*upstream
+		settings  balancerSettings
+		next      atomic.Uint64
+		mtx       sync.RWMutex
+	}
+
+	// balancerSettings are the load balancer settings of a port, with the
+	// defaults applied.
+	balancerSettings struct {
+		method     string
+		cookieName string
+		sticky     bool
+	}
+
+	upstreamContextKey struct{}
+)
+
+func newBalancer(pconfig model.PortConfig) *balancer {
+	return newTargetsBalancer(pconfig.LoadBalancer, pconfig.GetTargets())
+}
+
+// newTargetsBalancer returns a balancer of the targets with the cfg method.
+func newTargetsBalancer(cfg model.LoadBalancer, targets []*url.URL) *balancer {
+	lb := &balancer{
+		settings: newBalancerSettings(cfg),
+	}
+
+	for i, target := range targets {
+		lb.upstreams = append(lb.upstreams, newUpstream(target, cfg.GetTargetWeight(i)))
+	}
+
+	return lb
+}
+
+func newBalancerSettings(cfg model.LoadBalancer) balancerSettings {
+	settings := balancerSettings{
+		method:     cfg.Method,
+		sticky:     cfg.Sticky,
+		cookieName: cfg.CookieName,
+	}
+
+	if settings.method == "" {
+		settings.method = model.DefaultLoadBalancerMethod
+	}
+	if settings.cookieName == "" {
+		settings.cookieName = model.DefaultStickyCookieName
+	}
+
+	return settings
+}
+
+func newUpstream(target *url.URL, weight int) *upstream {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(target.String()))
+
+	u := &upstream{
+		url:    target,
+		id:     strconv.FormatUint(uint64(h.Sum32()), 36), //nolint:mnd
+		weight: weight,
+	}
+	// upstreams are healthy until a health check says otherwise
+	u.healthy.Store(true)
+
+	return u
+}
+
+// middleware selects the upstream for each request and stores it in the request context.
+func (lb *balancer) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := lb.getSettings()
+		u, fromCookie := lb.pick(r, settings)
+		if u == nil {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		u.active.Add(1)
+		defer u.active.Add(-1)
+
+		if settings.sticky && !fromCookie {
+			http.SetCookie(w, &http.Cookie{
+				Name:     settings.cookieName,
+				Value:    u.id,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), upstreamContextKey{}, u)))
+	})
+}
+
+// pick returns the upstream to be used by the request and whether it was
+// selected from the sticky session cookie.
+func (lb *balancer) pick(r *http.Request, settings balancerSettings) (*upstream, bool) {
+	if settings.sticky {
+		if cookie, err := r.Cookie(settings.cookieName); err == nil {
+			for _, u := range lb.list() {
+				if u.id == cookie.Value && u.healthy.Load() {
+					return u, true
+				}
+			}
+		}
+	}
+
+	return lb.choose(), false
+}
+
+// choose returns the next healthy upstream according to the balancing method.
+func (lb *balancer) choose() *upstream {
+	switch lb.getSettings().method {
+	case model.LoadBalancerLeastConn:
+		return lb.pickLeastConn()
+	case model.LoadBalancerRandom:
+		return lb.pickRandom()
+	default:
+		return lb.pickRoundRobin()
+	}
+}
+
+func (lb *balancer) pickRoundRobin() *upstream {
+	upstreams := lb.list()
+	count := uint64(len(upstreams))
+	for range count {
+		n := lb.next.Add(1) - 1
+		if u := upstreams[n%count]; u.healthy.Load() {
+			return u
+		}
+	}
+	return nil
+}
+
+func (lb *balancer) pickLeastConn() *upstream {
+	var selected *upstream
+	for _, u := range lb.list() {
+		if !u.healthy.Load() {
+			continue
+		}
+		if selected == nil || u.active.Load() < selected.active.Load() {
+			selected = u
+		}
+	}
+	return selected
+}
+
+func (lb *balancer) pickRandom() *upstream {
+	upstreams := lb.list()
+	total := 0
+	for _, u := range upstreams {
+		if u.healthy.Load() {
+			total += u.weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	n := rand.IntN(total) //nolint:gosec
+	for _, u := range upstreams {
+		if !u.healthy.Load() {
+			continue
+		}
+		if n < u.weight {
+			return u
+		}
+		n -= u.weight
+	}
+	return nil
+}
+
+// health returns the health state of all upstreams.
+func (lb *balancer) health() []model.TargetHealth {
+	upstreams := lb.list()
+	health := make([]model.TargetHealth, 0, len(upstreams))
+	for _, u := range upstreams {
+		health = append(health, model.TargetHealth{
+			URL:     u.url.String(),
+			Healthy: u.healthy.Load(),
+		})
+	}
+	return health
+}
+
+// getSettings returns the current load balancer settings.
+func (lb *balancer) getSettings() balancerSettings {
+	lb.mtx.RLock()
+	defer lb.mtx.RUnlock()
+
+	return lb.settings
+}
+
+// list returns the current upstreams.
+func (lb *balancer) list() []*upstream {
+	lb.mtx.RLock()
+	defer lb.mtx.RUnlock()
+
+	return lb.upstreams
+}
+
+// setTargets replaces the upstreams with the targets, and applies the cfg
+// settings. Upstreams of unchanged targets are kept with their health state
+// and active requests.
+// Returns the upstreams that were added.
+func (lb *balancer) setTargets(cfg model.LoadBalancer, targets []*url.URL) []*upstream {
+	lb.mtx.Lock()
+	defer lb.mtx.Unlock()
+
+	current := make(map[string]*upstream, len(lb.upstreams))
+	for _, u := range lb.upstreams {
+		current[u.url.String()] = u
+	}
+
+	upstreams := make([]*upstream, 0, len(targets))
+	var added []*upstream
+	for i, target := range targets {
+		weight := cfg.GetTargetWeight(i)
+		if u, ok := current[target.String()]; ok && u.weight == weight {
+			delete(current, target.String())
+			upstreams = append(upstreams, u)
+			continue
+		}
+
+		u := newUpstream(target, weight)
+		added = append(added, u)
+		upstreams = append(upstreams, u)
+	}
+
+	for _, u := range current {
+		u.removed.Store(true)
+	}
+	lb.upstreams = upstreams
+	lb.settings = newBalancerSettings(cfg)
+
+	return added
+}
+
+// upstreamFromContext returns the upstream selected for the request.
+func upstreamFromContext(ctx context.Context) (*upstream, bool) {
+	u, ok := ctx.Value(upstreamContextKey{}).(*upstream)
+	return u, ok
+}
+
+// targetString returns the target URL selected for the request, for logging.
+func targetString(ctx context.Context) string {
+	if u, ok := upstreamFromContext(ctx); ok {
+		return u.url.String()
+	}
+	return ""
+}
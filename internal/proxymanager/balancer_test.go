@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+// testTargets returns the URLs of the targets.
+func testTargets(targets ...string) []*url.URL {
+	urls := make([]*url.URL, 0, len(targets))
+	for _, target := range targets {
+		u, _ := url.Parse(target)
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+func TestBalancer(t *testing.T) {
+	targets := []string{"http://a:8080", "http://b:8080", "http://c:8080"}
+
+	tests := []struct {
+		name      string
+		cfg       model.LoadBalancer
+		unhealthy []int
+		active    []int64
+		// cookie is the index of the target of the sticky cookie, -1 for none
+		cookie     int
+		requests   int
+		want       []string
+		wantCookie bool
+	}{
+		{
+			name:     "round robin is the default",
+			cookie:   -1,
+			requests: 4,
+			want:     []string{"http://a:8080", "http://b:8080", "http://c:8080", "http://a:8080"},
+		},
+		{
+			name:      "round robin skips unhealthy targets",
+			cfg:       model.LoadBalancer{Method: model.LoadBalancerRoundRobin},
+			unhealthy: []int{1},
+			cookie:    -1,
+			requests:  3,
+			want:      []string{"http://a:8080", "http://c:8080", "http://a:8080"},
+		},
+		{
+			name:     "least connections",
+			cfg:      model.LoadBalancer{Method: model.LoadBalancerLeastConn},
+			active:   []int64{3, 1, 2},
+			cookie:   -1,
+			requests: 2,
+			want:     []string{"http://b:8080", "http://b:8080"},
+		},
+		{
+			name:      "random picks healthy targets",
+			cfg:       model.LoadBalancer{Method: model.LoadBalancerRandom, Weights: []int{5, 1, 5}},
+			unhealthy: []int{0, 2},
+			cookie:    -1,
+			requests:  3,
+			want:      []string{"http://b:8080", "http://b:8080", "http://b:8080"},
+		},
+		{
+			name:      "no healthy target",
+			unhealthy: []int{0, 1, 2},
+			cookie:    -1,
+			requests:  1,
+			want:      []string{""},
+		},
+		{
+			name:       "sticky sets the cookie",
+			cfg:        model.LoadBalancer{Sticky: true},
+			cookie:     -1,
+			requests:   1,
+			want:       []string{"http://a:8080"},
+			wantCookie: true,
+		},
+		{
+			name:     "sticky cookie selects the target",
+			cfg:      model.LoadBalancer{Sticky: true},
+			cookie:   2,
+			requests: 3,
+			want:     []string{"http://c:8080", "http://c:8080", "http://c:8080"},
+		},
+		{
+			name:       "sticky cookie of an unhealthy target",
+			cfg:        model.LoadBalancer{Sticky: true},
+			unhealthy:  []int{2},
+			cookie:     2,
+			requests:   1,
+			want:       []string{"http://a:8080"},
+			wantCookie: true,
+		},
+		{
+			name:     "cookie is ignored without sticky",
+			cookie:   2,
+			requests: 1,
+			want:     []string{"http://a:8080"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := newTargetsBalancer(tt.cfg, testTargets(targets...))
+			upstreams := lb.list()
+			for _, i := range tt.unhealthy {
+				upstreams[i].healthy.Store(false)
+			}
+			for i, n := range tt.active {
+				upstreams[i].active.Store(n)
+			}
+
+			var got []string
+			var gotCookie bool
+			for range tt.requests {
+				var target string
+				next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+					if u, ok := upstreamFromContext(r.Context()); ok {
+						target = u.url.String()
+					}
+				})
+
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				if tt.cookie >= 0 {
+					req.AddCookie(&http.Cookie{Name: model.DefaultStickyCookieName, Value: upstreams[tt.cookie].id})
+				}
+				rec := httptest.NewRecorder()
+				lb.middleware(next).ServeHTTP(rec, req)
+
+				if target == "" && rec.Code != http.StatusServiceUnavailable {
+					t.Errorf("got status %d without target, want %d", rec.Code, http.StatusServiceUnavailable)
+				}
+				got = append(got, target)
+				gotCookie = gotCookie || len(rec.Result().Cookies()) > 0
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got targets %v, want %v", got, tt.want)
+			}
+			if gotCookie != tt.wantCookie {
+				t.Errorf("got cookie %v, want %v", gotCookie, tt.wantCookie)
+			}
+		})
+	}
+}
+
+func TestBalancerSetTargets(t *testing.T) {
+	lb := newTargetsBalancer(model.LoadBalancer{Weights: []int{2, 1}}, testTargets("http://a:8080", "http://b:8080"))
+	old := lb.list()
+
+	added := lb.setTargets(model.LoadBalancer{
+		Method:     model.LoadBalancerLeastConn,
+		Sticky:     true,
+		CookieName: "backend",
+		Weights:    []int{2, 3},
+	}, testTargets("http://a:8080", "http://b:8080", "http://c:8080"))
+
+	upstreams := lb.list()
+	if upstreams[0] != old[0] {
+		t.Error("unchanged target was replaced")
+	}
+	if !old[1].removed.Load() {
+		t.Error("target with a changed weight wasn't replaced")
+	}
+	if len(added) != 2 || added[0].url.String() != "http://b:8080" || added[1].url.String() != "http://c:8080" {
+		t.Errorf("got added upstreams %v, want b and c", added)
+	}
+
+	var weights []int
+	for _, u := range upstreams {
+		weights = append(weights, u.weight)
+	}
+	if want := []int{2, 3, 1}; !slices.Equal(weights, want) {
+		t.Errorf("got weights %v, want %v", weights, want)
+	}
+
+	want := balancerSettings{method: model.LoadBalancerLeastConn, cookieName: "backend", sticky: true}
+	if got := lb.getSettings(); got != want {
+		t.Errorf("got settings %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,283 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+// Hostname collision policies.
+const (
+	// CollisionReject doesn't start the proxy of the new target.
+	CollisionReject = "reject"
+	// CollisionSuffix starts the new target with the target provider name
+	// added to the hostname.
+	CollisionSuffix = "suffix"
+	// CollisionFirstWins keeps the new target waiting until the hostname
+	// is released by the first one.
+	CollisionFirstWins = "firstWins"
+)
+
+// collisionReportsSize is the number of collisions reported for each hostname.
+const collisionReportsSize = 10
+
+// hostnameCollisions stores the state of the hostname collisions.
+type hostnameCollisions struct {
+	// renamed stores the hostnames given to targets by the suffix policy
+	renamed map[string]string
+	// waiting stores the targets waiting for a hostname by the firstWins policy
+	waiting map[string][]*model.Config
+	// reports stores the collisions reported on each hostname
+	reports map[string][]string
+	mtx     sync.Mutex
+}
+
+func newHostnameCollisions() *hostnameCollisions {
+	return &hostnameCollisions{
+		renamed: make(map[string]string),
+		waiting: make(map[string][]*model.Config),
+		reports: make(map[string][]string),
+	}
+}
+
+// startTarget starts the proxy of a target, resolving the hostname collisions
+// with the configured policy.
+func (pm *ProxyManager) startTarget(pcfg *model.Config) {
+	pm.startTargetWithPolicy(pcfg, config.Config.Load().HostnameCollision)
+}
+
+// startTargetWithPolicy starts the proxy of a target, resolving the hostname
+// collisions with policy.
+func (pm *ProxyManager) startTargetWithPolicy(pcfg *model.Config, policy string) {
+	pm.startMtx.Lock()
+	defer pm.startMtx.Unlock()
+
+	if hostname, ok := pm.collisions.renamedHostname(pcfg); ok {
+		pcfg.Hostname = hostname
+	}
+
+	existing, ok := pm.GetProxy(pcfg.Hostname)
+	if ok && sameTarget(existing.GetConfig(), pcfg) {
+		// the target was started again
+		pm.removeProxy(pcfg.Hostname, "target started again")
+		ok = false
+	}
+	if !ok {
+		pm.newAndStartProxy(pcfg.Hostname, pcfg)
+		return
+	}
+
+	hostname := pcfg.Hostname
+	switch policy {
+	case CollisionSuffix:
+		pcfg.Hostname = pm.suffixHostname(pcfg)
+		pm.collisions.rename(pcfg, pcfg.Hostname)
+		pm.reportCollision(existing, pcfg, hostname, policy, "renamed to "+pcfg.Hostname)
+		pm.newAndStartProxy(pcfg.Hostname, pcfg)
+
+	case CollisionFirstWins:
+		pm.collisions.wait(pcfg)
+		pm.reportCollision(existing, pcfg, hostname, policy, "waiting for the hostname")
+
+	default:
+		pm.reportCollision(existing, pcfg, hostname, policy, "rejected")
+		// the target provider doesn't need to track a target without proxy
+		if provider, ok := pm.getTargetProvider(pcfg.TargetProvider); ok {
+			_ = provider.DeleteProxy(pcfg.TargetID)
+		}
+	}
+}
+
+// releaseHostname starts the first target waiting for the hostname.
+func (pm *ProxyManager) releaseHostname(hostname string) {
+	if pcfg := pm.collisions.next(hostname); pcfg != nil {
+		pm.log.Info().Str("proxy", hostname).Str("targetID", pcfg.TargetID).Msg("Starting target waiting for hostname")
+		pm.startTarget(pcfg)
+	}
+}
+
+// reportCollision reports a hostname collision in the logs and in the status
+// events and history of the proxies.
+func (pm *ProxyManager) reportCollision(existing *Proxy, pcfg *model.Config, hostname, policy, resolution string) {
+	existingCfg := existing.GetConfig()
+	msg := fmt.Sprintf("target %s of %s uses the hostname %s of target %s of %s, %s",
+		pcfg.TargetID, pcfg.TargetProvider, hostname,
+		existingCfg.TargetID, existingCfg.TargetProvider, resolution)
+
+	pm.log.Warn().
+		Str("proxy", hostname).
+		Str("targetID", pcfg.TargetID).
+		Str("targetProvider", pcfg.TargetProvider).
+		Str("policy", policy).
+		Msg("Hostname collision: " + msg)
+
+	pm.collisions.report(hostname, msg)
+	if pcfg.Hostname != hostname {
+		pm.collisions.report(pcfg.Hostname, msg)
+	}
+
+	event := model.ProxyEvent{
+		ID:     hostname,
+		Status: existing.GetStatus(),
+		Reason: "hostname collision",
+		Error:  msg,
+	}
+	pm.history.record(event)
+	pm.broadcastStatusEvents(event)
+}
+
+// suffixHostname returns a free hostname for the target with the target
+// provider name as suffix.
+func (pm *ProxyManager) suffixHostname(pcfg *model.Config) string {
+	base := pcfg.Hostname + "-" + pcfg.TargetProvider
+
+	hostname := base
+	for i := 2; ; i++ {
+		if _, ok := pm.GetProxy(hostname); !ok {
+			return hostname
+		}
+		hostname = base + "-" + strconv.Itoa(i)
+	}
+}
+
+// GetCollisions returns the hostname collisions reported on a proxy.
+func (pm *ProxyManager) GetCollisions(hostname string) []string {
+	return pm.collisions.get(hostname)
+}
+
+// sameTarget returns true if both configurations are of the same target.
+func sameTarget(a, b *model.Config) bool {
+	return a.TargetID == b.TargetID && a.TargetProvider == b.TargetProvider
+}
+
+func collisionKey(pcfg *model.Config) string {
+	return pcfg.TargetProvider + "/" + pcfg.TargetID
+}
+
+// renamedHostname returns the hostname given to the target by the suffix policy.
+func (c *hostnameCollisions) renamedHostname(pcfg *model.Config) (string, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	hostname, ok := c.renamed[collisionKey(pcfg)]
+	return hostname, ok
+}
+
+func (c *hostnameCollisions) rename(pcfg *model.Config, hostname string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.renamed[collisionKey(pcfg)] = hostname
+}
+
+// wait adds the target to the targets waiting for its hostname.
+// A target already waiting keeps its place with the new configuration.
+func (c *hostnameCollisions) wait(pcfg *model.Config) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for i, waiting := range c.waiting[pcfg.Hostname] {
+		if sameTarget(waiting, pcfg) {
+			c.waiting[pcfg.Hostname][i] = pcfg
+			return
+		}
+	}
+	c.waiting[pcfg.Hostname] = append(c.waiting[pcfg.Hostname], pcfg)
+}
+
+// next removes and returns the first target waiting for the hostname.
+func (c *hostnameCollisions) next(hostname string) *model.Config {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	waiting := c.waiting[hostname]
+	if len(waiting) == 0 {
+		return nil
+	}
+
+	if len(waiting) == 1 {
+		delete(c.waiting, hostname)
+	} else {
+		c.waiting[hostname] = waiting[1:]
+	}
+	return waiting[0]
+}
+
+// forget removes the state of a stopped target.
+// Returns true if the target was waiting for a hostname.
+func (c *hostnameCollisions) forget(targetProvider, targetID string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.renamed, targetProvider+"/"+targetID)
+
+	for hostname, waiting := range c.waiting {
+		for i, pcfg := range waiting {
+			if pcfg.TargetProvider == targetProvider && pcfg.TargetID == targetID {
+				c.waiting[hostname] = append(waiting[:i:i], waiting[i+1:]...)
+				if len(c.waiting[hostname]) == 0 {
+					delete(c.waiting, hostname)
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forgetProvider removes the state of the targets of a removed target provider.
+func (c *hostnameCollisions) forgetProvider(targetProvider string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for key := range c.renamed {
+		if strings.HasPrefix(key, targetProvider+"/") {
+			delete(c.renamed, key)
+		}
+	}
+
+	for hostname, waiting := range c.waiting {
+		waiting = slices.DeleteFunc(waiting, func(pcfg *model.Config) bool {
+			return pcfg.TargetProvider == targetProvider
+		})
+		if len(waiting) == 0 {
+			delete(c.waiting, hostname)
+		} else {
+			c.waiting[hostname] = waiting
+		}
+	}
+}
+
+func (c *hostnameCollisions) report(hostname, msg string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	reports := append(c.reports[hostname], msg)
+	if len(reports) > collisionReportsSize {
+		reports = reports[len(reports)-collisionReportsSize:]
+	}
+	c.reports[hostname] = reports
+}
+
+func (c *hostnameCollisions) get(hostname string) []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return append([]string(nil), c.reports[hostname]...)
+}
+
+// clear removes the collisions reported on a hostname.
+func (c *hostnameCollisions) clear(hostname string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.reports, hostname)
+}
@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/rs/zerolog"
+)
+
+func TestHostnameCollisions(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		// want are the target IDs of the proxies by hostname
+		want        map[string]string
+		wantWaiting []string
+		// wantAfterRelease are the target IDs of the proxies after the first
+		// target is removed
+		wantAfterRelease map[string]string
+	}{
+		{
+			name:             "reject",
+			policy:           CollisionReject,
+			want:             map[string]string{"app": "first"},
+			wantAfterRelease: map[string]string{},
+		},
+		{
+			name:             "suffix",
+			policy:           CollisionSuffix,
+			want:             map[string]string{"app": "first", "app-other": "second"},
+			wantAfterRelease: map[string]string{"app-other": "second"},
+		},
+		{
+			name:             "first wins",
+			policy:           CollisionFirstWins,
+			want:             map[string]string{"app": "first"},
+			wantWaiting:      []string{"second"},
+			wantAfterRelease: map[string]string{"app": "second"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := NewProxyManager(zerolog.Nop())
+			pm.supervisor = newSupervisor(zerolog.Nop(), config.RetryConfig{}, nil)
+			pm.ProxyProviders["test"] = newTestProvider()
+			defer func() {
+				for _, proxy := range pm.Proxies {
+					proxy.Close("test")
+				}
+			}()
+
+			first := testConfig(t, nil)
+			first.ProxyProvider = "test"
+			first.TargetID = "first"
+			second := testConfig(t, nil)
+			second.ProxyProvider = "test"
+			second.TargetProvider = "other"
+			second.TargetID = "second"
+
+			pm.startTargetWithPolicy(first, tt.policy)
+			pm.startTargetWithPolicy(second, tt.policy)
+
+			if got := targetIDs(pm); !maps.Equal(got, tt.want) {
+				t.Errorf("got proxies %v, want %v", got, tt.want)
+			}
+			if got := pm.GetCollisions("app"); len(got) != 1 {
+				t.Errorf("got collisions %q, want one", got)
+			}
+
+			var waiting []string
+			pm.collisions.mtx.Lock()
+			for _, pcfg := range pm.collisions.waiting["app"] {
+				waiting = append(waiting, pcfg.TargetID)
+			}
+			pm.collisions.mtx.Unlock()
+			if !slices.Equal(waiting, tt.wantWaiting) {
+				t.Errorf("got waiting targets %v, want %v", waiting, tt.wantWaiting)
+			}
+
+			// the first waiting target is started when the hostname is released
+			proxy, _ := pm.GetProxy("app")
+			pm.mtx.Lock()
+			delete(pm.Proxies, "app")
+			pm.mtx.Unlock()
+			proxy.Close("test")
+			if next := pm.collisions.next("app"); next != nil {
+				pm.startTargetWithPolicy(next, tt.policy)
+			}
+
+			if got := targetIDs(pm); !maps.Equal(got, tt.wantAfterRelease) {
+				t.Errorf("got proxies %v after release, want %v", got, tt.wantAfterRelease)
+			}
+		})
+	}
+}
+
+// targetIDs returns the target IDs of the proxies by hostname.
+func targetIDs(pm *ProxyManager) map[string]string {
+	pm.mtx.RLock()
+	defer pm.mtx.RUnlock()
+
+	ids := make(map[string]string, len(pm.Proxies))
+	for hostname, proxy := range pm.Proxies {
+		ids[hostname] = proxy.GetConfig().TargetID
+	}
+	return ids
+}
+
+func TestSameTargetStartedAgain(t *testing.T) {
+	pm := NewProxyManager(zerolog.Nop())
+	pm.supervisor = newSupervisor(zerolog.Nop(), config.RetryConfig{}, nil)
+	pm.ProxyProviders["test"] = newTestProvider()
+
+	pcfg := testConfig(t, nil)
+	pcfg.ProxyProvider = "test"
+	pm.startTargetWithPolicy(pcfg, CollisionReject)
+
+	again := testConfig(t, model.PortConfigList{"443/https": testPort(t, "443/https", "http://app:8080")})
+	again.ProxyProvider = "test"
+	pm.startTargetWithPolicy(again, CollisionReject)
+
+	proxy, ok := pm.GetProxy("app")
+	if !ok {
+		t.Fatal("proxy of the target started again not found")
+	}
+	defer proxy.Close("test")
+
+	if len(proxy.GetConfig().Ports) != 1 {
+		t.Error("proxy wasn't replaced by the target started again")
+	}
+	if got := pm.GetCollisions("app"); len(got) != 0 {
+		t.Errorf("got collisions %q, want none", got)
+	}
+}
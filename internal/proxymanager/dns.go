@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"errors"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+	"github.com/almeidapaulopt/tsdproxy/internal/dnsserver"
+)
+
+// startDNSServer starts the DNS server, that answers the names of the proxies
+// registered on the LAN listener.
+func (pm *ProxyManager) startDNSServer() error {
+	change, err := pm.prepareDNSServer()
+	if err != nil {
+		return err
+	}
+	change.apply()
+
+	return nil
+}
+
+// prepareDNSServer prepares the DNS server of the current configuration,
+// without changing the running one. Applying it starts, reconfigures or stops
+// the DNS server.
+func (pm *ProxyManager) prepareDNSServer() (listenerChange, error) {
+	cfg := config.Config.Load()
+
+	pm.mtx.RLock()
+	ds := pm.dnsServer
+	pm.mtx.RUnlock()
+
+	switch {
+	case !cfg.DNS.Enabled:
+		return listenerChange{
+			apply: func() {
+				if err := pm.stopDNSServer(closedContext()); err != nil {
+					pm.log.Error().Err(err).Msg("Error stopping DNS server")
+				}
+			},
+			abort: func() {},
+		}, nil
+
+	case !cfg.LAN.Enabled:
+		return listenerChange{}, errors.New("the DNS server requires the LAN listener")
+
+	case ds != nil:
+		update, err := ds.Prepare(cfg.DNS, cfg.LAN.Hostname)
+		if err != nil {
+			return listenerChange{}, err
+		}
+		return listenerChange{apply: update.Apply, abort: update.Abort}, nil
+	}
+
+	ds, err := dnsserver.New(pm.log, cfg.DNS, cfg.LAN.Hostname)
+	if err != nil {
+		return listenerChange{}, err
+	}
+	if err := ds.Start(); err != nil {
+		return listenerChange{}, err
+	}
+
+	return listenerChange{
+		apply: func() {
+			pm.mtx.Lock()
+			pm.dnsServer = ds
+			pm.mtx.Unlock()
+
+			for _, proxy := range pm.proxies() {
+				pm.registerLANProxy(proxy)
+			}
+		},
+		abort: func() {
+			if err := ds.Close(closedContext()); err != nil {
+				pm.log.Debug().Err(err).Msg("Error stopping DNS server")
+			}
+		},
+	}, nil
+}
+
+// stopDNSServer stops the DNS server, waiting for the active queries until
+// ctx is done.
+func (pm *ProxyManager) stopDNSServer(ctx context.Context) error {
+	pm.mtx.Lock()
+	ds := pm.dnsServer
+	pm.dnsServer = nil
+	pm.mtx.Unlock()
+
+	if ds == nil {
+		return nil
+	}
+
+	return ds.Close(ctx)
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// drainPollInterval is the interval to check if the active requests and UDP
+// sessions finished.
+const drainPollInterval = 100 * time.Millisecond
+
+// inflight counts the active requests of a port, including upgraded
+// connections like WebSockets, that http.Server.Shutdown doesn't wait for.
+type inflight struct {
+	active atomic.Int64
+}
+
+func (f *inflight) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.active.Add(1)
+		defer f.active.Add(-1)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wait waits until there are no active requests, or ctx is done.
+func (f *inflight) wait(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if f.active.Load() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closedContext returns a done context, to close without draining.
+func closedContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	return ctx
+}
+
+// drainExpired returns true if err is the end of a drain.
+func drainExpired(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/core"
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/rs/zerolog"
+)
+
+type (
+	// headerRewriter applies the header rules of a port to requests and responses.
+	headerRewriter struct {
+		log      zerolog.Logger
+		request  headerRuleSet
+		response headerRuleSet
+	}
+
+	headerRuleSet struct {
+		set    []headerRule
+		add    []headerRule
+		remove []string
+	}
+
+	headerRule struct {
+		tmpl  *template.Template
+		name  string
+		value string
+	}
+
+	// headerResponseWriter applies the response rules before the headers
+	// are written.
+	headerResponseWriter struct {
+		http.ResponseWriter
+		rewriter *headerRewriter
+		request  *http.Request
+		applied  bool
+	}
+
+	// headerTemplateData is the data available in header value templates.
+	headerTemplateData struct {
+		Request *http.Request
+		User    model.Whois
+	}
+)
+
+// newHeaderRewriter returns a headerRewriter of the port rules.
+// Returns nil if there are no rules.
+func newHeaderRewriter(log zerolog.Logger, cfg model.Headers) *headerRewriter {
+	if cfg.Request.IsEmpty() && cfg.Response.IsEmpty() {
+		return nil
+	}
+
+	log = log.With().Str("module", "headers").Logger()
+
+	return &headerRewriter{
+		log:      log,
+		request:  newHeaderRuleSet(log, cfg.Request),
+		response: newHeaderRuleSet(log, cfg.Response),
+	}
+}
+
+func newHeaderRuleSet(log zerolog.Logger, cfg model.HeaderRules) headerRuleSet {
+	return headerRuleSet{
+		set:    newHeaderRules(log, cfg.Set),
+		add:    newHeaderRules(log, cfg.Add),
+		remove: cfg.Remove,
+	}
+}
+
+func newHeaderRules(log zerolog.Logger, values map[string]string) []headerRule {
+	rules := make([]headerRule, 0, len(values))
+	for name, value := range values {
+		rule := headerRule{name: name, value: value}
+
+		if strings.Contains(value, "{{") {
+			tmpl, err := template.New(name).Option("missingkey=zero").Parse(value)
+			if err != nil {
+				log.Error().Err(err).Str("header", name).Msg("invalid header template, header ignored")
+				continue
+			}
+			rule.tmpl = tmpl
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// rewriteRequest applies the request rules to the request sent to the target.
+func (h *headerRewriter) rewriteRequest(out *http.Request) {
+	if h == nil {
+		return
+	}
+	h.apply(out.Header, h.request, out)
+}
+
+// rewriteResponse applies the response rules to the response sent to the client.
+func (h *headerRewriter) rewriteResponse(resp *http.Response) {
+	if h == nil {
+		return
+	}
+	h.apply(resp.Header, h.response, resp.Request)
+}
+
+// middleware applies the response rules to all responses of the port,
+// including the errors of the proxy, access control and rate limits.
+func (h *headerRewriter) middleware(next http.Handler) http.Handler {
+	if h == nil || h.response.isEmpty() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&headerResponseWriter{ResponseWriter: w, rewriter: h, request: r}, r)
+	})
+}
+
+func (h *headerRewriter) apply(header http.Header, rules headerRuleSet, r *http.Request) {
+	data := headerTemplateData{Request: r}
+	if r != nil {
+		data.User, _ = model.WhoisFromContext(r.Context())
+	}
+
+	for _, name := range rules.remove {
+		header.Del(name)
+	}
+	for _, rule := range rules.set {
+		header.Set(rule.name, h.render(rule, data))
+	}
+	for _, rule := range rules.add {
+		header.Add(rule.name, h.render(rule, data))
+	}
+}
+
+func (h *headerRewriter) render(rule headerRule, data headerTemplateData) string {
+	if rule.tmpl == nil {
+		return rule.value
+	}
+
+	var b strings.Builder
+	if err := rule.tmpl.Execute(&b, data); err != nil {
+		h.log.Error().Err(err).Str("header", rule.name).Msg("error rendering header template")
+		return ""
+	}
+	return b.String()
+}
+
+func (s headerRuleSet) isEmpty() bool {
+	return len(s.set) == 0 && len(s.add) == 0 && len(s.remove) == 0
+}
+
+// rewrite applies the response rules once.
+func (w *headerResponseWriter) rewrite() {
+	if w.applied {
+		return
+	}
+	w.applied = true
+	w.rewriter.apply(w.Header(), w.rewriter.response, w.request)
+}
+
+func (w *headerResponseWriter) WriteHeader(status int) {
+	// informational responses are followed by the final response
+	if status >= http.StatusOK || status == http.StatusSwitchingProtocols {
+		w.rewrite()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerResponseWriter) Write(b []byte) (int, error) {
+	w.rewrite()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerResponseWriter) Flush() {
+	w.rewrite()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *headerResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, core.ErrHijackNotSupported
+}
+
+func (w *headerResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/rs/zerolog"
+)
+
+func TestHeaderRewriter(t *testing.T) {
+	who := model.Whois{Username: "alice@example.com", DisplayName: "Alice", Tags: []string{"tag:admin"}}
+
+	tests := []struct {
+		name   string
+		rules  model.HeaderRules
+		header http.Header
+		want   http.Header
+	}{
+		{
+			name:   "set static value",
+			rules:  model.HeaderRules{Set: map[string]string{"X-Env": "prod"}},
+			header: http.Header{"X-Env": {"dev", "test"}},
+			want:   http.Header{"X-Env": {"prod"}},
+		},
+		{
+			name:   "add keeps values",
+			rules:  model.HeaderRules{Add: map[string]string{"X-Env": "prod"}},
+			header: http.Header{"X-Env": {"dev"}},
+			want:   http.Header{"X-Env": {"dev", "prod"}},
+		},
+		{
+			name:   "remove",
+			rules:  model.HeaderRules{Remove: []string{"x-secret"}},
+			header: http.Header{"X-Secret": {"1"}, "X-Other": {"2"}},
+			want:   http.Header{"X-Other": {"2"}},
+		},
+		{
+			name:   "remove before set",
+			rules:  model.HeaderRules{Remove: []string{"X-User"}, Set: map[string]string{"X-User": "{{.User.Username}}"}},
+			header: http.Header{"X-User": {"mallory"}},
+			want:   http.Header{"X-User": {"alice@example.com"}},
+		},
+		{
+			name: "user template",
+			rules: model.HeaderRules{Set: map[string]string{
+				"X-User": "{{.User.DisplayName}} <{{.User.Username}}>",
+				"X-Tags": `{{range .User.Tags}}{{.}}{{end}}`,
+			}},
+			header: http.Header{},
+			want:   http.Header{"X-User": {"Alice <alice@example.com>"}, "X-Tags": {"tag:admin"}},
+		},
+		{
+			name:   "request template",
+			rules:  model.HeaderRules{Set: map[string]string{"X-Original-Path": "{{.Request.URL.Path}}"}},
+			header: http.Header{},
+			want:   http.Header{"X-Original-Path": {"/app/page"}},
+		},
+		{
+			name:   "invalid template is ignored",
+			rules:  model.HeaderRules{Set: map[string]string{"X-Bad": "{{.User", "X-Good": "1"}},
+			header: http.Header{},
+			want:   http.Header{"X-Good": {"1"}},
+		},
+		{
+			name:   "template error renders empty value",
+			rules:  model.HeaderRules{Set: map[string]string{"X-Bad": "{{.User.Missing}}"}},
+			header: http.Header{},
+			want:   http.Header{"X-Bad": {""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHeaderRewriter(zerolog.Nop(), model.Headers{Request: tt.rules})
+
+			req := httptest.NewRequest(http.MethodGet, "/app/page", nil)
+			req = req.WithContext(model.WhoisNewContext(req.Context(), who))
+			req.Header = tt.header
+			h.rewriteRequest(req)
+
+			if !reflect.DeepEqual(req.Header, tt.want) {
+				t.Errorf("got headers %v, want %v", req.Header, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderRewriterResponse(t *testing.T) {
+	h := newHeaderRewriter(zerolog.Nop(), model.Headers{Response: model.HeaderRules{
+		Set:    map[string]string{"X-Frame-Options": "DENY"},
+		Remove: []string{"Server"},
+	}})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Server", "upstream")
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	})
+
+	rec := httptest.NewRecorder()
+	h.middleware(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := rec.Header().Get("X-Frame-Options"); got != "DENY" {
+		t.Errorf("got X-Frame-Options %q, want DENY", got)
+	}
+	if got := rec.Header().Get("Server"); got != "" {
+		t.Errorf("got Server %q, want removed", got)
+	}
+}
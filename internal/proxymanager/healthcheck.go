@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/rs/zerolog"
+)
+
+// healthChecker actively probes the upstreams of a port and marks them
+// healthy or unhealthy according to the configured thresholds.
+type healthChecker struct {
+	log      zerolog.Logger
+	client   *http.Client
+	dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+	onChange func()
+	cfg      model.HealthCheck
+}
+
+// newHealthChecker returns a healthChecker of the port configuration.
+// Probes send the PROXY protocol header of proxyHeader, like the port
+// connections, so upstreams that require it accept them.
+func newHealthChecker(
+	log zerolog.Logger,
+	cfg model.HealthCheck,
+	tlsValidate bool,
+	proxyHeader model.ProxyHeader,
+	onChange func(),
+) *healthChecker {
+	cfg = cfg.WithDefaults()
+
+	var d net.Dialer
+	dial := d.DialContext
+	if proxyHeader.Version != 0 {
+		dial = proxyHeaderDialContext(proxyHeader)
+	}
+
+	return &healthChecker{
+		log:      log.With().Str("module", "healthcheck").Logger(),
+		cfg:      cfg,
+		dial:     dial,
+		onChange: onChange,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: !tlsValidate}, //nolint
+				DialContext:       dial,
+				DisableKeepAlives: proxyHeader.Version != 0,
+			},
+			// a redirect is a valid answer from a healthy upstream
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// start starts probing each upstream until ctx is done.
+func (hc *healthChecker) start(ctx context.Context, upstreams []*upstream) {
+	for _, u := range upstreams {
+		go hc.run(ctx, u)
+	}
+}
+
+func (hc *healthChecker) run(ctx context.Context, u *upstream) {
+	log := hc.log.With().Str("target", u.url.String()).Logger()
+
+	ticker := time.NewTicker(hc.cfg.Interval)
+	defer ticker.Stop()
+
+	successes, failures := 0, 0
+
+	for {
+		if u.removed.Load() {
+			return
+		}
+
+		err := hc.probe(ctx, u.url)
+
+		if err == nil {
+			successes++
+			failures = 0
+		} else {
+			failures++
+			successes = 0
+			log.Debug().Err(err).Int("failures", failures).Msg("health check failed")
+		}
+
+		switch {
+		case err == nil && !u.healthy.Load() && successes >= hc.cfg.HealthyThreshold:
+			u.healthy.Store(true)
+			log.Info().Msg("target is healthy")
+			hc.notify()
+		case err != nil && u.healthy.Load() && failures >= hc.cfg.UnhealthyThreshold:
+			u.healthy.Store(false)
+			log.Warn().Err(err).Msg("target is unhealthy")
+			hc.notify()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (hc *healthChecker) notify() {
+	if hc.onChange != nil {
+		hc.onChange()
+	}
+}
+
+// probe checks a target once.
+func (hc *healthChecker) probe(ctx context.Context, target *url.URL) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.cfg.Timeout)
+	defer cancel()
+
+	if hc.cfg.Type == model.HealthCheckTCP {
+		conn, err := hc.dial(ctx, "tcp", targetHostPort(target))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	probeURL := target.JoinPath(hc.cfg.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "tsdproxy-healthcheck")
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// targetHostPort returns the host:port of a target, using the scheme default port if needed.
+func targetHostPort(target *url.URL) string {
+	if target.Port() != "" {
+		return target.Host
+	}
+
+	port := "80"
+	if target.Scheme == "https" {
+		port = "443"
+	}
+
+	return net.JoinHostPort(target.Hostname(), port)
+}
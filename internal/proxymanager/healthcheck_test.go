@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/rs/zerolog"
+)
+
+func TestHealthChecker(t *testing.T) {
+	tests := []struct {
+		name      string
+		healthy   int
+		unhealthy int
+		// statuses are the status codes of the probes, the last one is
+		// repeated
+		statuses []int
+		want     []bool
+	}{
+		{
+			name:      "unhealthy after the fall threshold",
+			healthy:   1,
+			unhealthy: 2,
+			statuses:  []int{500, 200, 500, 500},
+			want:      []bool{false},
+		},
+		{
+			name:      "failures below the fall threshold",
+			healthy:   1,
+			unhealthy: 3,
+			statuses:  []int{500, 500, 200, 500, 500, 200},
+		},
+		{
+			name:      "healthy after the rise threshold",
+			healthy:   2,
+			unhealthy: 1,
+			statuses:  []int{503, 200, 503, 200, 200},
+			want:      []bool{false, true},
+		},
+		{
+			name:      "redirect is healthy",
+			healthy:   1,
+			unhealthy: 1,
+			statuses:  []int{302},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mtx     sync.Mutex
+				probes  int
+				changes []bool
+			)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mtx.Lock()
+				status := tt.statuses[min(probes, len(tt.statuses)-1)]
+				probes++
+				mtx.Unlock()
+
+				if r.URL.Path != "/health" {
+					status = http.StatusNotFound
+				}
+				w.Header().Set("Location", "/")
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+
+			target, _ := url.Parse(srv.URL)
+			u := newUpstream(target, 1)
+
+			hc := newHealthChecker(zerolog.Nop(), model.HealthCheck{
+				Path:               "/health",
+				Interval:           5 * time.Millisecond,
+				Timeout:            time.Second,
+				HealthyThreshold:   tt.healthy,
+				UnhealthyThreshold: tt.unhealthy,
+			}, false, model.ProxyHeader{}, func() {
+				mtx.Lock()
+				changes = append(changes, u.healthy.Load())
+				mtx.Unlock()
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			hc.start(ctx, []*upstream{u})
+
+			// the last status is probed a few times
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				mtx.Lock()
+				done := probes >= len(tt.statuses)+3
+				mtx.Unlock()
+				if done {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("health checker didn't probe the target")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			cancel()
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			if !slices.Equal(changes, tt.want) {
+				t.Errorf("got health changes %v, want %v", changes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+const (
+	// historySize is the number of status transitions kept for each proxy.
+	historySize = 100
+	// historyHostnames is the number of hostnames with history. The hostname
+	// with the oldest last transition is dropped when a new one is recorded.
+	historyHostnames = 1000
+)
+
+// statusHistory keeps the last status transitions of each proxy.
+// The history of a proxy is kept when it's recreated, to debug flapping proxies.
+type statusHistory struct {
+	entries map[string][]model.StatusTransition
+	mtx     sync.RWMutex
+}
+
+func newStatusHistory() *statusHistory {
+	return &statusHistory{
+		entries: make(map[string][]model.StatusTransition),
+	}
+}
+
+// record adds the transition of a proxy event to the history.
+// Port events are only recorded if the port status changed.
+func (h *statusHistory) record(event model.ProxyEvent) {
+	t := model.StatusTransition{
+		Time:   time.Now(),
+		Port:   event.Port,
+		Reason: event.Reason,
+		Error:  event.Error,
+	}
+
+	if event.Port == "" {
+		t.Status = event.Status.String()
+	} else {
+		t.Status = event.PortState.Status.String()
+		if event.PortState.Status == model.PortStatusError {
+			t.Error = event.PortState.Error
+		}
+		if event.PortState.Addr != "" && event.PortState.Status == model.PortStatusListening {
+			t.Reason = "listening on " + event.PortState.Addr
+		}
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	entries := h.entries[event.ID]
+	if event.Port != "" && h.lastPortStatus(entries, event.Port) == t.Status {
+		return
+	}
+
+	if len(entries) == 0 && len(h.entries) >= historyHostnames {
+		h.dropOldest()
+	}
+
+	entries = append(entries, t)
+	if len(entries) > historySize {
+		entries = entries[len(entries)-historySize:]
+	}
+	h.entries[event.ID] = entries
+}
+
+// get returns the history of a proxy, oldest first.
+func (h *statusHistory) get(hostname string) ([]model.StatusTransition, bool) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	entries, ok := h.entries[hostname]
+	if !ok {
+		return nil, false
+	}
+
+	return append([]model.StatusTransition(nil), entries...), true
+}
+
+// lastPortStatus returns the last recorded status of a port.
+func (h *statusHistory) lastPortStatus(entries []model.StatusTransition, port string) string {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Port == port {
+			return entries[i].Status
+		}
+	}
+	return ""
+}
+
+// dropOldest removes the history of the hostname with the oldest last transition.
+func (h *statusHistory) dropOldest() {
+	var (
+		oldest string
+		last   time.Time
+	)
+	for hostname, entries := range h.entries {
+		if t := entries[len(entries)-1].Time; oldest == "" || t.Before(last) {
+			oldest, last = hostname, t
+		}
+	}
+	delete(h.entries, oldest)
+}
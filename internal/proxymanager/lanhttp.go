@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	lanHTTPModeRedirect = "redirect"
+
+	// acmeChallengePath is the path of the ACME HTTP-01 challenges.
+	acmeChallengePath = "/.well-known/acme-challenge/"
+)
+
+// acmeTokenRegexp matches the valid ACME challenge tokens (base64url).
+var acmeTokenRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// servePlainHTTP serves the requests of the plain HTTP LAN listener.
+// Requests are redirected to the HTTPS LAN listener or served by the route,
+// except ACME challenges, that are never redirected.
+func (l *lanListener) servePlainHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := l.currentConfig()
+
+	token, isChallenge := strings.CutPrefix(r.URL.Path, acmeChallengePath)
+	if isChallenge && cfg.HTTP.ACMEChallengeDir != "" {
+		l.serveACMEChallenge(w, r, cfg.HTTP.ACMEChallengeDir, token)
+		return
+	}
+
+	host, route, ok := l.route(w, r)
+	if !ok {
+		return
+	}
+
+	if cfg.HTTP.Mode == lanHTTPModeRedirect && !isChallenge {
+		target := "https://" + host
+		if cfg.Port != 443 { //nolint:mnd
+			target = "https://" + net.JoinHostPort(host, strconv.Itoa(int(cfg.Port)))
+		}
+		http.Redirect(w, r, target+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		return
+	}
+
+	l.serveRoute(w, r, host, route, cfg.Port)
+}
+
+// serveACMEChallenge responds with the key authorization of a challenge token
+// from the ACME challenge directory.
+func (l *lanListener) serveACMEChallenge(w http.ResponseWriter, r *http.Request, dir, token string) {
+	if !acmeTokenRegexp.MatchString(token) {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, token))
+	if err != nil {
+		l.log.Debug().Err(err).Str("token", token).Msg("LANListener ACME challenge not found")
+		http.NotFound(w, r)
+		return
+	}
+
+	l.log.Debug().Str("token", token).Msg("LANListener answering ACME challenge")
+	w.Header().Set("Content-Type", "text/plain")
+	if _, err := w.Write(data); err != nil {
+		l.log.Error().Err(err).Msg("LANListener error writing ACME challenge")
+	}
+}
@@ -7,99 +7,306 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
 	"github.com/almeidapaulopt/tsdproxy/internal/core"
+	"github.com/almeidapaulopt/tsdproxy/internal/lancert"
+	"github.com/almeidapaulopt/tsdproxy/internal/mdns"
 
 	"github.com/rs/zerolog"
 )
 
 type lanRoute struct {
-	proxy   *Proxy
-	handler http.Handler
+	proxy *Proxy
+	// handlers are the handlers of the proxy by LAN port
+	handlers map[uint16]http.Handler
 }
 
 type lanListener struct {
 	log zerolog.Logger
 
-	addr string
+	server      *http.Server
+	plainServer *http.Server
+	tlsConfig   *tls.Config
 
-	server   *http.Server
-	listener net.Listener
+	// cfg is the current configuration, and ports are all the HTTPS ports
+	cfg     config.LANConfig
+	ports   []uint16
+	running bool
+
+	// certs provides the certificates, instead of the Tailscale certificates
+	certs lancert.Store
+
+	// mdns answers multicast DNS for the short hostnames, if enabled
+	mdns *mdns.Responder
+
+	listeners map[lanAddr]net.Listener
 
 	routes map[string]lanRoute
 	mtx    sync.RWMutex
 }
 
-func newLANListener(log zerolog.Logger, addr string) *lanListener {
+// lanAddr is an address of the HTTPS or the plain HTTP LAN listener.
+type lanAddr struct {
+	addr  string
+	plain bool
+}
+
+// lanChange is a configuration change of the LAN listener, prepared by
+// prepare. It's applied with apply, or discarded with abort.
+type lanChange struct {
+	l     *lanListener
+	cfg   config.LANConfig
+	ports []uint16
+	// certs is the certificate store, created if the certificates changed
+	certs    lancert.Store
+	newCerts bool
+	// listeners are the new addresses
+	listeners map[lanAddr]net.Listener
+}
+
+func newLANListener(log zerolog.Logger) *lanListener {
 	ll := &lanListener{
-		log:    log.With().Str("module", "lanlistener").Logger(),
-		addr:   addr,
-		routes: make(map[string]lanRoute),
+		log:       log.With().Str("module", "lanlistener").Logger(),
+		listeners: make(map[lanAddr]net.Listener),
+		routes:    make(map[string]lanRoute),
 	}
 
+	ll.tlsConfig = &tls.Config{ //nolint:gosec
+		GetCertificate: ll.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
 	ll.server = &http.Server{
 		Handler:           http.HandlerFunc(ll.serveHTTP),
 		ReadHeaderTimeout: core.ReadHeaderTimeout,
 	}
+	ll.plainServer = &http.Server{
+		Handler:           http.HandlerFunc(ll.servePlainHTTP),
+		ReadHeaderTimeout: core.ReadHeaderTimeout,
+	}
 
 	return ll
 }
 
-func (l *lanListener) start() error {
-	ln, err := net.Listen("tcp", l.addr)
-	if err != nil {
-		return err
+// prepare prepares a configuration change of the LAN listener. Nothing is
+// changed until it's applied, but the certificate store is created and the
+// new addresses are listened on, so a configuration that can't be applied
+// returns an error. Addresses that don't change keep their listeners.
+func (l *lanListener) prepare(cfg config.LANConfig) (*lanChange, error) {
+	l.mtx.RLock()
+	current := l.cfg
+	running := l.running
+	certs := l.certs
+	listeners := maps.Clone(l.listeners)
+	l.mtx.RUnlock()
+
+	c := &lanChange{
+		l:         l,
+		cfg:       cfg,
+		ports:     lanPorts(cfg),
+		certs:     certs,
+		listeners: make(map[lanAddr]net.Listener),
 	}
 
-	tlsLn := tls.NewListener(ln, &tls.Config{ //nolint:gosec
-		GetCertificate: l.getCertificate,
-		MinVersion:     tls.VersionTLS12,
-	})
+	if !running || !reflect.DeepEqual(current.Certificates, cfg.Certificates) {
+		store, err := lancert.New(l.log, cfg.Certificates, cfg.Domains)
+		if err != nil {
+			return nil, err
+		}
+		c.certs = store
+		c.newCerts = true
+	}
+
+	for _, addr := range lanAddrs(cfg, c.ports) {
+		if _, ok := listeners[addr]; ok {
+			continue
+		}
+
+		ln, err := net.Listen("tcp", addr.addr)
+		if err != nil {
+			c.abort()
+			return nil, err
+		}
+		if !addr.plain {
+			ln = tls.NewListener(ln, l.tlsConfig)
+		}
+		c.listeners[addr] = ln
+	}
+
+	return c, nil
+}
+
+// apply applies the configuration change. The removed addresses are closed,
+// and multicast DNS is restarted if its configuration changed. The proxies
+// must be registered again, since their handlers depend on the ports.
+func (c *lanChange) apply() {
+	l := c.l
+	addrs := lanAddrs(c.cfg, c.ports)
 
 	l.mtx.Lock()
-	l.listener = tlsLn
+	old := l.cfg
+	running := l.running
+	oldCerts := l.certs
+
+	var removed []net.Listener
+	for addr, ln := range l.listeners {
+		if !slices.Contains(addrs, addr) {
+			removed = append(removed, ln)
+			delete(l.listeners, addr)
+		}
+	}
+	maps.Copy(l.listeners, c.listeners)
+
+	l.cfg = c.cfg
+	l.ports = c.ports
+	l.certs = c.certs
+	l.running = true
+
+	responder := l.mdns
+	mdnsChanged := !running || !reflect.DeepEqual(old.MDNS, c.cfg.MDNS) ||
+		old.Hostname != c.cfg.Hostname || old.Port != c.cfg.Port
+	if mdnsChanged {
+		l.mdns = nil
+	}
 	l.mtx.Unlock()
 
-	go func() {
-		if err := l.server.Serve(tlsLn); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
-			l.log.Error().Err(err).Msg("LAN listener stopped with error")
+	for _, addr := range addrs {
+		ln, ok := c.listeners[addr]
+		if !ok {
+			continue
 		}
-	}()
+		if addr.plain {
+			go l.serve(l.plainServer, ln)
+			l.log.Info().Str("addr", ln.Addr().String()).Str("mode", c.cfg.HTTP.Mode).Msg("LANListener plain HTTP started")
+		} else {
+			go l.serve(l.server, ln)
+			l.log.Info().Str("addr", ln.Addr().String()).Msg("LANListener started")
+		}
+	}
 
-	l.log.Info().Str("addr", l.addr).Msg("LANListener started")
+	for _, ln := range removed {
+		if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			l.log.Error().Err(err).Str("addr", ln.Addr().String()).Msg("Error closing LAN listener")
+		}
+		l.log.Info().Str("addr", ln.Addr().String()).Msg("LANListener stopped")
+	}
 
-	return nil
+	if c.newCerts && oldCerts != nil {
+		if err := oldCerts.Close(); err != nil {
+			l.log.Error().Err(err).Msg("Error closing LAN certificates")
+		}
+	}
+
+	if !mdnsChanged {
+		return
+	}
+	if responder != nil {
+		if err := responder.Close(); err != nil {
+			l.log.Error().Err(err).Msg("Error stopping multicast DNS")
+		}
+	}
+	// multicast DNS is optional, the listener works without it
+	if c.cfg.MDNS.Enabled {
+		responder, err := mdns.New(l.log, c.cfg.MDNS, c.cfg.Hostname, c.cfg.Port)
+		if err != nil {
+			l.log.Error().Err(err).Msg("Error starting multicast DNS")
+			return
+		}
+		l.mtx.Lock()
+		l.mdns = responder
+		l.mtx.Unlock()
+	}
+}
+
+// abort discards the configuration change.
+func (c *lanChange) abort() {
+	for _, ln := range c.listeners {
+		ln.Close()
+	}
+	if c.newCerts && c.certs != nil {
+		c.certs.Close()
+	}
+}
+
+func (l *lanListener) serve(server *http.Server, ln net.Listener) {
+	if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+		l.log.Error().Err(err).Str("addr", ln.Addr().String()).Msg("LAN listener stopped with error")
+	}
 }
 
 func (l *lanListener) close(ctx context.Context) error {
 	var err error
 
-	if l.server != nil {
-		err = errors.Join(err, l.server.Shutdown(ctx))
+	for _, server := range []*http.Server{l.server, l.plainServer} {
+		if errShutdown := server.Shutdown(ctx); drainExpired(errShutdown) {
+			l.log.Warn().Msg("Closing active LAN requests")
+			err = errors.Join(err, server.Close())
+		} else {
+			err = errors.Join(err, errShutdown)
+		}
 	}
 
 	l.mtx.RLock()
-	ln := l.listener
+	listeners := slices.Collect(maps.Values(l.listeners))
+	certs := l.certs
+	responder := l.mdns
 	l.mtx.RUnlock()
-	if ln != nil {
-		err = errors.Join(err, ln.Close())
+	if responder != nil {
+		err = errors.Join(err, responder.Close())
+	}
+	for _, ln := range listeners {
+		if errClose := ln.Close(); !errors.Is(errClose, net.ErrClosed) {
+			err = errors.Join(err, errClose)
+		}
+	}
+	if certs != nil {
+		err = errors.Join(err, certs.Close())
 	}
 
 	return err
 }
 
+// currentConfig returns the current configuration.
+func (l *lanListener) currentConfig() config.LANConfig {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	return l.cfg
+}
+
+// register adds the routes of the proxy endpoints that have a LAN port.
+// A proxy without any of them is removed.
 func (l *lanListener) register(proxy *Proxy) error {
-	handler, err := proxy.GetLANHandler()
-	if err != nil {
-		return err
+	l.mtx.RLock()
+	cfg := l.cfg
+	ports := l.ports
+	l.mtx.RUnlock()
+
+	hostname := proxy.GetConfig().Hostname
+
+	handlers, skipped := proxy.GetLANHandlers(cfg.Port, ports)
+	for _, name := range skipped {
+		l.log.Warn().
+			Str("proxy", hostname).
+			Str("port", name).
+			Msg("LANListener skipped port without a LAN port")
+	}
+	if len(handlers) == 0 {
+		l.unregisterProxy(proxy)
+		return fmt.Errorf("no HTTP endpoint of proxy %s can be served on the LAN ports", hostname)
 	}
 
-	shortHost := normalizeLANHostname(proxy.Config.Hostname)
+	shortHost := normalizeLANHostname(hostname)
 	if shortHost == "" {
 		return errors.New("invalid proxy hostname for LANListener")
 	}
@@ -107,21 +314,36 @@ func (l *lanListener) register(proxy *Proxy) error {
 	aliases := map[string]struct{}{
 		shortHost: {},
 	}
-
-	if rawURL := strings.TrimSpace(proxy.GetURL()); rawURL != "" && rawURL != "https://" {
-		if u, err := url.Parse(rawURL); err == nil {
-			if fqdn := normalizeLANHostname(u.Hostname()); fqdn != "" {
-				aliases[fqdn] = struct{}{}
-			}
+	for _, domain := range cfg.Domains {
+		if domain = normalizeLANHostname(domain); domain != "" {
+			aliases[shortHost+"."+domain] = struct{}{}
 		}
 	}
+	if cfg.MDNS.Enabled {
+		aliases[shortHost+".local"] = struct{}{}
+	}
+
+	if fqdn := proxyFQDN(proxy); fqdn != "" {
+		aliases[fqdn] = struct{}{}
+	}
 
 	l.mtx.Lock()
+	// aliases of a previous configuration are removed
+	for host, route := range l.routes {
+		if _, ok := aliases[host]; !ok && route.proxy == proxy {
+			delete(l.routes, host)
+		}
+	}
 	for host := range aliases {
-		l.routes[host] = lanRoute{proxy: proxy, handler: handler}
+		l.routes[host] = lanRoute{proxy: proxy, handlers: handlers}
 	}
+	responder := l.mdns
 	l.mtx.Unlock()
 
+	if responder != nil {
+		responder.Add(shortHost)
+	}
+
 	for host := range aliases {
 		l.log.Info().Str("hostname", host).Msg("LANListener registered hostname")
 	}
@@ -141,26 +363,41 @@ func (l *lanListener) unregisterProxy(proxy *Proxy) {
 			removed = append(removed, host)
 		}
 	}
+	responder := l.mdns
 	l.mtx.Unlock()
 
+	if responder != nil && len(removed) > 0 {
+		responder.Remove(normalizeLANHostname(proxy.GetConfig().Hostname))
+	}
+
 	for _, host := range removed {
 		l.log.Info().Str("hostname", host).Msg("LANListener unregistered hostname")
 	}
 }
 
 func (l *lanListener) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	host, route, ok := l.route(w, r)
+	if !ok {
+		return
+	}
+
+	l.serveRoute(w, r, host, route, localPort(r.Context()))
+}
+
+// route returns the route of the request host, or responds with an error.
+func (l *lanListener) route(w http.ResponseWriter, r *http.Request) (string, lanRoute, bool) {
 	host := normalizeLANHostname(r.Host)
 	if host == "" {
 		l.log.Debug().Str("rawHost", r.Host).Msg("LANListener missing/invalid host header")
 		http.Error(w, "missing host", http.StatusBadRequest)
-		return
+		return "", lanRoute{}, false
 	}
 
 	l.mtx.RLock()
 	routeCount := len(l.routes)
 	route, ok := l.routes[host]
 	l.mtx.RUnlock()
-	if !ok || route.handler == nil {
+	if !ok {
 		l.log.Debug().
 			Str("host", host).
 			Str("method", r.Method).
@@ -168,15 +405,33 @@ func (l *lanListener) serveHTTP(w http.ResponseWriter, r *http.Request) {
 			Int("routeCount", routeCount).
 			Msg("LANListener unknown host")
 		http.Error(w, "unknown host", http.StatusMisdirectedRequest)
+		return "", lanRoute{}, false
+	}
+
+	return host, route, true
+}
+
+// serveRoute serves the request with the handler of the route for a LAN port.
+func (l *lanListener) serveRoute(w http.ResponseWriter, r *http.Request, host string, route lanRoute, port uint16) {
+	handler, ok := route.handlers[port]
+	if !ok {
+		l.log.Debug().
+			Str("host", host).
+			Uint16("port", port).
+			Str("method", r.Method).
+			Str("path", r.URL.RequestURI()).
+			Msg("LANListener unknown port")
+		http.Error(w, "unknown port", http.StatusMisdirectedRequest)
 		return
 	}
 
 	l.log.Debug().
 		Str("host", host).
+		Uint16("port", port).
 		Str("method", r.Method).
 		Str("path", r.URL.RequestURI()).
 		Msg("LANListener routing request")
-	route.handler.ServeHTTP(w, r)
+	handler.ServeHTTP(w, r)
 }
 
 func (l *lanListener) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
@@ -203,9 +458,85 @@ func (l *lanListener) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certifica
 		Str("serverName", hello.ServerName).
 		Str("normalizedHost", host).
 		Msg("LANListener selecting TLS certificate")
+
+	// the Tailscale certificate is used if the store doesn't have one
+	l.mtx.RLock()
+	certs := l.certs
+	l.mtx.RUnlock()
+	if certs != nil {
+		if cert, err := certs.GetCertificate(host); err != nil || cert != nil {
+			return cert, err
+		}
+	}
+
 	return route.proxy.GetTLSCertificate(host)
 }
 
+// rootCA returns the CA certificate in PEM format, if the certificates are
+// issued by the local CA.
+func (l *lanListener) rootCA() ([]byte, bool) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	ca, ok := l.certs.(*lancert.CA)
+	if !ok {
+		return nil, false
+	}
+
+	return ca.RootPEM(), true
+}
+
+// lanPorts returns the HTTPS ports of a configuration, the main port first.
+func lanPorts(cfg config.LANConfig) []uint16 {
+	ports := []uint16{cfg.Port}
+	for _, p := range cfg.ExtraPorts {
+		if !slices.Contains(ports, p) {
+			ports = append(ports, p)
+		}
+	}
+
+	return ports
+}
+
+// lanAddrs returns the addresses of a configuration.
+func lanAddrs(cfg config.LANConfig, ports []uint16) []lanAddr {
+	addrs := make([]lanAddr, 0, len(ports)+1)
+	for _, port := range ports {
+		addrs = append(addrs, lanAddr{addr: net.JoinHostPort(cfg.Hostname, strconv.Itoa(int(port)))})
+	}
+	if cfg.HTTP.Enabled {
+		addrs = append(addrs, lanAddr{addr: net.JoinHostPort(cfg.Hostname, strconv.Itoa(int(cfg.HTTP.Port))), plain: true})
+	}
+
+	return addrs
+}
+
+// localPort returns the local port of the connection of a request.
+func localPort(ctx context.Context) uint16 {
+	addr, ok := ctx.Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if !ok {
+		return 0
+	}
+
+	return uint16(addr.Port) //nolint:gosec
+}
+
+// proxyFQDN returns the MagicDNS FQDN of a proxy, or empty if it isn't known
+// yet.
+func proxyFQDN(proxy *Proxy) string {
+	rawURL := strings.TrimSpace(proxy.GetURL())
+	if rawURL == "" || rawURL == "https://" {
+		return ""
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return normalizeLANHostname(u.Hostname())
+}
+
 func normalizeLANHostname(host string) string {
 	host = strings.TrimSpace(strings.ToLower(host))
 	if host == "" {
@@ -0,0 +1,253 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/core"
+	"github.com/almeidapaulopt/tsdproxy/internal/metrics"
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsLabelProxy    = "proxy"
+	metricsLabelPort     = "port"
+	metricsLabelProvider = "provider"
+)
+
+var (
+	httpRequestsTotal = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsdproxy_http_requests_total",
+		Help: "Total HTTP requests by status class.",
+	}, []string{metricsLabelProxy, metricsLabelPort, "code"})
+	httpRequestDuration = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tsdproxy_http_request_duration_seconds",
+		Help:    "HTTP request latency in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{metricsLabelProxy, metricsLabelPort})
+	bytesReceivedTotal = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsdproxy_bytes_received_total",
+		Help: "Total bytes received from clients.",
+	}, []string{metricsLabelProxy, metricsLabelPort})
+	bytesSentTotal = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsdproxy_bytes_sent_total",
+		Help: "Total bytes sent to clients.",
+	}, []string{metricsLabelProxy, metricsLabelPort})
+	activeConnections = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tsdproxy_active_connections",
+		Help: "Active client connections, or UDP sessions.",
+	}, []string{metricsLabelProxy, metricsLabelPort})
+	rateLimitedTotal = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsdproxy_rate_limited_total",
+		Help: "Total requests rejected by rate limits.",
+	}, []string{metricsLabelProxy, metricsLabelPort})
+	proxyStatus = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tsdproxy_proxy_status",
+		Help: "Current status of the proxy, 1 for the active status.",
+	}, []string{metricsLabelProxy, "status"})
+	tsnetStartDuration = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tsdproxy_tsnet_start_duration_seconds",
+		Help:    "Time from proxy start until it's running, in seconds.",
+		Buckets: []float64{1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{metricsLabelProxy})
+	tsnetAuthDuration = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tsdproxy_tsnet_auth_duration_seconds",
+		Help:    "Time waiting for proxy authentication, in seconds.",
+		Buckets: []float64{5, 30, 60, 300, 900, 3600},
+	}, []string{metricsLabelProxy})
+	targetProviderEventsTotal = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsdproxy_target_provider_events_total",
+		Help: "Total events received from target providers.",
+	}, []string{metricsLabelProvider, "action"})
+	targetProviderEventsCoalescedTotal = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsdproxy_target_provider_events_coalesced_total",
+		Help: "Total events of target providers dropped because a newer event replaced them.",
+	}, []string{metricsLabelProvider})
+	targetProviderErrorsTotal = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsdproxy_target_provider_errors_total",
+		Help: "Total errors of target providers.",
+	}, []string{metricsLabelProvider})
+)
+
+type (
+	// portMetrics stores the metrics of a proxy port.
+	portMetrics struct {
+		proxy     string
+		port      string
+		duration  prometheus.Observer
+		received  prometheus.Counter
+		sent      prometheus.Counter
+		active    prometheus.Gauge
+		throttled prometheus.Counter
+	}
+
+	// responseRecorder records the status and size of a response.
+	responseRecorder struct {
+		http.ResponseWriter
+		status int
+		size   int
+	}
+
+	// countingReader counts the bytes read from a request body.
+	countingReader struct {
+		io.ReadCloser
+		counter prometheus.Counter
+	}
+
+	// proxyTimings tracks the status transitions of a proxy for the tsnet metrics.
+	proxyTimings struct {
+		start time.Time
+		auth  time.Time
+	}
+)
+
+func newPortMetrics(proxy, port string) *portMetrics {
+	return &portMetrics{
+		proxy:     proxy,
+		port:      port,
+		duration:  httpRequestDuration.WithLabelValues(proxy, port),
+		received:  bytesReceivedTotal.WithLabelValues(proxy, port),
+		sent:      bytesSentTotal.WithLabelValues(proxy, port),
+		active:    activeConnections.WithLabelValues(proxy, port),
+		throttled: rateLimitedTotal.WithLabelValues(proxy, port),
+	}
+}
+
+// deleteProxyMetrics removes all metrics of a proxy.
+func deleteProxyMetrics(proxy string) {
+	labels := prometheus.Labels{metricsLabelProxy: proxy}
+	httpRequestsTotal.DeletePartialMatch(labels)
+	httpRequestDuration.DeletePartialMatch(labels)
+	bytesReceivedTotal.DeletePartialMatch(labels)
+	bytesSentTotal.DeletePartialMatch(labels)
+	activeConnections.DeletePartialMatch(labels)
+	rateLimitedTotal.DeletePartialMatch(labels)
+	proxyStatus.DeletePartialMatch(labels)
+	tsnetStartDuration.DeletePartialMatch(labels)
+	tsnetAuthDuration.DeletePartialMatch(labels)
+}
+
+// deletePortMetrics removes the metrics of a port of a proxy.
+func deletePortMetrics(proxy, port string) {
+	labels := prometheus.Labels{metricsLabelProxy: proxy, metricsLabelPort: port}
+	httpRequestsTotal.DeletePartialMatch(labels)
+	httpRequestDuration.DeletePartialMatch(labels)
+	bytesReceivedTotal.DeletePartialMatch(labels)
+	bytesSentTotal.DeletePartialMatch(labels)
+	activeConnections.DeletePartialMatch(labels)
+	rateLimitedTotal.DeletePartialMatch(labels)
+}
+
+// setProxyStatusMetric sets the status gauge of the proxy.
+func setProxyStatusMetric(proxy string, status model.ProxyStatus) {
+	for s := model.ProxyStatusInitializing; s <= model.ProxyStatusError; s++ {
+		value := 0.0
+		if s == status {
+			value = 1
+		}
+		proxyStatus.WithLabelValues(proxy, s.String()).Set(value)
+	}
+}
+
+// observe records the tsnet start and authentication durations on status changes.
+func (t *proxyTimings) observe(proxy string, status model.ProxyStatus) {
+	now := time.Now()
+
+	switch status {
+	case model.ProxyStatusStarting:
+		t.start = now
+	case model.ProxyStatusAuthenticating:
+		if t.auth.IsZero() {
+			t.auth = now
+		}
+	case model.ProxyStatusRunning:
+		if !t.auth.IsZero() {
+			tsnetAuthDuration.WithLabelValues(proxy).Observe(now.Sub(t.auth).Seconds())
+			t.auth = time.Time{}
+		}
+		if !t.start.IsZero() {
+			tsnetStartDuration.WithLabelValues(proxy).Observe(now.Sub(t.start).Seconds())
+			t.start = time.Time{}
+		}
+	}
+}
+
+// middleware records request counts, latency and bytes of the port.
+func (m *portMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &countingReader{ReadCloser: r.Body, counter: m.received}
+		}
+		mw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(mw, r)
+
+		m.duration.Observe(time.Since(start).Seconds())
+		m.sent.Add(float64(mw.size))
+		httpRequestsTotal.WithLabelValues(m.proxy, m.port, statusClass(mw.status)).Inc()
+	})
+}
+
+// connState tracks the active connections of http.Server.
+func (m *portMetrics) connState(_ net.Conn, state http.ConnState) {
+	switch state { //nolint:exhaustive
+	case http.StateNew:
+		m.active.Inc()
+	case http.StateHijacked, http.StateClosed:
+		m.active.Dec()
+	}
+}
+
+// statusClass returns the class of a HTTP status code, like "2xx".
+func statusClass(status int) string {
+	if status < 100 || status > 599 { //nolint:mnd
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx" //nolint:mnd
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.status = http.StatusSwitchingProtocols
+		return h.Hijack()
+	}
+	return nil, nil, core.ErrHijackNotSupported
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.counter.Add(float64(n))
+	return n, err
+}
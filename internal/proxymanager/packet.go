@@ -0,0 +1,406 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/accesslog"
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// maxPacketSize is the biggest UDP payload.
+	maxPacketSize = 65535
+	// maxPendingPackets is the number of packets of a client queued while
+	// its session is created. The next ones are dropped.
+	maxPendingPackets = 16
+)
+
+type (
+	// packetServer forwards UDP packets to the port upstreams.
+	// Each client gets its own session, with a dedicated upstream socket,
+	// so replies are sent back to the right client.
+	packetServer struct {
+		log         zerolog.Logger
+		ctx         context.Context
+		lb          *balancer
+		whois       func(ctx context.Context, remoteAddr string) model.Whois
+		access      *accessControl
+		rateLimiter *rateLimiter
+		stats       *portMetrics
+		conn        net.PacketConn
+		sessions    map[string]*packetSession
+		// pending stores the packets of the clients whose session is
+		// being created
+		pending     map[string][][]byte
+		done        chan struct{}
+		idleTimeout time.Duration
+		maxSessions int
+		wg          sync.WaitGroup
+		mtx         sync.Mutex
+		accessLog   accesslog.Logger
+		closed      atomic.Bool
+	}
+
+	// packetSession is the NAT entry of a client.
+	packetSession struct {
+		log      zerolog.Logger
+		client   net.Addr
+		who      model.Whois
+		target   net.Conn
+		upstream *upstream
+		start    time.Time
+		last     atomic.Int64
+		sent     atomic.Int64
+		received atomic.Int64
+	}
+)
+
+func newPortPacket(
+	ctx context.Context,
+	pconfig model.PortConfig,
+	log zerolog.Logger,
+	accessLog accesslog.Logger,
+	access *accessControl,
+	stats *portMetrics,
+	whoisFunc func(ctx context.Context, remoteAddr string) model.Whois,
+) *port {
+	ctxPort, cancel := context.WithCancel(ctx)
+
+	lb := newBalancer(pconfig)
+	rl := newRateLimiter(ctxPort, log, pconfig.RateLimit, stats.throttled)
+
+	server := &packetServer{
+		log:         log,
+		ctx:         ctxPort,
+		lb:          lb,
+		whois:       whoisFunc,
+		access:      access,
+		rateLimiter: rl,
+		stats:       stats,
+		idleTimeout: pconfig.IdleTimeout,
+		maxSessions: pconfig.MaxSessions,
+		accessLog:   accessLog,
+		sessions:    make(map[string]*packetSession),
+		pending:     make(map[string][][]byte),
+		done:        make(chan struct{}),
+	}
+
+	if server.idleTimeout <= 0 {
+		server.idleTimeout = model.DefaultUDPIdleTimeout
+	}
+	if server.maxSessions <= 0 {
+		server.maxSessions = model.DefaultUDPMaxSessions
+	}
+
+	p := &port{
+		log:          log,
+		ctx:          ctxPort,
+		cancel:       cancel,
+		packetServer: server,
+		lb:           lb,
+		rateLimiter:  rl,
+	}
+
+	if pconfig.HealthCheck.Type != "" {
+		// the PROXY protocol header isn't sent on UDP ports
+		p.healthChecker = newHealthChecker(log, pconfig.HealthCheck, pconfig.TLSValidate, model.ProxyHeader{}, p.changed)
+	}
+
+	return p
+}
+
+// ServePacket reads packets from conn and forwards them until conn is closed.
+func (s *packetServer) ServePacket(conn net.PacketConn) error {
+	s.mtx.Lock()
+	s.conn = conn
+	s.mtx.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.expireSessions()
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.closed.Load() {
+				return net.ErrClosed
+			}
+			return err
+		}
+
+		if session := s.getSession(addr, buf[:n]); session != nil {
+			s.forward(session, buf[:n])
+		}
+	}
+}
+
+// forward sends a packet of the client to the upstream of its session.
+func (s *packetServer) forward(session *packetSession, packet []byte) {
+	if _, err := session.target.Write(packet); err != nil {
+		session.log.Debug().Err(err).Msg("error writing to upstream")
+		return
+	}
+	session.sent.Add(int64(len(packet)))
+	s.stats.received.Add(float64(len(packet)))
+	session.last.Store(time.Now().UnixNano())
+}
+
+// Shutdown stops creating sessions, and waits until the active sessions are
+// closed by the idle timeout or ctx is done. Then it closes the packet
+// listener and the remaining sessions.
+func (s *packetServer) Shutdown(ctx context.Context) error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+
+	s.drain(ctx)
+	close(s.done)
+
+	s.mtx.Lock()
+	var err error
+	if s.conn != nil {
+		err = s.conn.Close()
+	}
+	if n := len(s.sessions); n > 0 && ctx.Err() != nil {
+		s.log.Debug().Int("sessions", n).Msg("Closing active udp sessions")
+	}
+	for key, session := range s.sessions {
+		s.closeSession(key, session)
+	}
+	s.mtx.Unlock()
+
+	s.wg.Wait()
+
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// drain waits until there are no sessions, or ctx is done.
+func (s *packetServer) drain(ctx context.Context) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.mtx.Lock()
+		n := len(s.sessions) + len(s.pending)
+		s.mtx.Unlock()
+		if n == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getSession returns the session of the client. Clients without a session
+// return nil: the packet is queued and the session is created in the
+// background, so the whois lookup and the upstream dial of a new client don't
+// block the packets of the other sessions.
+func (s *packetServer) getSession(client net.Addr, packet []byte) *packetSession {
+	key := client.String()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if session, ok := s.sessions[key]; ok {
+		return session
+	}
+	if queued, ok := s.pending[key]; ok {
+		if len(queued) < maxPendingPackets {
+			s.pending[key] = append(queued, slices.Clone(packet))
+		}
+		return nil
+	}
+	if s.closed.Load() {
+		return nil
+	}
+	if len(s.sessions)+len(s.pending) >= s.maxSessions {
+		s.log.Warn().Str("client", key).Int("maxSessions", s.maxSessions).Msg("udp session limit reached, dropping packet")
+		return nil
+	}
+
+	s.pending[key] = [][]byte{slices.Clone(packet)}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.startSession(client, key)
+	}()
+
+	return nil
+}
+
+// startSession creates the session of a client, and forwards the packets
+// queued while it was created.
+func (s *packetServer) startSession(client net.Addr, key string) {
+	session := s.newSession(client, key)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	packets := s.pending[key]
+	delete(s.pending, key)
+	if session == nil {
+		return
+	}
+	if s.closed.Load() {
+		session.target.Close()
+		return
+	}
+
+	session.start = time.Now()
+	session.last.Store(session.start.UnixNano())
+	session.upstream.active.Add(1)
+	s.stats.active.Inc()
+
+	s.sessions[key] = session
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.reply(key, session)
+	}()
+
+	session.log.Debug().Msg("udp session created")
+
+	// the queued packets are sent before the next ones, that wait for s.mtx
+	for _, packet := range packets {
+		s.forward(session, packet)
+	}
+}
+
+// newSession checks the access of the client and dials an upstream.
+// Returns nil if the client isn't allowed or the dial fails.
+func (s *packetServer) newSession(client net.Addr, key string) *packetSession {
+	log := s.log.With().Str("client", key).Logger()
+	var who model.Whois
+	if s.whois != nil {
+		who = s.whois(s.ctx, key)
+		log = log.With().Str("username", who.Username).Str("displayName", who.DisplayName).Logger()
+	}
+
+	if !s.access.allowed(who) {
+		log.Info().Str("node", who.NodeName).Msg("access denied")
+		return nil
+	}
+
+	if !s.rateLimiter.allowed(who, key) {
+		return nil
+	}
+
+	u := s.lb.choose()
+	if u == nil {
+		log.Error().Msg("no healthy target available")
+		return nil
+	}
+
+	log = log.With().Str("target", u.url.String()).Logger()
+
+	var d net.Dialer
+	target, err := d.DialContext(s.ctx, "udp", targetHostPort(u.url))
+	if err != nil {
+		log.Error().Err(err).Msg("upstream dial error")
+		return nil
+	}
+
+	return &packetSession{
+		log:      log,
+		client:   client,
+		who:      who,
+		target:   target,
+		upstream: u,
+	}
+}
+
+// reply forwards the packets from the upstream back to the client.
+func (s *packetServer) reply(key string, session *packetSession) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, err := session.target.Read(buf)
+		if err != nil {
+			break
+		}
+
+		if _, err := s.conn.WriteTo(buf[:n], session.client); err != nil {
+			session.log.Debug().Err(err).Msg("error writing to client")
+			continue
+		}
+		session.received.Add(int64(n))
+		s.stats.sent.Add(float64(n))
+		session.last.Store(time.Now().UnixNano())
+	}
+
+	s.mtx.Lock()
+	s.closeSession(key, session)
+	s.mtx.Unlock()
+}
+
+// expireSessions closes the sessions without traffic for longer than idleTimeout.
+func (s *packetServer) expireSessions() {
+	ticker := time.NewTicker(s.idleTimeout / 2) //nolint:mnd
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.mtx.Lock()
+		for key, session := range s.sessions {
+			if time.Since(time.Unix(0, session.last.Load())) >= s.idleTimeout {
+				s.closeSession(key, session)
+			}
+		}
+		s.mtx.Unlock()
+	}
+}
+
+// closeSession removes the session. s.mtx must be held.
+func (s *packetServer) closeSession(key string, session *packetSession) {
+	if s.sessions[key] != session {
+		return
+	}
+	delete(s.sessions, key)
+
+	session.target.Close()
+	session.upstream.active.Add(-1)
+	s.stats.active.Dec()
+
+	session.log.Debug().
+		Int64("bytesIn", session.sent.Load()).
+		Int64("bytesOut", session.received.Load()).
+		Dur("duration", time.Since(session.start)).
+		Msg("udp session closed")
+
+	if s.accessLog != nil {
+		entry := connectionLogEntry(s.stats, "UDP", session.client.String(), session.who, session.start)
+		entry.Target = session.upstream.url.String()
+		entry.BytesIn = session.sent.Load()
+		entry.BytesOut = session.received.Load()
+		entry.Latency = time.Since(session.start)
+		s.accessLog.Log(entry)
+	}
+}
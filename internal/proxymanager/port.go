@@ -13,6 +13,7 @@ import (
 	"net/http/httputil"
 	"sync"
 
+	"github.com/almeidapaulopt/tsdproxy/internal/accesslog"
 	"github.com/almeidapaulopt/tsdproxy/internal/consts"
 	"github.com/almeidapaulopt/tsdproxy/internal/core"
 	"github.com/almeidapaulopt/tsdproxy/internal/model"
@@ -20,38 +21,73 @@ import (
 	"github.com/rs/zerolog"
 )
 
-type port struct {
-	log        zerolog.Logger
-	ctx        context.Context
-	listener   net.Listener
-	cancel     context.CancelFunc
-	handler    http.Handler
-	httpServer *http.Server
-	mtx        sync.Mutex
-}
+type (
+	port struct {
+		log           zerolog.Logger
+		ctx           context.Context
+		listener      net.Listener
+		cancel        context.CancelFunc
+		handler       http.Handler
+		server        portServer
+		packetServer  *packetServer
+		lb            *balancer
+		routes        []*balancer
+		rateLimiter   *rateLimiter
+		healthChecker *healthChecker
+		inflight      *inflight
+		onChange      func()
+		state         model.PortState
+		mtx           sync.Mutex
+		checking      bool
+		// unlistened is set when the listener is closed by stopListening
+		unlistened bool
+	}
+
+	// portServer serves the connections of a port listener.
+	// It's implemented by http.Server and streamServer.
+	portServer interface {
+		Serve(l net.Listener) error
+		Shutdown(ctx context.Context) error
+	}
+)
 
 func newPortProxy(
 	ctx context.Context,
 	pconfig model.PortConfig,
 	log zerolog.Logger,
-	accessLog bool,
+	accessLog accesslog.Logger,
+	access *accessControl,
+	stats *portMetrics,
 	whoisFunc func(next http.Handler) http.Handler,
 ) *port {
 	//
-	log = log.With().Str("port", pconfig.String()).Logger()
-
 	ctxPort, cancel := context.WithCancel(ctx)
 
+	lb := newBalancer(pconfig)
+	headers := newHeaderRewriter(log, pconfig.Headers)
+	rl := newRateLimiter(ctxPort, log, pconfig.RateLimit, stats.throttled)
+
 	// Create the reverse proxy
 	//
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: !pconfig.TLSValidate}, //nolint
 	}
+	if pconfig.ProxyHeader.Version != 0 {
+		// the PROXY protocol header is sent once per connection,
+		// so upstream connections can't be shared between clients
+		tr.DialContext = proxyHeaderDialContext(pconfig.ProxyHeader)
+		tr.DisableKeepAlives = true
+	}
 	reverseProxy := &httputil.ReverseProxy{
-		Transport: tr,
+		Transport: tracingTransport(tr),
 		Rewrite: func(r *httputil.ProxyRequest) {
-			targetURL := pconfig.GetFirstTarget()
+			u, ok := upstreamFromContext(r.In.Context())
+			if !ok {
+				return
+			}
+			targetURL := u.url
 			r.SetURL(targetURL)
+			setAccessLogTarget(r.In.Context(), targetURL.String())
 			r.Out.Host = r.In.Host
 			r.Out.Header["X-Forwarded-For"] = r.In.Header["X-Forwarded-For"]
 			log.Debug().
@@ -68,6 +104,8 @@ func newPortProxy(
 			}
 
 			r.SetXForwarded()
+
+			headers.rewriteRequest(r.Out)
 		},
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
 			log.Error().
@@ -75,7 +113,7 @@ func newPortProxy(
 				Str("method", r.Method).
 				Str("host", r.Host).
 				Str("path", r.URL.RequestURI()).
-				Str("target", pconfig.GetFirstTarget().String()).
+				Str("target", targetString(r.Context())).
 				Msg("upstream proxy error")
 			http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		},
@@ -85,37 +123,66 @@ func newPortProxy(
 				Str("method", resp.Request.Method).
 				Str("host", resp.Request.Host).
 				Str("path", resp.Request.URL.RequestURI()).
-				Str("target", pconfig.GetFirstTarget().String()).
+				Str("target", targetString(resp.Request.Context())).
 				Msg("upstream response")
+
+			// upgrade responses are written to the hijacked connection,
+			// without the ResponseWriter of headers.middleware
+			if resp.StatusCode == http.StatusSwitchingProtocols {
+				headers.rewriteResponse(resp)
+			}
 			return nil
 		},
 	}
 
-	handler := whoisFunc(reverseProxy)
-	// add logger to proxy
-	if accessLog {
-		handler = core.LoggerMiddleware(log, handler)
+	var handler http.Handler
+	rt := newRouter(pconfig, lb, reverseProxy)
+	if rt != nil {
+		handler = rt
+	} else {
+		handler = lb.middleware(reverseProxy)
+	}
+	if pconfig.ProxyHeader.Version != 0 {
+		handler = withClientAddr(handler)
 	}
+	// the middlewares wrapped by whoisFunc read the Whois of the client
+	// from the request context
+	handler = headers.middleware(tracingUserAttributes(access.middleware(log, rl.middleware(handler))))
+	handler = whoisFunc(accessLogMiddleware(accessLog, stats.proxy, stats.port, handler))
+	handler = tracingMiddleware(stats.proxy, stats.port, stats.middleware(handler))
+
+	// active requests are drained on shutdown
+	requests := &inflight{}
+	handler = requests.middleware(handler)
 
 	// main http Server
 	httpServer := &http.Server{
 		Handler:           handler,
 		ReadHeaderTimeout: core.ReadHeaderTimeout,
 		BaseContext:       func(net.Listener) context.Context { return ctxPort },
+		ConnState:         stats.connState,
 	}
 
-	return &port{
-		log:        log,
-		ctx:        ctxPort,
-		cancel:     cancel,
-		handler:    handler,
-		httpServer: httpServer,
+	p := &port{
+		log:         log,
+		ctx:         ctxPort,
+		cancel:      cancel,
+		handler:     handler,
+		server:      httpServer,
+		lb:          lb,
+		routes:      rt.balancers(),
+		rateLimiter: rl,
+		inflight:    requests,
+	}
+
+	if pconfig.HealthCheck.Type != "" {
+		p.healthChecker = newHealthChecker(log, pconfig.HealthCheck, pconfig.TLSValidate, pconfig.ProxyHeader, p.changed)
 	}
+
+	return p
 }
 
 func newPortRedirect(ctx context.Context, pconfig model.PortConfig, log zerolog.Logger) *port {
-	log = log.With().Str("port", pconfig.String()).Logger()
-
 	ctxPort, cancel := context.WithCancel(ctx)
 
 	redirectHTTPServer := &http.Server{
@@ -126,40 +193,213 @@ func newPortRedirect(ctx context.Context, pconfig model.PortConfig, log zerolog.
 	}
 
 	return &port{
-		log:        log,
-		ctx:        ctxPort,
-		cancel:     cancel,
-		handler:    redirectHTTPServer.Handler,
-		httpServer: redirectHTTPServer,
+		log:     log,
+		ctx:     ctxPort,
+		cancel:  cancel,
+		handler: redirectHTTPServer.Handler,
+		server:  redirectHTTPServer,
 	}
 }
 
 func (p *port) startWithListener(l net.Listener) error {
 	p.mtx.Lock()
+	if p.unlistened {
+		p.mtx.Unlock()
+		return l.Close()
+	}
 	p.listener = l
 	p.mtx.Unlock()
 
-	err := p.httpServer.Serve(l)
+	p.startHealthChecks()
+	p.setState(model.PortStatusListening, l.Addr(), nil)
+
+	err := p.server.Serve(l)
 	defer p.log.Info().Msg("Terminating server")
 
 	if err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, http.ErrServerClosed) {
-		return fmt.Errorf("error starting port %w", err)
+		err = fmt.Errorf("error starting port %w", err)
+		p.setState(model.PortStatusError, nil, err)
+		return err
 	}
+	p.setState(model.PortStatusStopped, nil, nil)
 	return nil
 }
 
-func (p *port) close() error {
+func (p *port) startWithPacketConn(conn net.PacketConn) error {
+	p.startHealthChecks()
+	p.setState(model.PortStatusListening, conn.LocalAddr(), nil)
+
+	err := p.packetServer.ServePacket(conn)
+	defer p.log.Info().Msg("Terminating server")
+
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		err = fmt.Errorf("error starting port %w", err)
+		p.setState(model.PortStatusError, nil, err)
+		return err
+	}
+	p.setState(model.PortStatusStopped, nil, nil)
+	return nil
+}
+
+// startHealthChecks starts the health checks of the port upstreams.
+func (p *port) startHealthChecks() {
+	if p.healthChecker == nil {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.checking = true
+	p.healthChecker.start(p.ctx, p.upstreams())
+}
+
+// updateTargets replaces the targets of the port without closing its listener.
+// Only ports with a balancer can be updated.
+func (p *port) updateTargets(pconfig model.PortConfig) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	added := p.lb.setTargets(pconfig.LoadBalancer, pconfig.GetTargets())
+	if p.checking {
+		p.healthChecker.start(p.ctx, added)
+	}
+
+	p.log.Info().Int("targets", len(pconfig.GetTargets())).Msg("targets updated")
+}
+
+// health returns the health state of the port and routes targets.
+func (p *port) health() []model.TargetHealth {
+	var health []model.TargetHealth
+	if p.lb != nil {
+		health = p.lb.health()
+	}
+	for _, lb := range p.routes {
+		health = append(health, lb.health()...)
+	}
+	return health
+}
+
+// upstreams returns the upstreams of the port and routes.
+func (p *port) upstreams() []*upstream {
+	var upstreams []*upstream
+	if p.lb != nil {
+		upstreams = append(upstreams, p.lb.list()...)
+	}
+	for _, lb := range p.routes {
+		upstreams = append(upstreams, lb.list()...)
+	}
+	return upstreams
+}
+
+// getState returns the state of the port.
+func (p *port) getState() model.PortState {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.state
+}
+
+// setState changes the state of the port. err is stored as the last error of the port.
+func (p *port) setState(status model.PortStatus, addr net.Addr, err error) {
+	p.mtx.Lock()
+	p.state.Status = status
+	if addr != nil {
+		p.state.Addr = addr.String()
+	}
+	if err != nil {
+		p.state.Error = err.Error()
+	}
+	p.mtx.Unlock()
+
+	p.changed()
+}
+
+// changed notifies a change of the port state or of the health of its targets.
+func (p *port) changed() {
+	if p.onChange != nil {
+		p.onChange()
+	}
+}
+
+// close stops the port. It stops accepting connections, and waits for the
+// active requests and connections until ctx is done. The remaining ones are
+// closed.
+func (p *port) close(ctx context.Context) error {
 	var errs error
 
-	if p.httpServer != nil {
-		errs = errors.Join(errs, p.httpServer.Shutdown(p.ctx))
+	if p.server != nil {
+		err := p.server.Shutdown(ctx)
+		// the listener may be closed by stopListening
+		if errors.Is(err, net.ErrClosed) {
+			err = nil
+		}
+		if err == nil && p.inflight != nil {
+			err = p.inflight.wait(ctx)
+		}
+		if drainExpired(err) {
+			err = p.closeRequests()
+		}
+		errs = errors.Join(errs, err)
+	}
+
+	if p.packetServer != nil {
+		errs = errors.Join(errs, p.packetServer.Shutdown(ctx))
 	}
 
-	if p.listener != nil {
-		errs = errors.Join(errs, p.listener.Close())
+	p.mtx.Lock()
+	l := p.listener
+	p.mtx.Unlock()
+
+	// the listener is already closed by the server shutdown
+	if l != nil {
+		if err := l.Close(); !errors.Is(err, net.ErrClosed) {
+			errs = errors.Join(errs, err)
+		}
 	}
 
 	p.cancel()
 
 	return errs
 }
+
+// stopListening closes the listener of the port, so a new port can listen on
+// the same address while close drains the active requests and connections.
+// Packet ports are closed, since their sessions reply through the listener.
+func (p *port) stopListening() error {
+	if p.packetServer != nil {
+		return p.packetServer.Shutdown(closedContext())
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.unlistened = true
+	if p.listener == nil {
+		return nil
+	}
+	if err := p.listener.Close(); !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// closeRequests closes the requests still active after draining the port.
+func (p *port) closeRequests() error {
+	if p.inflight != nil {
+		if n := p.inflight.active.Load(); n > 0 {
+			p.log.Warn().Int64("requests", n).Msg("Closing active requests")
+		}
+	}
+
+	// requests to the upstreams are canceled with the port context
+	p.cancel()
+
+	if s, ok := p.server.(*http.Server); ok {
+		if err := s.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -8,11 +8,14 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"sync"
 
+	"github.com/almeidapaulopt/tsdproxy/internal/accesslog"
 	"github.com/almeidapaulopt/tsdproxy/internal/model"
 	"github.com/almeidapaulopt/tsdproxy/internal/proxyproviders"
 
@@ -22,17 +25,26 @@ import (
 type (
 	// Proxy struct is a struct that contains all the information needed to run a proxy.
 	Proxy struct {
-		onUpdate func(event model.ProxyEvent)
+		onUpdate     func(event model.ProxyEvent)
+		onStartError func(err error)
 
 		log           zerolog.Logger
 		ctx           context.Context
 		providerProxy proxyproviders.ProxyInterface
-		Config        *model.Config
-		URL           *url.URL
-		cancel        context.CancelFunc
-		ports         map[string]*port
-		mtx           sync.RWMutex
-		status        model.ProxyStatus
+		// proxyProvider is the name of the proxy provider
+		proxyProvider string
+		accessLogs    *accesslog.Manager
+		accessLog     accesslog.Logger
+		// config is replaced, never modified, when the proxy is reconfigured
+		config  *model.Config
+		URL     *url.URL
+		cancel  context.CancelFunc
+		ports   map[string]*port
+		timings proxyTimings
+		mtx     sync.RWMutex
+		status  model.ProxyStatus
+		started bool
+		closed  bool
 	}
 )
 
@@ -40,6 +52,7 @@ type (
 func NewProxy(log zerolog.Logger,
 	pcfg *model.Config,
 	proxyProvider proxyproviders.Provider,
+	accessLogs *accesslog.Manager,
 ) (*Proxy, error) {
 	//
 	var err error
@@ -65,13 +78,18 @@ func NewProxy(log zerolog.Logger,
 
 	p := &Proxy{
 		log:           log,
-		Config:        pcfg,
+		config:        pcfg,
 		ctx:           ctx,
 		cancel:        cancel,
 		providerProxy: pProvider,
+		accessLogs:    accessLogs,
 		ports:         make(map[string]*port),
 	}
 
+	if pcfg.ProxyAccessLog {
+		p.accessLog = accessLogs.Logger(log, pcfg.Hostname)
+	}
+
 	p.initPorts()
 
 	return p, nil
@@ -81,22 +99,32 @@ func (proxy *Proxy) Start() {
 	go func() {
 		go proxy.start()
 		for event := range proxy.providerProxy.WatchEvents() {
-			proxy.setStatus(event.Status)
+			var err error
+			if event.Error != "" {
+				err = errors.New(event.Error)
+			}
+			proxy.setStatus(event.Status, event.Reason, err)
 		}
 	}()
 }
 
 // Close method is a method that initiate proxy close procedure.
-func (proxy *Proxy) Close() {
-	proxy.setStatus(model.ProxyStatusStopping)
+// reason describes why the proxy is closed.
+// Active requests and connections are closed right away, see Shutdown.
+func (proxy *Proxy) Close(reason string) {
+	proxy.Shutdown(closedContext(), reason)
+}
 
-	// cancel context
-	proxy.cancel()
+// Shutdown closes the proxy gracefully. The ports stop accepting connections,
+// and active requests and connections are drained until ctx is done.
+// reason describes why the proxy is closed.
+func (proxy *Proxy) Shutdown(ctx context.Context, reason string) {
+	proxy.setStatus(model.ProxyStatusStopping, reason, nil)
 
 	// make sure all listeners are closed
-	proxy.close()
+	proxy.close(ctx)
 
-	proxy.setStatus(model.ProxyStatusStopped)
+	proxy.setStatus(model.ProxyStatusStopped, reason, nil)
 }
 
 func (proxy *Proxy) GetStatus() model.ProxyStatus {
@@ -106,6 +134,15 @@ func (proxy *Proxy) GetStatus() model.ProxyStatus {
 	return proxy.status
 }
 
+// GetConfig returns the current configuration of the proxy.
+// The configuration must not be modified.
+func (proxy *Proxy) GetConfig() *model.Config {
+	proxy.mtx.RLock()
+	defer proxy.mtx.RUnlock()
+
+	return proxy.config
+}
+
 func (proxy *Proxy) GetURL() string {
 	return proxy.providerProxy.GetURL()
 }
@@ -118,31 +155,81 @@ func (proxy *Proxy) GetTLSCertificate(hostname string) (*tls.Certificate, error)
 	return proxy.providerProxy.GetTLSCertificate(hostname)
 }
 
-func (proxy *Proxy) GetLANHandler() (http.Handler, error) {
+// GetLANHandlers returns the handlers of the HTTP ports of the proxy by the
+// LAN port that serves them. A LAN port serves the proxy port with the same
+// number, and mainPort also serves the 443 port, or the only HTTP port.
+// The names of the HTTP ports without a LAN port are returned as skipped.
+func (proxy *Proxy) GetLANHandlers(mainPort uint16, lanPorts []uint16) (map[uint16]http.Handler, []string) {
 	proxy.mtx.RLock()
 	defer proxy.mtx.RUnlock()
 
-	var selected *port
-	nonRedirectCount := 0
-
-	for name, p := range proxy.ports {
-		cfg, ok := proxy.Config.Ports[name]
-		if !ok || cfg.IsRedirect {
+	byPort := make(map[int]string)
+	for _, name := range slices.Sorted(maps.Keys(proxy.ports)) {
+		cfg, ok := proxy.config.Ports[name]
+		if !ok || cfg.IsRedirect || !cfg.IsHTTP() || proxy.ports[name].handler == nil {
 			continue
 		}
+		if _, ok := byPort[cfg.ProxyPort]; !ok {
+			byPort[cfg.ProxyPort] = name
+		}
+	}
 
-		nonRedirectCount++
-		selected = p
+	handlers := make(map[uint16]http.Handler)
+	served := make(map[string]bool)
+	serve := func(lanPort uint16, name string) {
+		handlers[lanPort] = proxy.ports[name].handler
+		served[name] = true
 	}
 
-	if nonRedirectCount != 1 {
-		return nil, fmt.Errorf("LANListener requires exactly one non-redirect endpoint per target (proxy=%s count=%d)", proxy.Config.Hostname, nonRedirectCount)
+	for _, lanPort := range lanPorts {
+		if name, ok := byPort[int(lanPort)]; ok {
+			serve(lanPort, name)
+		}
 	}
-	if selected == nil || selected.handler == nil {
-		return nil, fmt.Errorf("LANListener endpoint handler not found for proxy=%s", proxy.Config.Hostname)
+
+	if _, ok := handlers[mainPort]; !ok {
+		if name, ok := byPort[443]; ok { //nolint:mnd
+			serve(mainPort, name)
+		} else if len(byPort) == 1 {
+			for _, name := range byPort {
+				serve(mainPort, name)
+			}
+		}
 	}
 
-	return selected.handler, nil
+	var skipped []string
+	for _, name := range byPort {
+		if !served[name] {
+			skipped = append(skipped, name)
+		}
+	}
+	slices.Sort(skipped)
+
+	return handlers, skipped
+}
+
+// GetPortHealth returns the health state of the targets of a port.
+func (proxy *Proxy) GetPortHealth(name string) []model.TargetHealth {
+	proxy.mtx.RLock()
+	p, ok := proxy.ports[name]
+	proxy.mtx.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	return p.health()
+}
+
+// GetPortState returns the state of a port.
+func (proxy *Proxy) GetPortState(name string) model.PortState {
+	proxy.mtx.RLock()
+	p, ok := proxy.ports[name]
+	proxy.mtx.RUnlock()
+	if !ok {
+		return model.PortState{}
+	}
+
+	return p.getState()
 }
 
 func (proxy *Proxy) ProviderUserMiddleware(next http.Handler) http.Handler {
@@ -156,16 +243,8 @@ func (proxy *Proxy) ProviderUserMiddleware(next http.Handler) http.Handler {
 }
 
 func (proxy *Proxy) initPorts() {
-	var newPort *port
-	for k, v := range proxy.Config.Ports {
-		log := proxy.log.With().Str("port", k).Logger()
-		if v.IsRedirect {
-			newPort = newPortRedirect(proxy.ctx, v, log)
-		} else {
-			newPort = newPortProxy(proxy.ctx, v, log, proxy.Config.ProxyAccessLog, proxy.ProviderUserMiddleware)
-		}
-
-		proxy.log.Debug().Any("port", newPort).Msg("newport")
+	for k, v := range proxy.config.Ports {
+		newPort := proxy.newPort(k, v)
 
 		proxy.mtx.Lock()
 		proxy.ports[k] = newPort
@@ -173,44 +252,88 @@ func (proxy *Proxy) initPorts() {
 	}
 }
 
+// newPort creates the port of the configuration.
+// It must be called with the proxy lock held, or before the proxy is started.
+func (proxy *Proxy) newPort(name string, v model.PortConfig) *port {
+	var newPort *port
+
+	log := proxy.log.With().Str("port", name).Logger()
+	access := newAccessControl(proxy.config.Hostname, proxy.config.Access, v.Access)
+	stats := newPortMetrics(proxy.config.Hostname, name)
+	switch {
+	case v.IsRedirect:
+		newPort = newPortRedirect(proxy.ctx, v, log)
+	case v.ProxyProtocol == model.ProtocolTCP:
+		newPort = newPortStream(proxy.ctx, v, log, proxy.accessLog, access, stats, proxy.providerProxy.WhoisAddr)
+	case v.ProxyProtocol == model.ProtocolUDP:
+		newPort = newPortPacket(proxy.ctx, v, log, proxy.accessLog, access, stats, proxy.providerProxy.WhoisAddr)
+	default:
+		newPort = newPortProxy(proxy.ctx, v, log, proxy.accessLog, access, stats, proxy.ProviderUserMiddleware)
+	}
+
+	proxy.log.Debug().Any("port", newPort).Msg("newport")
+
+	newPort.onChange = func() {
+		proxy.portChanged(name)
+	}
+
+	return newPort
+}
+
 // Start method is a method that starts the proxy.
 func (proxy *Proxy) start() {
 	proxy.log.Info().Msg("starting proxy")
 
 	proxy.mtx.RLock()
-	portsConfig := proxy.Config.Ports
 	portsCount := len(proxy.ports)
 	proxy.mtx.RUnlock()
 
 	if portsCount == 0 {
 		proxy.log.Warn().Msg("No ports configured")
-		proxy.setStatus(model.ProxyStatusError)
+		proxy.setStatus(model.ProxyStatusError, "no ports configured", nil)
 
 		return
 	}
 
 	if err := proxy.providerProxy.Start(proxy.ctx); err != nil {
 		proxy.log.Error().Err(err).Msg("Error starting with proxy provider")
-		proxy.Close()
+		proxy.startFailed(err)
 		return
 	}
 
-	var l net.Listener
-	var err error
+	// ports changed from now on are started by Reconfigure
+	proxy.mtx.Lock()
+	proxy.started = true
+	portsConfig := proxy.config.Ports
+	proxy.mtx.Unlock()
 
-	for k := range portsConfig {
-		proxy.log.Debug().Str("port", k).Msg("Starting proxy port")
+	for k, v := range portsConfig {
+		proxy.listenPort(k, v)
+	}
+}
 
-		l, err = proxy.providerProxy.GetListener(k)
-		if err != nil {
-			proxy.log.Error().Err(err).Str("port", k).Msg("Error adding listener")
-			continue
-		}
+// listenPort gets the listener of the port from the proxy provider and starts the port.
+func (proxy *Proxy) listenPort(name string, v model.PortConfig) {
+	proxy.log.Debug().Str("port", name).Msg("Starting proxy port")
 
-		proxy.startPort(k, l)
+	if v.ProxyProtocol == model.ProtocolUDP {
+		// packet listeners are only available when the proxy is up
+		go proxy.startPacketPort(name, v)
+		return
 	}
+
+	l, err := proxy.providerProxy.GetListener(v)
+	if err != nil {
+		proxy.log.Error().Err(err).Str("port", name).Msg("Error adding listener")
+		proxy.portError(name, err)
+		return
+	}
+
+	proxy.startPort(name, l)
 }
 
+// startPort starts the port with the listener.
+// Errors only change the port state, the other ports keep running.
 func (proxy *Proxy) startPort(name string, l net.Listener) {
 	proxy.mtx.RLock()
 	defer proxy.mtx.RUnlock()
@@ -219,33 +342,125 @@ func (proxy *Proxy) startPort(name string, l net.Listener) {
 	if p, ok := proxy.ports[name]; ok {
 		go func() {
 			if err := p.startWithListener(l); err != nil {
-				proxy.log.Error().Err(err).Msg("error starting port")
-				proxy.setStatus(model.ProxyStatusError)
+				proxy.log.Error().Err(err).Str("port", name).Msg("error starting port")
 			}
 		}()
 	}
 }
 
+func (proxy *Proxy) startPacketPort(name string, v model.PortConfig) {
+	conn, err := proxy.providerProxy.GetPacketListener(v)
+	if err != nil {
+		proxy.log.Error().Err(err).Str("port", name).Msg("Error adding packet listener")
+		proxy.portError(name, err)
+		return
+	}
+
+	proxy.mtx.RLock()
+	p, ok := proxy.ports[name]
+	proxy.mtx.RUnlock()
+	if !ok {
+		conn.Close()
+		return
+	}
+
+	if err := p.startWithPacketConn(conn); err != nil {
+		proxy.log.Error().Err(err).Str("port", name).Msg("error starting port")
+	}
+}
+
+// portError sets the port state to error.
+func (proxy *Proxy) portError(name string, err error) {
+	proxy.mtx.RLock()
+	p, ok := proxy.ports[name]
+	proxy.mtx.RUnlock()
+	if ok {
+		p.setState(model.PortStatusError, nil, err)
+	}
+}
+
+// startFailed closes a proxy that failed to start, keeping it in the error
+// status to be retried.
+func (proxy *Proxy) startFailed(err error) {
+	proxy.cancel()
+	proxy.close(closedContext())
+
+	proxy.setStatus(model.ProxyStatusError, "error starting proxy provider", err)
+
+	if proxy.onStartError != nil {
+		proxy.onStartError(err)
+	}
+}
+
 // close method is a method that closes all listeners ans httpServer.
-func (proxy *Proxy) close() {
-	var errs error
-	proxy.log.Info().Str("name", proxy.Config.Hostname).Msg("stopping proxy")
+// The ports are drained until ctx is done, before the proxy context is
+// canceled. Only the first call closes the proxy.
+func (proxy *Proxy) close(ctx context.Context) {
+	proxy.mtx.Lock()
+	if proxy.closed {
+		proxy.mtx.Unlock()
+		return
+	}
+	proxy.closed = true
+	ports := slices.Collect(maps.Values(proxy.ports))
+	hostname := proxy.config.Hostname
+	proxy.mtx.Unlock()
 
-	for _, p := range proxy.ports {
-		errs = errors.Join(errs, p.close())
+	var (
+		errs   error
+		errMtx sync.Mutex
+		wg     sync.WaitGroup
+	)
+	proxy.log.Info().Str("name", hostname).Msg("stopping proxy")
+
+	// all ports stop accepting connections before draining
+	for _, p := range ports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.close(ctx); err != nil {
+				errMtx.Lock()
+				errs = errors.Join(errs, err)
+				errMtx.Unlock()
+			}
+		}()
 	}
+	wg.Wait()
+
+	proxy.cancel()
+
 	if proxy.providerProxy != nil {
-		errs = errors.Join(proxy.providerProxy.Close())
+		errs = errors.Join(errs, proxy.providerProxy.Close())
+	}
+	if proxy.accessLog != nil {
+		errs = errors.Join(errs, proxy.accessLogs.Release(hostname))
 	}
 
 	if errs != nil {
 		proxy.log.Error().Err(errs).Msg("Error stopping proxy")
 	}
 
-	proxy.log.Info().Str("name", proxy.Config.Hostname).Msg("proxy stopped")
+	proxy.log.Info().Str("name", hostname).Msg("proxy stopped")
 }
 
-func (proxy *Proxy) setStatus(status model.ProxyStatus) {
+// portChanged broadcasts the new state of a port and the health of its targets.
+func (proxy *Proxy) portChanged(name string) {
+	// ports of closed proxies are stopped with the proxy
+	if proxy.onUpdate == nil || proxy.ctx.Err() != nil {
+		return
+	}
+
+	proxy.onUpdate(model.ProxyEvent{
+		ID:        proxy.GetConfig().Hostname,
+		Port:      name,
+		Status:    proxy.GetStatus(),
+		PortState: proxy.GetPortState(name),
+		Targets:   proxy.GetPortHealth(name),
+	})
+}
+
+// setStatus changes the status of the proxy. reason and err describe why it changed.
+func (proxy *Proxy) setStatus(status model.ProxyStatus, reason string, err error) {
 	proxy.mtx.Lock()
 
 	if proxy.status == status {
@@ -254,12 +469,24 @@ func (proxy *Proxy) setStatus(status model.ProxyStatus) {
 	}
 
 	proxy.status = status
+	hostname := proxy.config.Hostname
+	proxy.timings.observe(hostname, status)
 	proxy.mtx.Unlock()
 
+	setProxyStatusMetric(hostname, status)
+
 	if proxy.onUpdate != nil {
-		proxy.onUpdate(model.ProxyEvent{
-			ID:     proxy.Config.Hostname,
+		event := model.ProxyEvent{
+			ID:     hostname,
 			Status: status,
-		})
+			Reason: reason,
+		}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		if status == model.ProxyStatusAuthenticating {
+			event.AuthURL = proxy.GetAuthURL()
+		}
+		proxy.onUpdate(event)
 	}
 }
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/rs/zerolog"
+)
+
+func TestGetLANHandlers(t *testing.T) {
+	redirect, err := model.NewPortLongLabel("80/http->https://app.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ports    model.PortConfigList
+		mainPort uint16
+		lanPorts []uint16
+		// want are the port names served by each LAN port
+		want        map[uint16]string
+		wantSkipped []string
+	}{
+		{
+			name: "main port serves 443",
+			ports: model.PortConfigList{
+				"443/https": testPort(t, "443/https", "http://app:8080"),
+				"80/http":   testPort(t, "80/http", "http://app:8081"),
+			},
+			mainPort:    443,
+			lanPorts:    []uint16{443},
+			want:        map[uint16]string{443: "443/https"},
+			wantSkipped: []string{"80/http"},
+		},
+		{
+			name: "extra port serves the same number",
+			ports: model.PortConfigList{
+				"443/https": testPort(t, "443/https", "http://app:8080"),
+				"80/http":   testPort(t, "80/http", "http://app:8081"),
+			},
+			mainPort: 443,
+			lanPorts: []uint16{443, 80},
+			want:     map[uint16]string{443: "443/https", 80: "80/http"},
+		},
+		{
+			name: "main port of another number",
+			ports: model.PortConfigList{
+				"443/https": testPort(t, "443/https", "http://app:8080"),
+				"80/http":   testPort(t, "80/http", "http://app:8081"),
+			},
+			mainPort:    8443,
+			lanPorts:    []uint16{8443},
+			want:        map[uint16]string{8443: "443/https"},
+			wantSkipped: []string{"80/http"},
+		},
+		{
+			name: "only HTTP port",
+			ports: model.PortConfigList{
+				"8080/http": testPort(t, "8080/http", "http://app:8080"),
+				"5432/tcp":  testPort(t, "5432/tcp", "tcp://db:5432"),
+			},
+			mainPort: 443,
+			lanPorts: []uint16{443},
+			want:     map[uint16]string{443: "8080/http"},
+		},
+		{
+			name: "several ports without 443",
+			ports: model.PortConfigList{
+				"8080/http": testPort(t, "8080/http", "http://app:8080"),
+				"9090/http": testPort(t, "9090/http", "http://app:9090"),
+			},
+			mainPort:    443,
+			lanPorts:    []uint16{443, 9090},
+			want:        map[uint16]string{9090: "9090/http"},
+			wantSkipped: []string{"8080/http"},
+		},
+		{
+			name: "redirect is not served",
+			ports: model.PortConfigList{
+				"443/https": testPort(t, "443/https", "http://app:8080"),
+				"80/http":   redirect,
+			},
+			mainPort: 443,
+			lanPorts: []uint16{443, 80},
+			want:     map[uint16]string{443: "443/https"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := NewProxy(zerolog.Nop(), testConfig(t, tt.ports), newTestProvider(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer proxy.Close("test")
+
+			// each handler answers with its port name
+			for name, p := range proxy.ports {
+				if p.handler != nil {
+					p.handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+						_, _ = io.WriteString(w, name)
+					})
+				}
+			}
+
+			handlers, skipped := proxy.GetLANHandlers(tt.mainPort, tt.lanPorts)
+
+			got := make(map[uint16]string, len(handlers))
+			for lanPort, h := range handlers {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				got[lanPort] = rec.Body.String()
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got handlers %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(skipped, tt.wantSkipped) {
+				t.Errorf("got skipped %v, want %v", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+const (
+	// proxyHeaderTLVTailscaleLogin is the custom v2 TLV type with the
+	// tailscale login name of the client.
+	proxyHeaderTLVTailscaleLogin = 0xE0
+
+	proxyHeaderV2Command = 0x21 // version 2, PROXY command
+	proxyHeaderV2Unspec  = 0x00
+	proxyHeaderV2TCP4    = 0x11
+	proxyHeaderV2TCP6    = 0x21
+)
+
+// proxyHeaderV2Signature is the signature of PROXY protocol v2 headers.
+var proxyHeaderV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+type clientAddrContextKey struct{}
+
+// buildProxyHeader returns the PROXY protocol header of a connection from src to dst.
+// src and dst are "ip:port" addresses; if any of them is invalid the header
+// reports an unknown connection.
+func buildProxyHeader(cfg model.ProxyHeader, src, dst string, loginName string) []byte {
+	srcAddr, srcErr := netip.ParseAddrPort(src)
+	dstAddr, dstErr := netip.ParseAddrPort(dst)
+	known := srcErr == nil && dstErr == nil
+
+	if known {
+		srcAddr, dstAddr = sameFamily(srcAddr, dstAddr)
+	}
+
+	if cfg.Version == 1 {
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		proto := "TCP4"
+		if srcAddr.Addr().Is6() {
+			proto = "TCP6"
+		}
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n",
+			proto, srcAddr.Addr(), dstAddr.Addr(), srcAddr.Port(), dstAddr.Port())
+	}
+
+	family := byte(proxyHeaderV2Unspec)
+	var body []byte
+	if known {
+		family = proxyHeaderV2TCP4
+		if srcAddr.Addr().Is6() {
+			family = proxyHeaderV2TCP6
+		}
+		body = append(body, srcAddr.Addr().AsSlice()...)
+		body = append(body, dstAddr.Addr().AsSlice()...)
+		body = binary.BigEndian.AppendUint16(body, srcAddr.Port())
+		body = binary.BigEndian.AppendUint16(body, dstAddr.Port())
+	}
+
+	if cfg.TailscaleTLV && loginName != "" {
+		body = append(body, proxyHeaderTLVTailscaleLogin)
+		body = binary.BigEndian.AppendUint16(body, uint16(len(loginName))) //nolint:gosec
+		body = append(body, loginName...)
+	}
+
+	header := make([]byte, 0, len(proxyHeaderV2Signature)+4+len(body)) //nolint:mnd
+	header = append(header, proxyHeaderV2Signature...)
+	header = append(header, proxyHeaderV2Command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(body))) //nolint:gosec
+	header = append(header, body...)
+
+	return header
+}
+
+// sameFamily converts both addresses to IPv6 if they don't share the same family.
+func sameFamily(src, dst netip.AddrPort) (netip.AddrPort, netip.AddrPort) {
+	src = netip.AddrPortFrom(src.Addr().Unmap(), src.Port())
+	dst = netip.AddrPortFrom(dst.Addr().Unmap(), dst.Port())
+
+	if src.Addr().Is4() == dst.Addr().Is4() {
+		return src, dst
+	}
+
+	return netip.AddrPortFrom(netip.AddrFrom16(src.Addr().As16()), src.Port()),
+		netip.AddrPortFrom(netip.AddrFrom16(dst.Addr().As16()), dst.Port())
+}
+
+// writeProxyHeader sends the PROXY protocol header of client to the upstream connection.
+func writeProxyHeader(upstream net.Conn, cfg model.ProxyHeader, client net.Conn, loginName string) error {
+	_, err := upstream.Write(buildProxyHeader(cfg, client.RemoteAddr().String(), client.LocalAddr().String(), loginName))
+	return err
+}
+
+// withClientAddr stores the client address in the request context, to be used
+// in the PROXY protocol header of the upstream connection.
+func withClientAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientAddrContextKey{}, r.RemoteAddr)))
+	})
+}
+
+// proxyHeaderDialContext returns a dial function that sends the PROXY protocol
+// header of the client of the request on each new upstream connection.
+func proxyHeaderDialContext(cfg model.ProxyHeader) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		src, _ := ctx.Value(clientAddrContextKey{}).(string)
+		dst := ""
+		if localAddr, ok := ctx.Value(http.LocalAddrContextKey).(net.Addr); ok {
+			dst = localAddr.String()
+		}
+		who, _ := model.WhoisFromContext(ctx)
+
+		if _, err := conn.Write(buildProxyHeader(cfg, src, dst, who.Username)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error writing proxy protocol header: %w", err)
+		}
+
+		return conn, nil
+	}
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+// v2Header returns a PROXY protocol v2 header with the signature, command,
+// family and length of body.
+func v2Header(family byte, body ...[]byte) []byte {
+	b := slices.Concat(body...)
+	return slices.Concat(proxyHeaderV2Signature, []byte{proxyHeaderV2Command, family, byte(len(b) >> 8), byte(len(b))}, b)
+}
+
+func TestBuildProxyHeader(t *testing.T) {
+	v1 := model.ProxyHeader{Version: 1}
+	v2 := model.ProxyHeader{Version: 2}
+	v2TLV := model.ProxyHeader{Version: 2, TailscaleTLV: true}
+
+	addrs4 := []byte{100, 64, 0, 1, 192, 168, 1, 10, 0xC3, 0x50, 0x01, 0xBB}
+	tlv := []byte{proxyHeaderTLVTailscaleLogin, 0x00, 0x10}
+	tlv = append(tlv, "user@example.com"...)
+
+	tests := []struct {
+		name  string
+		cfg   model.ProxyHeader
+		src   string
+		dst   string
+		login string
+		want  []byte
+	}{
+		{
+			name: "v1 IPv4",
+			cfg:  v1,
+			src:  "100.64.0.1:50000",
+			dst:  "192.168.1.10:443",
+			want: []byte("PROXY TCP4 100.64.0.1 192.168.1.10 50000 443\r\n"),
+		},
+		{
+			name: "v1 IPv6",
+			cfg:  v1,
+			src:  "[fd7a:115c:a1e0::1]:50000",
+			dst:  "[fd7a:115c:a1e0::2]:443",
+			want: []byte("PROXY TCP6 fd7a:115c:a1e0::1 fd7a:115c:a1e0::2 50000 443\r\n"),
+		},
+		{
+			name: "v1 mixed families",
+			cfg:  v1,
+			src:  "100.64.0.1:50000",
+			dst:  "[fd7a:115c:a1e0::2]:443",
+			want: []byte("PROXY TCP6 ::ffff:100.64.0.1 fd7a:115c:a1e0::2 50000 443\r\n"),
+		},
+		{
+			name: "v1 IPv4-mapped addresses",
+			cfg:  v1,
+			src:  "[::ffff:100.64.0.1]:50000",
+			dst:  "192.168.1.10:443",
+			want: []byte("PROXY TCP4 100.64.0.1 192.168.1.10 50000 443\r\n"),
+		},
+		{
+			name: "v1 unknown",
+			cfg:  v1,
+			src:  "",
+			dst:  "192.168.1.10:443",
+			want: []byte("PROXY UNKNOWN\r\n"),
+		},
+		{
+			name: "v1 ignores login",
+			cfg:  model.ProxyHeader{Version: 1, TailscaleTLV: true},
+			src:  "100.64.0.1:50000",
+			dst:  "192.168.1.10:443",
+			want: []byte("PROXY TCP4 100.64.0.1 192.168.1.10 50000 443\r\n"),
+		},
+		{
+			name: "v2 IPv4",
+			cfg:  v2,
+			src:  "100.64.0.1:50000",
+			dst:  "192.168.1.10:443",
+			want: v2Header(proxyHeaderV2TCP4, addrs4),
+		},
+		{
+			name: "v2 IPv6",
+			cfg:  v2,
+			src:  "[fd7a:115c:a1e0::1]:50000",
+			dst:  "[fd7a:115c:a1e0::2]:443",
+			want: v2Header(proxyHeaderV2TCP6,
+				[]byte{0xfd, 0x7a, 0x11, 0x5c, 0xa1, 0xe0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+				[]byte{0xfd, 0x7a, 0x11, 0x5c, 0xa1, 0xe0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2},
+				[]byte{0xC3, 0x50, 0x01, 0xBB}),
+		},
+		{
+			name: "v2 unknown",
+			cfg:  v2,
+			src:  "invalid",
+			dst:  "192.168.1.10:443",
+			want: v2Header(proxyHeaderV2Unspec),
+		},
+		{
+			name:  "v2 without TLV",
+			cfg:   v2,
+			src:   "100.64.0.1:50000",
+			dst:   "192.168.1.10:443",
+			login: "user@example.com",
+			want:  v2Header(proxyHeaderV2TCP4, addrs4),
+		},
+		{
+			name:  "v2 tailscale login TLV",
+			cfg:   v2TLV,
+			src:   "100.64.0.1:50000",
+			dst:   "192.168.1.10:443",
+			login: "user@example.com",
+			want:  v2Header(proxyHeaderV2TCP4, addrs4, tlv),
+		},
+		{
+			name: "v2 TLV without login",
+			cfg:  v2TLV,
+			src:  "100.64.0.1:50000",
+			dst:  "192.168.1.10:443",
+			want: v2Header(proxyHeaderV2TCP4, addrs4),
+		},
+		{
+			name:  "v2 unknown with TLV",
+			cfg:   v2TLV,
+			src:   "",
+			dst:   "",
+			login: "user@example.com",
+			want:  v2Header(proxyHeaderV2Unspec, tlv),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildProxyHeader(tt.cfg, tt.src, tt.dst, tt.login)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got header %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
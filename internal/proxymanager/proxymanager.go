@@ -6,12 +6,14 @@ package proxymanager
 import (
 	"context"
 	"errors"
-	"fmt"
+	"maps"
 	"sync"
 
 	"github.com/rs/zerolog"
 
+	"github.com/almeidapaulopt/tsdproxy/internal/accesslog"
 	"github.com/almeidapaulopt/tsdproxy/internal/config"
+	"github.com/almeidapaulopt/tsdproxy/internal/dnsserver"
 	"github.com/almeidapaulopt/tsdproxy/internal/model"
 	"github.com/almeidapaulopt/tsdproxy/internal/proxyproviders"
 	"github.com/almeidapaulopt/tsdproxy/internal/proxyproviders/tailscale"
@@ -36,14 +38,25 @@ type (
 
 		statusSubscribers map[chan model.ProxyEvent]struct{}
 		lanListener       *lanListener
-
-		mtx sync.RWMutex
+		dnsServer         *dnsserver.Server
+		accessLogs        *accesslog.Manager
+		supervisor        *supervisor
+		history           *statusHistory
+		collisions        *hostnameCollisions
+		events            *eventQueue
+		// watchers cancels watching the events of each target provider
+		watchers map[string]context.CancelFunc
+
+		mtx      sync.RWMutex
+		startMtx sync.Mutex
 	}
 )
 
 var (
 	ErrProxyProviderNotFound  = errors.New("proxyProvider not found")
 	ErrTargetProviderNotFound = errors.New("targetProvider not found")
+	ErrProxyNotFound          = errors.New("proxy not found")
+	ErrProxyNotFailed         = errors.New("proxy did not fail to start")
 )
 
 // NewProxyManager function creates a new ProxyManager.
@@ -53,14 +66,30 @@ func NewProxyManager(logger zerolog.Logger) *ProxyManager {
 		TargetProviders:   make(TargetProviderList),
 		ProxyProviders:    make(ProxyProviderList),
 		statusSubscribers: make(map[chan model.ProxyEvent]struct{}),
+		history:           newStatusHistory(),
+		collisions:        newHostnameCollisions(),
+		watchers:          make(map[string]context.CancelFunc),
 		log:               logger.With().Str("module", "proxymanager").Logger(),
 	}
+	pm.events = newEventQueue(pm.HandleProxyEvent)
 
 	return pm
 }
 
 // Start method starts the ProxyManager.
 func (pm *ProxyManager) Start() {
+	accessLogs, err := accesslog.New(pm.log, config.Config.Load().Log.Access)
+	if err != nil {
+		pm.log.Error().Err(err).Msg("Error configuring access log, using general log")
+	}
+	pm.accessLogs = accessLogs
+
+	pm.supervisor = newSupervisor(pm.log, config.Config.Load().Retry, func(hostname string) {
+		if err := pm.RetryProxy(hostname); err != nil {
+			pm.log.Debug().Err(err).Str("proxy", hostname).Msg("Retry skipped")
+		}
+	})
+
 	// Add Providers
 	pm.addProxyProviders()
 	pm.addTargetProviders()
@@ -79,52 +108,107 @@ func (pm *ProxyManager) Start() {
 	if err := pm.startLANListener(); err != nil {
 		pm.log.Fatal().Err(err).Msg("Error starting LANListener")
 	}
+
+	if err := pm.startDNSServer(); err != nil {
+		pm.log.Error().Err(err).Msg("Error starting DNS server")
+	}
 }
 
 // StopAllProxies method shuts down all proxies.
-func (pm *ProxyManager) StopAllProxies() {
+// New connections are refused, and active requests and connections are
+// drained until ctx is done.
+func (pm *ProxyManager) StopAllProxies(ctx context.Context) {
 	pm.log.Info().Msg("Shutdown all proxies")
-	if err := pm.stopLANListener(); err != nil {
-		pm.log.Error().Err(err).Msg("Error stopping LANListener")
+	pm.supervisor.stop()
+
+	// stop watching events, so no proxies are started while stopping
+	pm.mtx.Lock()
+	for name, cancel := range pm.watchers {
+		cancel()
+		delete(pm.watchers, name)
 	}
+	pm.mtx.Unlock()
+	pm.events.wait()
+
 	wg := sync.WaitGroup{}
 
-	pm.mtx.RLock()
-	for id := range pm.Proxies {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := pm.stopLANListener(ctx); err != nil {
+			pm.log.Error().Err(err).Msg("Error stopping LANListener")
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := pm.stopDNSServer(ctx); err != nil {
+			pm.log.Error().Err(err).Msg("Error stopping DNS server")
+		}
+	}()
+
+	for _, proxy := range pm.proxies() {
 		wg.Add(1)
 		go func() {
-			pm.removeProxy(id)
-			wg.Done()
+			defer wg.Done()
+			pm.shutdownProxy(ctx, proxy.GetConfig().Hostname, "shutdown")
 		}()
 	}
-	pm.mtx.RUnlock()
 
 	wg.Wait()
+
+	if ctx.Err() != nil {
+		pm.log.Warn().Msg("Drain timeout expired, active connections were closed")
+	}
+
+	if err := pm.accessLogs.Close(); err != nil {
+		pm.log.Error().Err(err).Msg("Error closing access logs")
+	}
 }
 
 // WatchEvents method watches for events from all target providers.
 func (pm *ProxyManager) WatchEvents() {
-	for _, provider := range pm.TargetProviders {
-		go func(provider targetproviders.TargetProvider) {
-			ctx := context.Background()
-
-			eventsChan := make(chan targetproviders.TargetEvent)
-			errChan := make(chan error)
-			defer close(errChan)
-			defer close(eventsChan)
-
-			provider.WatchEvents(ctx, eventsChan, errChan)
-			for {
-				select {
-				case event := <-eventsChan:
-					go pm.HandleProxyEvent(event)
-				case err := <-errChan:
-					pm.log.Err(err).Msg("Error watching events")
-					return
+	pm.mtx.RLock()
+	providers := maps.Clone(pm.TargetProviders)
+	pm.mtx.RUnlock()
+
+	for name, provider := range providers {
+		pm.watchTargetProvider(name, provider)
+	}
+}
+
+// watchTargetProvider method watches for events from a target provider,
+// until the target provider is removed.
+func (pm *ProxyManager) watchTargetProvider(name string, provider targetproviders.TargetProvider) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	pm.mtx.Lock()
+	pm.watchers[name] = cancel
+	pm.mtx.Unlock()
+
+	go func() {
+		eventsChan := make(chan targetproviders.TargetEvent)
+		errChan := make(chan error)
+
+		provider.WatchEvents(ctx, eventsChan, errChan)
+		for {
+			select {
+			case event := <-eventsChan:
+				targetProviderEventsTotal.WithLabelValues(name, event.Action.String()).Inc()
+				// events of the same target are processed in order
+				if dropped := pm.events.push(eventKey(name, event.ID), event); dropped > 0 {
+					targetProviderEventsCoalescedTotal.WithLabelValues(name).Add(float64(dropped))
 				}
+			case err := <-errChan:
+				targetProviderErrorsTotal.WithLabelValues(name).Inc()
+				pm.log.Err(err).Msg("Error watching events")
+				return
+			case <-ctx.Done():
+				return
 			}
-		}(provider)
-	}
+		}
+	}()
 }
 
 // HandleProxyEvent method handles events from a targetprovider
@@ -134,9 +218,13 @@ func (pm *ProxyManager) HandleProxyEvent(event targetproviders.TargetEvent) {
 		pm.eventStart(event)
 	case targetproviders.ActionStopProxy:
 		pm.eventStop(event)
-	case targetproviders.ActionRestartProxy:
-		pm.eventStop(event)
-		pm.eventStart(event)
+	case targetproviders.ActionRestartProxy,
+		targetproviders.ActionStartProt,
+		targetproviders.ActionStopPrort,
+		targetproviders.ActionRestartPort:
+		pm.eventReconfigure(event)
+	case targetproviders.ActionRetryProxy:
+		pm.eventRetry(event)
 	}
 }
 
@@ -176,6 +264,46 @@ func (pm *ProxyManager) GetProxy(name string) (*Proxy, bool) {
 	return proxy, ok
 }
 
+// GetStatusHistory returns the status transitions of a proxy, oldest first.
+// The history is kept after the proxy is removed.
+func (pm *ProxyManager) GetStatusHistory(name string) ([]model.StatusTransition, bool) {
+	return pm.history.get(name)
+}
+
+// GetRetryState returns the retries of a proxy that failed to start.
+func (pm *ProxyManager) GetRetryState(name string) (model.RetryState, bool) {
+	return pm.supervisor.state(name)
+}
+
+// RetryProxy recreates and starts a proxy that failed to start.
+// The retry is processed in order with the events of the target.
+func (pm *ProxyManager) RetryProxy(name string) error {
+	proxy, ok := pm.GetProxy(name)
+	if !ok {
+		return ErrProxyNotFound
+	}
+	if proxy.GetStatus() != model.ProxyStatusError {
+		return ErrProxyNotFailed
+	}
+
+	cfg := proxy.GetConfig()
+
+	pm.mtx.RLock()
+	provider, ok := pm.TargetProviders[cfg.TargetProvider]
+	pm.mtx.RUnlock()
+	if !ok {
+		return ErrTargetProviderNotFound
+	}
+
+	pm.events.push(eventKey(cfg.TargetProvider, cfg.TargetID), targetproviders.TargetEvent{
+		TargetProvider: provider,
+		ID:             cfg.TargetID,
+		Action:         targetproviders.ActionRetryProxy,
+	})
+
+	return nil
+}
+
 // broadcastStatusEvents broadcasts proxy status event to all SubscribeStatusEvents
 func (pm *ProxyManager) broadcastStatusEvents(event model.ProxyEvent) {
 	pm.mtx.RLock()
@@ -190,7 +318,7 @@ func (pm *ProxyManager) broadcastStatusEvents(event model.ProxyEvent) {
 
 // addTargetProviders method adds TargetProviders from configuration file.
 func (pm *ProxyManager) addTargetProviders() {
-	for name, provider := range config.Config.Docker {
+	for name, provider := range config.Config.Load().Docker {
 		p, err := docker.New(pm.log, name, provider)
 		if err != nil {
 			pm.log.Error().Err(err).Msg("Error creating Docker provider")
@@ -199,7 +327,7 @@ func (pm *ProxyManager) addTargetProviders() {
 
 		pm.addTargetProvider(p, name)
 	}
-	for name, file := range config.Config.Lists {
+	for name, file := range config.Config.Load().Lists {
 		p, err := list.New(pm.log, name, file)
 		if err != nil {
 			pm.log.Error().Err(err).Msg("Error creating Files provider")
@@ -214,7 +342,7 @@ func (pm *ProxyManager) addTargetProviders() {
 func (pm *ProxyManager) addProxyProviders() {
 	pm.log.Debug().Msg("Setting up Tailscale Providers")
 	// add Tailscale Providers
-	for name, provider := range config.Config.Tailscale.Providers {
+	for name, provider := range config.Config.Load().Tailscale.Providers {
 		if p, err := tailscale.New(pm.log, name, provider); err != nil {
 			pm.log.Error().Err(err).Msg("Error creating Tailscale provider")
 		} else {
@@ -245,11 +373,18 @@ func (pm *ProxyManager) addProxy(proxy *Proxy) {
 	pm.mtx.Lock()
 	defer pm.mtx.Unlock()
 
-	pm.Proxies[proxy.Config.Hostname] = proxy
+	pm.Proxies[proxy.GetConfig().Hostname] = proxy
 }
 
 // removeProxy method removes a Proxy from the ProxyManager.
-func (pm *ProxyManager) removeProxy(hostname string) {
+// reason describes why the proxy is removed.
+func (pm *ProxyManager) removeProxy(hostname, reason string) {
+	pm.shutdownProxy(closedContext(), hostname, reason)
+}
+
+// shutdownProxy method removes a Proxy from the ProxyManager, draining its
+// active connections until ctx is done.
+func (pm *ProxyManager) shutdownProxy(ctx context.Context, hostname, reason string) {
 	pm.mtx.RLock()
 	proxy, exists := pm.Proxies[hostname]
 	pm.mtx.RUnlock()
@@ -258,35 +393,75 @@ func (pm *ProxyManager) removeProxy(hostname string) {
 	}
 
 	pm.unregisterLANProxy(proxy)
-	proxy.Close()
+	proxy.Shutdown(ctx, reason)
 
 	pm.mtx.Lock()
 	defer pm.mtx.Unlock()
 
 	delete(pm.Proxies, hostname)
+	deleteProxyMetrics(hostname)
 
 	pm.log.Debug().Str("proxy", hostname).Msg("Removed proxy")
 }
 
 func (pm *ProxyManager) startLANListener() error {
-	if !config.Config.LAN.Enabled {
-		return nil
+	change, err := pm.prepareLANListener()
+	if err != nil {
+		return err
 	}
+	change.apply()
 
-	addr := fmt.Sprintf("%s:%d", config.Config.LAN.Hostname, config.Config.LAN.Port)
-	ll := newLANListener(pm.log, addr)
-	if err := ll.start(); err != nil {
-		return err
+	return nil
+}
+
+// prepareLANListener prepares the LAN listener of the current configuration,
+// without changing the running one. Applying it starts, reconfigures or stops
+// the LAN listener, and registers the proxies again.
+func (pm *ProxyManager) prepareLANListener() (listenerChange, error) {
+	cfg := config.Config.Load().LAN
+
+	pm.mtx.RLock()
+	ll := pm.lanListener
+	pm.mtx.RUnlock()
+
+	if !cfg.Enabled {
+		return listenerChange{
+			apply: func() {
+				if err := pm.stopLANListener(closedContext()); err != nil {
+					pm.log.Error().Err(err).Msg("Error stopping LANListener")
+				}
+			},
+			abort: func() {},
+		}, nil
 	}
 
-	pm.mtx.Lock()
-	pm.lanListener = ll
-	pm.mtx.Unlock()
+	if ll == nil {
+		ll = newLANListener(pm.log)
+	}
+	change, err := ll.prepare(cfg)
+	if err != nil {
+		return listenerChange{}, err
+	}
 
-	return nil
+	return listenerChange{
+		apply: func() {
+			change.apply()
+
+			pm.mtx.Lock()
+			pm.lanListener = ll
+			pm.mtx.Unlock()
+
+			for _, proxy := range pm.proxies() {
+				pm.registerLANProxy(proxy)
+			}
+		},
+		abort: change.abort,
+	}, nil
 }
 
-func (pm *ProxyManager) stopLANListener() error {
+// stopLANListener stops the LAN listener, draining its active requests
+// until ctx is done.
+func (pm *ProxyManager) stopLANListener(ctx context.Context) error {
 	pm.mtx.Lock()
 	ll := pm.lanListener
 	pm.lanListener = nil
@@ -296,29 +471,59 @@ func (pm *ProxyManager) stopLANListener() error {
 		return nil
 	}
 
-	return ll.close(context.Background())
+	return ll.close(ctx)
 }
 
-func (pm *ProxyManager) registerLANProxy(proxy *Proxy) error {
+// registerLANProxy registers a proxy on the LAN listener, and its records on
+// the DNS server. Proxies without endpoints for the LAN ports are skipped
+// with a warning.
+func (pm *ProxyManager) registerLANProxy(proxy *Proxy) {
 	pm.mtx.RLock()
 	ll := pm.lanListener
+	ds := pm.dnsServer
 	pm.mtx.RUnlock()
 	if ll == nil {
-		return nil
+		return
 	}
 
-	return ll.register(proxy)
+	if err := ll.register(proxy); err != nil {
+		pm.log.Warn().Err(err).Str("proxy", proxy.GetConfig().Hostname).Msg("Proxy skipped by LANListener")
+		if ds != nil {
+			ds.Remove(normalizeLANHostname(proxy.GetConfig().Hostname))
+		}
+		return
+	}
+
+	if ds != nil {
+		ds.Set(normalizeLANHostname(proxy.GetConfig().Hostname), proxyFQDN(proxy))
+	}
 }
 
-func (pm *ProxyManager) unregisterLANProxy(proxy *Proxy) {
+// GetLANRootCA returns the certificate of the local CA of the LAN listener,
+// in PEM format, if the LAN listener uses it.
+func (pm *ProxyManager) GetLANRootCA() ([]byte, bool) {
 	pm.mtx.RLock()
 	ll := pm.lanListener
 	pm.mtx.RUnlock()
 	if ll == nil {
-		return
+		return nil, false
 	}
 
-	ll.unregisterProxy(proxy)
+	return ll.rootCA()
+}
+
+func (pm *ProxyManager) unregisterLANProxy(proxy *Proxy) {
+	pm.mtx.RLock()
+	ll := pm.lanListener
+	ds := pm.dnsServer
+	pm.mtx.RUnlock()
+
+	if ds != nil {
+		ds.Remove(normalizeLANHostname(proxy.GetConfig().Hostname))
+	}
+	if ll != nil {
+		ll.unregisterProxy(proxy)
+	}
 }
 
 // eventStart method starts a Proxy from a event trigger
@@ -327,39 +532,157 @@ func (pm *ProxyManager) eventStart(event targetproviders.TargetEvent) {
 
 	pcfg, err := event.TargetProvider.AddTarget(event.ID)
 	if err != nil {
+		targetProviderErrorsTotal.WithLabelValues(pm.getTargetProviderName(event.TargetProvider)).Inc()
 		pm.log.Error().Err(err).Str("targetID", event.ID).Msg("Error adding target")
 		return
 	}
 
-	pm.newAndStartProxy(pcfg.Hostname, pcfg)
+	pm.startTarget(pcfg)
 }
 
 // eventStop method stops a Proxy from a event trigger
 func (pm *ProxyManager) eventStop(event targetproviders.TargetEvent) {
 	pm.log.Debug().Str("targetID", event.ID).Msg("Stopping target")
 
-	proxy := pm.getProxyByTargetID(event.ID)
+	providerName := pm.getTargetProviderName(event.TargetProvider)
+	waiting := pm.collisions.forget(providerName, event.ID)
+
+	proxy := pm.getProxyByTarget(providerName, event.ID)
 	if proxy == nil {
+		if waiting {
+			// the target was waiting for its hostname
+			_ = event.TargetProvider.DeleteProxy(event.ID)
+			return
+		}
 		pm.log.Error().Int("action", int(event.Action)).Str("target", event.ID).Msg("No proxy found for target")
 		return
 	}
 
-	targetprovider := pm.TargetProviders[proxy.Config.TargetProvider]
+	targetprovider, ok := pm.getTargetProvider(proxy.GetConfig().TargetProvider)
+	if !ok {
+		// the proxies of a removed target provider are removed with it
+		pm.log.Debug().Str("target", event.ID).Msg("Target provider of stopped target not found")
+		return
+	}
 	if err := targetprovider.DeleteProxy(event.ID); err != nil {
 		pm.log.Error().Err(err).Msg("No proxy found for target")
 		return
 	}
 
-	pm.removeProxy(proxy.Config.Hostname)
+	hostname := proxy.GetConfig().Hostname
+	pm.supervisor.reset(hostname)
+	pm.removeProxy(hostname, "target stopped")
+	pm.collisions.clear(hostname)
+	pm.releaseHostname(hostname)
+}
+
+// eventReconfigure method applies the new configuration of a target to its Proxy.
+// The Proxy is only recreated if the changes require a new proxy provider node.
+func (pm *ProxyManager) eventReconfigure(event targetproviders.TargetEvent) {
+	pm.log.Debug().Str("targetID", event.ID).Msg("Reconfiguring target")
+
+	proxy := pm.getProxyByTarget(pm.getTargetProviderName(event.TargetProvider), event.ID)
+	if proxy == nil {
+		pm.eventStart(event)
+		return
+	}
+
+	pcfg, err := event.TargetProvider.AddTarget(event.ID)
+	if err != nil {
+		targetProviderErrorsTotal.WithLabelValues(pm.getTargetProviderName(event.TargetProvider)).Inc()
+		pm.log.Error().Err(err).Str("targetID", event.ID).Msg("Error reconfiguring target")
+		return
+	}
+
+	// keep the hostname given by the suffix collision policy
+	if hostname, ok := pm.collisions.renamedHostname(pcfg); ok {
+		pcfg.Hostname = hostname
+	}
+
+	if needsRestart(proxy.GetConfig(), pcfg) {
+		hostname := proxy.GetConfig().Hostname
+		pm.log.Info().Str("proxy", hostname).Msg("Restarting proxy")
+		pm.supervisor.reset(hostname)
+		pm.removeProxy(hostname, "tailscale configuration changed")
+		pm.startTarget(pcfg)
+		if hostname != pcfg.Hostname {
+			pm.releaseHostname(hostname)
+		}
+		return
+	}
+
+	pm.log.Info().Str("proxy", proxy.GetConfig().Hostname).Msg("Reconfiguring proxy")
+	proxy.Reconfigure(pcfg, config.Config.Load().DrainTimeout)
+
+	// the LAN handler changes with the ports
+	pm.registerLANProxy(proxy)
 }
 
-// getProxyByTargetID method returns a Proxy by TargetID.
-func (pm *ProxyManager) getProxyByTargetID(targetID string) *Proxy {
+// eventRetry method recreates a Proxy that failed to start, with the latest
+// configuration of its target.
+func (pm *ProxyManager) eventRetry(event targetproviders.TargetEvent) {
+	proxy := pm.getProxyByTarget(pm.getTargetProviderName(event.TargetProvider), event.ID)
+	if proxy == nil || proxy.GetStatus() != model.ProxyStatusError {
+		// the target was stopped or restarted after the retry was requested
+		pm.log.Debug().Str("targetID", event.ID).Msg("Retry skipped")
+		return
+	}
+
+	hostname := proxy.GetConfig().Hostname
+	pm.supervisor.next(hostname)
+	state, _ := pm.supervisor.state(hostname)
+	pm.log.Info().Str("proxy", hostname).Int("attempt", state.Attempt).Msg("Retrying proxy")
+
+	pcfg, err := event.TargetProvider.AddTarget(event.ID)
+	if err != nil {
+		targetProviderErrorsTotal.WithLabelValues(pm.getTargetProviderName(event.TargetProvider)).Inc()
+		pm.log.Error().Err(err).Str("targetID", event.ID).Msg("Error retrying target")
+		pm.supervisor.failed(hostname, err)
+		return
+	}
+
+	// keep the hostname given by the suffix collision policy
+	if renamed, ok := pm.collisions.renamedHostname(pcfg); ok {
+		pcfg.Hostname = renamed
+	}
+
+	pm.removeProxy(hostname, "retrying after start failure")
+	pm.startTarget(pcfg)
+	if hostname != pcfg.Hostname {
+		pm.supervisor.reset(hostname)
+		pm.releaseHostname(hostname)
+	}
+}
+
+// getTargetProviderName method returns the name of a TargetProvider.
+func (pm *ProxyManager) getTargetProviderName(provider targetproviders.TargetProvider) string {
+	pm.mtx.RLock()
+	defer pm.mtx.RUnlock()
+
+	for name, p := range pm.TargetProviders {
+		if p == provider {
+			return name
+		}
+	}
+	return ""
+}
+
+// getTargetProvider returns a TargetProvider by name.
+func (pm *ProxyManager) getTargetProvider(name string) (targetproviders.TargetProvider, bool) {
+	pm.mtx.RLock()
+	defer pm.mtx.RUnlock()
+
+	provider, ok := pm.TargetProviders[name]
+	return provider, ok
+}
+
+// getProxyByTarget method returns a Proxy by TargetProvider name and TargetID.
+func (pm *ProxyManager) getProxyByTarget(targetProvider, targetID string) *Proxy {
 	pm.mtx.RLock()
 	defer pm.mtx.RUnlock()
 
 	for _, p := range pm.Proxies {
-		if p.Config.TargetID == targetID {
+		if cfg := p.GetConfig(); cfg.TargetProvider == targetProvider && cfg.TargetID == targetID {
 			return p
 		}
 	}
@@ -370,71 +693,90 @@ func (pm *ProxyManager) getProxyByTargetID(targetID string) *Proxy {
 func (pm *ProxyManager) newAndStartProxy(name string, proxyConfig *model.Config) {
 	pm.log.Debug().Str("proxy", name).Msg("Creating proxy")
 
-	proxyProvider, err := pm.getProxyProvider(proxyConfig)
+	providerName, proxyProvider, err := pm.getProxyProvider(proxyConfig)
 	if err != nil {
 		pm.log.Error().Err(err).Msg("Error to get ProxyProvider")
 		return
 	}
 
-	p, err := NewProxy(pm.log, proxyConfig, proxyProvider)
+	p, err := NewProxy(pm.log, proxyConfig, proxyProvider, pm.accessLogs)
 	if err != nil {
 		pm.log.Error().Err(err).Msg("Error creating proxy")
 		return
 	}
+	p.proxyProvider = providerName
 
 	// any status change in proxy will be broadcasted
 	p.onUpdate = func(event model.ProxyEvent) {
-		if event.Status == model.ProxyStatusRunning {
-			if err := pm.registerLANProxy(p); err != nil {
-				pm.log.Error().Err(err).Str("proxy", p.Config.Hostname).Msg("Error refreshing LANListener routes")
-			}
+		if event.Port == "" && event.Status == model.ProxyStatusRunning {
+			pm.supervisor.reset(name)
+			pm.registerLANProxy(p)
+		}
+		if event.Port == "" {
+			event.Retry, _ = pm.supervisor.state(name)
 		}
+		pm.history.record(event)
 		pm.broadcastStatusEvents(event)
 	}
 
-	if err := pm.registerLANProxy(p); err != nil {
-		pm.log.Fatal().Err(err).Str("proxy", name).Msg("Invalid proxy configuration for LANListener")
+	// failed proxies are retried by the supervisor
+	p.onStartError = func(err error) {
+		pm.broadcastStatusEvents(model.ProxyEvent{
+			ID:     name,
+			Status: model.ProxyStatusError,
+			Reason: "error starting proxy provider",
+			Error:  err.Error(),
+			Retry:  pm.supervisor.failed(name, err),
+		})
 	}
 
+	pm.registerLANProxy(p)
+
 	pm.addProxy(p)
 
 	// broadcasts ProxyStatusInitializing
-	pm.broadcastStatusEvents(model.ProxyEvent{
-		ID:     p.Config.Hostname,
+	p.onUpdate(model.ProxyEvent{
+		ID:     name,
 		Status: model.ProxyStatusInitializing,
+		Reason: "proxy created",
 	})
 
 	p.Start()
 }
 
-// getProxyProvider method returns a ProxyProvider.
-func (pm *ProxyManager) getProxyProvider(proxy *model.Config) (proxyproviders.Provider, error) {
+// getProxyProvider method returns a ProxyProvider and its name.
+func (pm *ProxyManager) getProxyProvider(proxy *model.Config) (string, proxyproviders.Provider, error) {
+	pm.mtx.RLock()
+	defer pm.mtx.RUnlock()
+
 	// return ProxyProvider defined in configurtion
 	//
 	if proxy.ProxyProvider != "" {
 		p, ok := pm.ProxyProviders[proxy.ProxyProvider]
 		if !ok {
-			return nil, ErrProxyProviderNotFound
+			return "", nil, ErrProxyProviderNotFound
 		}
-		return p, nil
+		return proxy.ProxyProvider, p, nil
 	}
 
 	// return default ProxyProvider defined in TargetProvider
 	targetProvider, ok := pm.TargetProviders[proxy.TargetProvider]
 	if !ok {
-		return nil, ErrTargetProviderNotFound
+		return "", nil, ErrTargetProviderNotFound
 	}
-	if p, ok := pm.ProxyProviders[targetProvider.GetDefaultProxyProviderName()]; ok {
-		return p, nil
+	name := targetProvider.GetDefaultProxyProviderName()
+	if p, ok := pm.ProxyProviders[name]; ok {
+		return name, p, nil
 	}
 
 	// return default ProxyProvider from global configurtion
 	//
-	if p, ok := pm.ProxyProviders[config.Config.DefaultProxyProvider]; ok {
-		return p, nil
+	name = config.Config.Load().DefaultProxyProvider
+	if p, ok := pm.ProxyProviders[name]; ok {
+		return name, p, nil
 	}
 
 	// return the first ProxyProvider
 	//
-	return nil, ErrProxyProviderNotFound
+	return "", nil, ErrProxyProviderNotFound
 }
@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"sync"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/targetproviders"
+)
+
+type (
+	// eventQueue processes the events of each target in order, one at a time.
+	// Events of different targets are processed concurrently.
+	eventQueue struct {
+		handle  func(event targetproviders.TargetEvent)
+		targets map[string]*targetQueue
+		wg      sync.WaitGroup
+		mtx     sync.Mutex
+	}
+
+	// targetQueue stores the pending events of a target.
+	// Pending events are coalesced to a stop followed by a start or a
+	// reconfigure, since the handlers read the latest target configuration.
+	targetQueue struct {
+		stop *targetproviders.TargetEvent
+		up   *targetproviders.TargetEvent
+	}
+)
+
+func newEventQueue(handle func(event targetproviders.TargetEvent)) *eventQueue {
+	return &eventQueue{
+		handle:  handle,
+		targets: make(map[string]*targetQueue),
+	}
+}
+
+// push adds an event of the target key to the queue, and starts processing
+// the target events if they aren't being processed yet.
+// Returns the number of pending events dropped by coalescing.
+func (q *eventQueue) push(key string, event targetproviders.TargetEvent) int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	t, running := q.targets[key]
+	if !running {
+		t = &targetQueue{}
+		q.targets[key] = t
+	}
+
+	dropped := t.add(event)
+
+	if !running {
+		q.wg.Add(1)
+		go q.run(key, t)
+	}
+
+	return dropped
+}
+
+// run processes the events of a target until there are no pending events.
+func (q *eventQueue) run(key string, t *targetQueue) {
+	defer q.wg.Done()
+
+	for {
+		q.mtx.Lock()
+		event, ok := t.pop()
+		if !ok {
+			delete(q.targets, key)
+			q.mtx.Unlock()
+			return
+		}
+		q.mtx.Unlock()
+
+		q.handle(event)
+	}
+}
+
+// wait waits until all pending events are processed.
+func (q *eventQueue) wait() {
+	q.wg.Wait()
+}
+
+// add adds an event to the pending events of the target.
+// Returns the number of pending events dropped.
+func (t *targetQueue) add(event targetproviders.TargetEvent) int {
+	switch event.Action {
+	case targetproviders.ActionStopProxy:
+		// a stop cancels everything before it
+		dropped := t.len()
+		t.stop = &event
+		t.up = nil
+		return dropped
+
+	case targetproviders.ActionStartProxy:
+		// a start restarts the proxy, replacing a pending reconfigure
+		dropped := 0
+		if t.up != nil {
+			dropped = 1
+		}
+		t.up = &event
+		return dropped
+
+	case targetproviders.ActionRetryProxy:
+		// a retry restarts the proxy too, unless a start is pending
+		if t.up != nil && t.up.Action == targetproviders.ActionStartProxy {
+			return 1
+		}
+		dropped := 0
+		if t.up != nil {
+			dropped = 1
+		}
+		t.up = &event
+		return dropped
+
+	default:
+		// a pending start or reconfigure will read the new configuration
+		if t.up != nil {
+			return 1
+		}
+		t.up = &event
+		return 0
+	}
+}
+
+// pop removes and returns the next pending event.
+func (t *targetQueue) pop() (targetproviders.TargetEvent, bool) {
+	if t.stop != nil {
+		event := *t.stop
+		t.stop = nil
+		return event, true
+	}
+	if t.up != nil {
+		event := *t.up
+		t.up = nil
+		return event, true
+	}
+	return targetproviders.TargetEvent{}, false
+}
+
+// len returns the number of pending events.
+func (t *targetQueue) len() int {
+	n := 0
+	if t.stop != nil {
+		n++
+	}
+	if t.up != nil {
+		n++
+	}
+	return n
+}
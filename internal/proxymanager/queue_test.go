@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/targetproviders"
+)
+
+const (
+	start       = targetproviders.ActionStartProxy
+	stop        = targetproviders.ActionStopProxy
+	restart     = targetproviders.ActionRestartProxy
+	startPort   = targetproviders.ActionStartProt
+	stopPort    = targetproviders.ActionStopPrort
+	restartPort = targetproviders.ActionRestartPort
+	retryProxy  = targetproviders.ActionRetryProxy
+)
+
+// recorder records the events handled by an eventQueue.
+type recorder struct {
+	events  map[string][]targetproviders.ActionType
+	running map[string]*atomic.Int32
+	// entered receives a value when the handler is called
+	entered chan struct{}
+	// block is received by the handler before handling each event, if set
+	block chan struct{}
+	delay time.Duration
+	t     *testing.T
+	mtx   sync.Mutex
+}
+
+func newRecorder(t *testing.T) *recorder {
+	return &recorder{
+		events:  make(map[string][]targetproviders.ActionType),
+		running: make(map[string]*atomic.Int32),
+		entered: make(chan struct{}, 1),
+		t:       t,
+	}
+}
+
+func (r *recorder) handle(event targetproviders.TargetEvent) {
+	r.mtx.Lock()
+	running, ok := r.running[event.ID]
+	if !ok {
+		running = &atomic.Int32{}
+		r.running[event.ID] = running
+	}
+	r.mtx.Unlock()
+
+	if running.Add(1) > 1 {
+		r.t.Errorf("events of target %s handled concurrently", event.ID)
+	}
+	defer running.Add(-1)
+
+	select {
+	case r.entered <- struct{}{}:
+	default:
+	}
+
+	if r.block != nil {
+		<-r.block
+	}
+	time.Sleep(r.delay)
+
+	r.mtx.Lock()
+	r.events[event.ID] = append(r.events[event.ID], event.Action)
+	r.mtx.Unlock()
+}
+
+func (r *recorder) get(id string) []targetproviders.ActionType {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return slices.Clone(r.events[id])
+}
+
+func testEvent(id string, action targetproviders.ActionType) targetproviders.TargetEvent {
+	return targetproviders.TargetEvent{ID: id, Action: action}
+}
+
+func TestTargetQueueCoalesce(t *testing.T) {
+	tests := []struct {
+		name    string
+		burst   []targetproviders.ActionType
+		want    []targetproviders.ActionType
+		dropped int
+	}{
+		{
+			name:  "start",
+			burst: []targetproviders.ActionType{start},
+			want:  []targetproviders.ActionType{start},
+		},
+		{
+			name:  "die and start",
+			burst: []targetproviders.ActionType{stop, start},
+			want:  []targetproviders.ActionType{stop, start},
+		},
+		{
+			name:    "start and die",
+			burst:   []targetproviders.ActionType{start, stop},
+			want:    []targetproviders.ActionType{stop},
+			dropped: 1,
+		},
+		{
+			name:    "flapping container",
+			burst:   []targetproviders.ActionType{stop, start, stop, start, stop, start},
+			want:    []targetproviders.ActionType{stop, start},
+			dropped: 4,
+		},
+		{
+			name:    "port changes",
+			burst:   []targetproviders.ActionType{startPort, restartPort, stopPort, restart},
+			want:    []targetproviders.ActionType{startPort},
+			dropped: 3,
+		},
+		{
+			name:    "start replaces reconfigure",
+			burst:   []targetproviders.ActionType{restart, start, restartPort},
+			want:    []targetproviders.ActionType{start},
+			dropped: 2,
+		},
+		{
+			name:    "retry replaces reconfigure",
+			burst:   []targetproviders.ActionType{restartPort, retryProxy},
+			want:    []targetproviders.ActionType{retryProxy},
+			dropped: 1,
+		},
+		{
+			name:    "start replaces retry",
+			burst:   []targetproviders.ActionType{retryProxy, start, retryProxy},
+			want:    []targetproviders.ActionType{start},
+			dropped: 2,
+		},
+		{
+			name:    "stop cancels retry",
+			burst:   []targetproviders.ActionType{retryProxy, stop},
+			want:    []targetproviders.ActionType{stop},
+			dropped: 1,
+		},
+		{
+			name:    "reconfigure after stop",
+			burst:   []targetproviders.ActionType{start, stop, restart},
+			want:    []targetproviders.ActionType{stop, restart},
+			dropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &targetQueue{}
+
+			dropped := 0
+			for _, action := range tt.burst {
+				dropped += q.add(testEvent("target", action))
+			}
+
+			var got []targetproviders.ActionType
+			for {
+				e, ok := q.pop()
+				if !ok {
+					break
+				}
+				got = append(got, e.Action)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got events %v, want %v", got, tt.want)
+			}
+			if dropped != tt.dropped {
+				t.Errorf("got %d dropped events, want %d", dropped, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestEventQueueBurst(t *testing.T) {
+	r := newRecorder(t)
+	r.block = make(chan struct{})
+	q := newEventQueue(r.handle)
+
+	// the first event is handled while the burst arrives
+	q.push("target", testEvent("target", start))
+	<-r.entered
+	for _, action := range []targetproviders.ActionType{stop, start, restart, stop, start, restartPort} {
+		q.push("target", testEvent("target", action))
+	}
+
+	close(r.block)
+	q.wait()
+
+	want := []targetproviders.ActionType{start, stop, start}
+	if got := r.get("target"); !slices.Equal(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+}
+
+func TestEventQueueOrder(t *testing.T) {
+	r := newRecorder(t)
+	r.delay = time.Millisecond
+	q := newEventQueue(r.handle)
+
+	// replay die and start pairs, every event is handled in order
+	for range 20 {
+		q.push("target", testEvent("target", stop))
+		q.wait()
+		q.push("target", testEvent("target", start))
+		q.wait()
+	}
+
+	got := r.get("target")
+	if len(got) != 40 {
+		t.Fatalf("got %d events, want 40", len(got))
+	}
+	for i, action := range got {
+		want := stop
+		if i%2 == 1 {
+			want = start
+		}
+		if action != want {
+			t.Fatalf("event %d is %v, want %v", i, action, want)
+		}
+	}
+}
+
+func TestEventQueueConcurrentBursts(t *testing.T) {
+	r := newRecorder(t)
+	r.delay = time.Millisecond
+	q := newEventQueue(r.handle)
+
+	targets := []string{"a", "b", "c", "d"}
+
+	var wg sync.WaitGroup
+	for _, id := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				q.push(id, testEvent(id, stop))
+				q.push(id, testEvent(id, start))
+				q.push(id, testEvent(id, restartPort))
+			}
+		}()
+	}
+	wg.Wait()
+	q.wait()
+
+	for _, id := range targets {
+		got := r.get(id)
+		if len(got) == 0 {
+			t.Fatalf("no events handled for target %s", id)
+		}
+		// the last event of each burst is handled after its stop
+		if last := got[len(got)-1]; last == stop {
+			t.Errorf("last event of target %s is %v", id, last)
+		}
+	}
+}
+
+func TestEventQueueTargetsAreIndependent(t *testing.T) {
+	blocked := make(chan struct{})
+	done := make(chan struct{})
+
+	q := newEventQueue(func(e targetproviders.TargetEvent) {
+		if e.ID == "slow" {
+			<-blocked
+			return
+		}
+		close(done)
+	})
+
+	q.push("slow", testEvent("slow", start))
+	q.push("fast", testEvent("fast", start))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event of a target waited for the event of another target")
+	}
+
+	close(blocked)
+	q.wait()
+}
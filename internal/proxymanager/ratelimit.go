@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterCleanupInterval is the interval to remove limiters of clients without requests.
+const rateLimiterCleanupInterval = 5 * time.Minute
+
+type (
+	// rateLimiter is a token bucket rate limiter of a port, keyed by
+	// Tailscale user, client IP or global.
+	rateLimiter struct {
+		log       zerolog.Logger
+		limiters  map[string]*rateLimiterEntry
+		key       string
+		limit     rate.Limit
+		burst     int
+		idle      time.Duration
+		throttled prometheus.Counter
+		mtx       sync.Mutex
+	}
+
+	rateLimiterEntry struct {
+		limiter *rate.Limiter
+		last    time.Time
+	}
+)
+
+// newRateLimiter returns a rateLimiter of the port configuration.
+// Rejected requests are counted in throttled.
+// Returns nil if rate limits are disabled.
+func newRateLimiter(ctx context.Context, log zerolog.Logger, cfg model.RateLimit, throttled prometheus.Counter) *rateLimiter {
+	if cfg.Requests <= 0 {
+		return nil
+	}
+
+	if cfg.Period <= 0 {
+		cfg.Period = model.DefaultRateLimitPeriod
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = cfg.Requests
+	}
+	if cfg.Key == "" {
+		cfg.Key = model.DefaultRateLimitKey
+	}
+
+	rl := &rateLimiter{
+		log:       log.With().Str("module", "ratelimit").Logger(),
+		limiters:  make(map[string]*rateLimiterEntry),
+		key:       cfg.Key,
+		limit:     rate.Limit(float64(cfg.Requests) / cfg.Period.Seconds()),
+		burst:     cfg.Burst,
+		throttled: throttled,
+	}
+
+	// keep limiters until their bucket is full again
+	rl.idle = max(rateLimiterCleanupInterval, time.Duration(float64(cfg.Burst)/float64(rl.limit)*float64(time.Second)))
+
+	go rl.cleanup(ctx)
+
+	return rl
+}
+
+// reserve takes a token of the client bucket. Returns the time to wait for
+// the next token if the client is over the limit.
+func (rl *rateLimiter) reserve(who model.Whois, remoteAddr string) (time.Duration, bool) {
+	key := rl.clientKey(who, remoteAddr)
+
+	rl.mtx.Lock()
+	entry, ok := rl.limiters[key]
+	if !ok {
+		entry = &rateLimiterEntry{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.limiters[key] = entry
+	}
+	entry.last = time.Now()
+	rl.mtx.Unlock()
+
+	res := entry.limiter.Reserve()
+	if delay := res.Delay(); delay > 0 {
+		res.Cancel()
+		rl.throttled.Inc()
+		rl.log.Debug().Str("key", key).Dur("retryAfter", delay).Msg("rate limit exceeded")
+		return delay, false
+	}
+
+	return 0, true
+}
+
+// allowed returns true if the client is under the limit.
+// A nil rateLimiter allows everything.
+func (rl *rateLimiter) allowed(who model.Whois, remoteAddr string) bool {
+	if rl == nil {
+		return true
+	}
+
+	_, ok := rl.reserve(who, remoteAddr)
+	return ok
+}
+
+// middleware answers with 429 Too Many Requests to clients over the limit.
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	if rl == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		who, _ := model.WhoisFromContext(r.Context())
+
+		if delay, ok := rl.reserve(who, r.RemoteAddr); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey returns the key of the client bucket.
+// Clients without Tailscale identity, like funnel clients, are limited by IP.
+func (rl *rateLimiter) clientKey(who model.Whois, remoteAddr string) string {
+	switch {
+	case rl.key == model.RateLimitGlobal:
+		return ""
+	case rl.key == model.RateLimitUser && who.Username != "":
+		return "user:" + who.Username
+	}
+
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		ip = remoteAddr
+	}
+	return "ip:" + ip
+}
+
+// cleanup removes the limiters of clients without requests until ctx is done.
+func (rl *rateLimiter) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(rateLimiterCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		rl.mtx.Lock()
+		for key, entry := range rl.limiters {
+			if time.Since(entry.last) > rl.idle {
+				delete(rl.limiters, key)
+			}
+		}
+		rl.mtx.Unlock()
+	}
+}
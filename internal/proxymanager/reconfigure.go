@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+// needsRestart returns true if the proxy of old must be recreated to apply
+// pcfg, because it changes the proxy provider node.
+func needsRestart(old, pcfg *model.Config) bool {
+	return old.Hostname != pcfg.Hostname ||
+		old.TargetProvider != pcfg.TargetProvider ||
+		old.ProxyProvider != pcfg.ProxyProvider ||
+		old.Tailscale != pcfg.Tailscale
+}
+
+// targetsChanged returns true if the ports differ only in their targets,
+// and the targets can be updated without restarting the port.
+func targetsChanged(old, cfg model.PortConfig) bool {
+	if old.IsRedirect || len(old.GetTargets()) == 0 || len(cfg.GetTargets()) == 0 {
+		return false
+	}
+
+	return reflect.DeepEqual(old.WithoutTargets(), cfg.WithoutTargets())
+}
+
+// Reconfigure applies a new configuration to a running proxy without
+// restarting its proxy provider node. Only the ports that changed are
+// added, removed or restarted, and ports where only the targets changed
+// keep their listeners and connections.
+// The active requests and connections of the restarted and removed ports
+// are drained until drainTimeout.
+// The new configuration must not require a restart, see needsRestart.
+func (proxy *Proxy) Reconfigure(pcfg *model.Config, drainTimeout time.Duration) {
+	proxy.mtx.Lock()
+
+	old := proxy.config
+	oldPorts := old.Ports
+
+	// access settings are used by all ports
+	restartAll := !reflect.DeepEqual(old.Access, pcfg.Access) ||
+		old.ProxyAccessLog != pcfg.ProxyAccessLog
+
+	if old.ProxyAccessLog != pcfg.ProxyAccessLog {
+		proxy.setAccessLog(pcfg.ProxyAccessLog)
+	}
+
+	// readers without the proxy lock keep the previous configuration
+	updated := *old
+	updated.Dashboard = pcfg.Dashboard
+	updated.Access = pcfg.Access
+	updated.ProxyAccessLog = pcfg.ProxyAccessLog
+	updated.Ports = pcfg.Ports
+	proxy.config = &updated
+
+	var (
+		stop    []*port
+		start   []string
+		removed []string
+	)
+
+	for name, old := range oldPorts {
+		cfg, ok := pcfg.Ports[name]
+		switch {
+		case !ok:
+			proxy.log.Info().Str("port", name).Msg("removing port")
+			stop = append(stop, proxy.ports[name])
+			removed = append(removed, name)
+			delete(proxy.ports, name)
+		case !restartAll && reflect.DeepEqual(old, cfg):
+		case !restartAll && targetsChanged(old, cfg):
+			proxy.ports[name].updateTargets(cfg)
+		default:
+			proxy.log.Info().Str("port", name).Msg("restarting port")
+			stop = append(stop, proxy.ports[name])
+			proxy.ports[name] = proxy.newPort(name, cfg)
+			start = append(start, name)
+		}
+	}
+
+	for name, cfg := range pcfg.Ports {
+		if _, ok := oldPorts[name]; !ok {
+			proxy.log.Info().Str("port", name).Msg("adding port")
+			proxy.ports[name] = proxy.newPort(name, cfg)
+			start = append(start, name)
+		}
+	}
+
+	started := proxy.started
+	hostname := proxy.config.Hostname
+	proxy.mtx.Unlock()
+
+	// listeners must be closed before listening again on the same port,
+	// the old ports are drained in the background
+	var drained sync.WaitGroup
+	for _, p := range stop {
+		if p == nil {
+			continue
+		}
+		if err := p.stopListening(); err != nil {
+			proxy.log.Error().Err(err).Msg("Error closing port listener")
+		}
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+
+			if err := p.close(ctx); err != nil {
+				proxy.log.Error().Err(err).Msg("Error stopping port")
+			}
+		}()
+	}
+
+	// metrics of the removed ports are kept until they are drained
+	if len(removed) > 0 {
+		go func() {
+			drained.Wait()
+			for _, name := range removed {
+				deletePortMetrics(hostname, name)
+			}
+		}()
+	}
+
+	// ports of proxies not started yet are started with the proxy
+	if !started {
+		return
+	}
+	for _, name := range start {
+		proxy.listenPort(name, pcfg.Ports[name])
+	}
+}
+
+// setAccessLog enables or disables the access log of the proxy.
+// It must be called with the proxy lock held.
+func (proxy *Proxy) setAccessLog(enabled bool) {
+	if enabled {
+		proxy.accessLog = proxy.accessLogs.Logger(proxy.log, proxy.config.Hostname)
+		return
+	}
+
+	if proxy.accessLog != nil {
+		if err := proxy.accessLogs.Release(proxy.config.Hostname); err != nil {
+			proxy.log.Error().Err(err).Msg("Error closing access log")
+		}
+		proxy.accessLog = nil
+	}
+}
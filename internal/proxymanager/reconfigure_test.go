@@ -0,0 +1,322 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+	"github.com/almeidapaulopt/tsdproxy/internal/proxyproviders"
+
+	"github.com/rs/zerolog"
+)
+
+type (
+	// testProvider is a proxy provider that listens on the loopback
+	// interface and records the port configurations it listened on.
+	testProvider struct {
+		listened map[int]model.PortConfig
+		events   chan model.ProxyEvent
+		mtx      sync.Mutex
+	}
+)
+
+var _ proxyproviders.ProxyInterface = (*testProvider)(nil)
+
+func newTestProvider() *testProvider {
+	return &testProvider{
+		listened: make(map[int]model.PortConfig),
+		events:   make(chan model.ProxyEvent),
+	}
+}
+
+func (p *testProvider) NewProxy(*model.Config) (proxyproviders.ProxyInterface, error) {
+	return p, nil
+}
+
+func (p *testProvider) Start(context.Context) error { return nil }
+func (p *testProvider) Close() error                { return nil }
+
+func (p *testProvider) GetListener(port model.PortConfig) (net.Listener, error) {
+	p.mtx.Lock()
+	p.listened[port.ProxyPort] = port
+	p.mtx.Unlock()
+
+	return net.Listen("tcp", "127.0.0.1:0")
+}
+
+func (p *testProvider) GetPacketListener(port model.PortConfig) (net.PacketConn, error) {
+	p.mtx.Lock()
+	p.listened[port.ProxyPort] = port
+	p.mtx.Unlock()
+
+	return net.ListenPacket("udp", "127.0.0.1:0")
+}
+
+func (p *testProvider) GetTLSCertificate(string) (*tls.Certificate, error) {
+	return nil, errors.New("no certificates")
+}
+
+func (p *testProvider) GetURL() string                                { return "https://app.example.ts.net" }
+func (p *testProvider) GetAuthURL() string                            { return "" }
+func (p *testProvider) WatchEvents() chan model.ProxyEvent            { return p.events }
+func (p *testProvider) Whois(*http.Request) model.Whois               { return model.Whois{} }
+func (p *testProvider) WhoisAddr(context.Context, string) model.Whois { return model.Whois{} }
+
+// waitListened waits until the provider listened on the port, and returns
+// its configuration.
+func (p *testProvider) waitListened(t *testing.T, proxyPort int, ok func(model.PortConfig) bool) model.PortConfig {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		p.mtx.Lock()
+		cfg, found := p.listened[proxyPort]
+		p.mtx.Unlock()
+		if found && ok(cfg) {
+			return cfg
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("provider didn't listen on port %d", proxyPort)
+	return model.PortConfig{}
+}
+
+// testPort returns an HTTP port configuration with the targets.
+func testPort(t *testing.T, label string, targets ...string) model.PortConfig {
+	t.Helper()
+
+	port, err := model.NewPortShortLabel(label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		port.AddTarget(u)
+	}
+	return port
+}
+
+// testConfig returns a proxy configuration with the ports.
+func testConfig(t *testing.T, ports model.PortConfigList) *model.Config {
+	t.Helper()
+
+	pcfg, err := model.NewConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcfg.Hostname = "app"
+	pcfg.TargetProvider = "test"
+	pcfg.TargetID = "app"
+	pcfg.Ports = ports
+	return pcfg
+}
+
+func TestReconfigurePorts(t *testing.T) {
+	provider := newTestProvider()
+
+	pcfg := testConfig(t, model.PortConfigList{
+		"443/https": testPort(t, "443/https", "http://app:8080"),
+	})
+	proxy, err := NewProxy(zerolog.Nop(), pcfg, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.Start()
+	defer proxy.Close("test")
+
+	provider.waitListened(t, 443, func(model.PortConfig) bool { return true })
+
+	funnel := testPort(t, "443/https", "http://app:8080")
+	funnel.Tailscale.Funnel = true
+	proxy.Reconfigure(testConfig(t, model.PortConfigList{
+		"443/https": funnel,
+		"80/http":   testPort(t, "80/http", "http://app:8081"),
+	}), time.Second)
+
+	// the changed port listens with its new configuration
+	provider.waitListened(t, 443, func(cfg model.PortConfig) bool { return cfg.Tailscale.Funnel })
+	// the added port is found by the provider
+	added := provider.waitListened(t, 80, func(model.PortConfig) bool { return true })
+	if added.ProxyProtocol != model.ProtocolHTTP {
+		t.Errorf("got protocol %s of the added port, want %s", added.ProxyProtocol, model.ProtocolHTTP)
+	}
+
+	if got := proxy.GetConfig().Ports; len(got) != 2 || !got["443/https"].Tailscale.Funnel {
+		t.Errorf("got ports %v after reconfigure", got)
+	}
+}
+
+func TestTargetsChanged(t *testing.T) {
+	base := testPort(t, "443/https", "http://app:8080")
+
+	weighted := testPort(t, "443/https", "http://app:8080", "http://app2:8080")
+	weighted.LoadBalancer.Weights = []int{1, 3}
+
+	leastConn := testPort(t, "443/https", "http://app:9090")
+	leastConn.LoadBalancer.Method = model.LoadBalancerLeastConn
+
+	tlsValidate := testPort(t, "443/https", "http://app:9090")
+	tlsValidate.TLSValidate = !tlsValidate.TLSValidate
+
+	redirect, err := model.NewPortLongLabel("80/http->https://app.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRedirect, err := model.NewPortLongLabel("80/http->https://other.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		old  model.PortConfig
+		cfg  model.PortConfig
+		want bool
+	}{
+		{
+			name: "target changed",
+			old:  base,
+			cfg:  testPort(t, "443/https", "http://app:9090"),
+			want: true,
+		},
+		{
+			name: "target added with weights",
+			old:  base,
+			cfg:  weighted,
+			want: true,
+		},
+		{
+			name: "load balancer method changed",
+			old:  base,
+			cfg:  leastConn,
+		},
+		{
+			name: "port setting changed",
+			old:  base,
+			cfg:  tlsValidate,
+		},
+		{
+			name: "targets removed",
+			old:  base,
+			cfg:  testPort(t, "443/https"),
+		},
+		{
+			name: "redirect",
+			old:  redirect,
+			cfg:  otherRedirect,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := targetsChanged(tt.old, tt.cfg); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	provider := newTestProvider()
+
+	pcfg := testConfig(t, model.PortConfigList{
+		"443/https": testPort(t, "443/https", "http://app:8080"),
+		"80/http":   testPort(t, "80/http", "http://app:8081"),
+	})
+	proxy, err := NewProxy(zerolog.Nop(), pcfg, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.Start()
+	defer proxy.Close("test")
+
+	provider.waitListened(t, 443, func(model.PortConfig) bool { return true })
+
+	tests := []struct {
+		name string
+		cfg  *model.Config
+		// kept are the ports that keep their listener
+		kept []string
+		want map[string][]string
+	}{
+		{
+			name: "targets updated in place",
+			cfg: testConfig(t, model.PortConfigList{
+				"443/https": testPort(t, "443/https", "http://app:9090", "http://app2:9090"),
+				"80/http":   testPort(t, "80/http", "http://app:8081"),
+			}),
+			kept: []string{"443/https", "80/http"},
+			want: map[string][]string{
+				"443/https": {"http://app:9090", "http://app2:9090"},
+				"80/http":   {"http://app:8081"},
+			},
+		},
+		{
+			name: "port removed",
+			cfg: testConfig(t, model.PortConfigList{
+				"443/https": testPort(t, "443/https", "http://app:9090", "http://app2:9090"),
+			}),
+			kept: []string{"443/https"},
+			want: map[string][]string{
+				"443/https": {"http://app:9090", "http://app2:9090"},
+			},
+		},
+		{
+			name: "access change restarts all ports",
+			cfg: func() *model.Config {
+				cfg := testConfig(t, model.PortConfigList{
+					"443/https": testPort(t, "443/https", "http://app:9090", "http://app2:9090"),
+				})
+				cfg.Access = model.Access{Allow: []string{"tag:admin"}}
+				return cfg
+			}(),
+			want: map[string][]string{
+				"443/https": {"http://app:9090", "http://app2:9090"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy.mtx.RLock()
+			before := maps.Clone(proxy.ports)
+			proxy.mtx.RUnlock()
+
+			proxy.Reconfigure(tt.cfg, time.Second)
+
+			proxy.mtx.RLock()
+			after := maps.Clone(proxy.ports)
+			proxy.mtx.RUnlock()
+
+			got := make(map[string][]string, len(after))
+			for name, p := range after {
+				for _, u := range p.lb.list() {
+					got[name] = append(got[name], u.url.String())
+				}
+				if kept := slices.Contains(tt.kept, name); kept != (before[name] == p) {
+					t.Errorf("got port %s kept %v, want %v", name, before[name] == p, kept)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got targets %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+	"github.com/almeidapaulopt/tsdproxy/internal/proxyproviders/tailscale"
+	"github.com/almeidapaulopt/tsdproxy/internal/targetproviders"
+	"github.com/almeidapaulopt/tsdproxy/internal/targetproviders/docker"
+	"github.com/almeidapaulopt/tsdproxy/internal/targetproviders/list"
+)
+
+// listenerChange is a prepared change of the LAN listener or the DNS server,
+// applied with apply or discarded with abort.
+type listenerChange struct {
+	apply func()
+	abort func()
+}
+
+// ApplyConfig applies the changes of a reloaded configuration.
+// Changed providers are recreated, and only the proxies that use them are
+// restarted. The new providers and listeners are prepared before anything is
+// changed, so nothing is applied if any of them fails.
+func (pm *ProxyManager) ApplyConfig(changes config.Changes) error {
+	proxyProviders, targetProviders, err := pm.newProviders(changes)
+	if err != nil {
+		return err
+	}
+
+	listeners, err := pm.prepareListeners(changes)
+	if err != nil {
+		for _, p := range targetProviders {
+			p.Close()
+		}
+		return err
+	}
+
+	if changes.Retry {
+		pm.supervisor.setConfig(config.Config.Load().Retry)
+	}
+	if changes.HostnameCollision {
+		pm.log.Info().Str("policy", config.Config.Load().HostnameCollision).Msg("Hostname collision policy changed")
+	}
+	if changes.DrainTimeout {
+		// read on shutdown
+		pm.log.Info().Dur("timeout", config.Config.Load().DrainTimeout).Msg("Drain timeout changed")
+	}
+
+	// proxy providers
+	pm.mtx.Lock()
+	for _, name := range changes.Tailscale.Removed {
+		delete(pm.ProxyProviders, name)
+	}
+	maps.Copy(pm.ProxyProviders, proxyProviders)
+	pm.mtx.Unlock()
+
+	// target providers are recreated with their proxies
+	for _, name := range slices.Concat(
+		changes.Docker.Removed, changes.Docker.Changed,
+		changes.Lists.Removed, changes.Lists.Changed) {
+		pm.log.Info().Str("provider", name).Msg("Removing target provider")
+		pm.removeTargetProvider(name)
+	}
+	for name, p := range targetProviders {
+		pm.log.Info().Str("provider", name).Msg("Adding target provider")
+		pm.addTargetProvider(p, name)
+		pm.watchTargetProvider(name, p)
+	}
+
+	// proxies are restarted if their proxy provider changed
+	changed := slices.Concat(changes.Tailscale.Removed, changes.Tailscale.Changed)
+	for _, proxy := range pm.proxies() {
+		name, _, err := pm.getProxyProvider(proxy.GetConfig())
+		if err != nil || name != proxy.proxyProvider || slices.Contains(changed, name) {
+			pm.log.Info().Str("proxy", proxy.GetConfig().Hostname).Msg("Proxy provider changed, restarting proxy")
+			pm.pushTargetEvent(proxy, targetproviders.ActionStartProxy)
+			continue
+		}
+
+		// Docker proxies read the access log default when they're configured
+		if changes.ProxyAccessLog && pm.isDockerTarget(proxy) {
+			pm.pushTargetEvent(proxy, targetproviders.ActionRestartProxy)
+		}
+	}
+
+	listeners.apply()
+
+	return nil
+}
+
+// prepareListeners prepares the changed LAN listener and DNS server.
+func (pm *ProxyManager) prepareListeners(changes config.Changes) (listenerChange, error) {
+	lan := listenerChange{apply: func() {}, abort: func() {}}
+	dns := lan
+
+	var err error
+	if changes.LAN {
+		if lan, err = pm.prepareLANListener(); err != nil {
+			return listenerChange{}, err
+		}
+	}
+	// the DNS server answers with the LAN listener address
+	if changes.LAN || changes.DNS {
+		if dns, err = pm.prepareDNSServer(); err != nil {
+			lan.abort()
+			return listenerChange{}, err
+		}
+	}
+
+	return listenerChange{
+		apply: func() {
+			lan.apply()
+			dns.apply()
+		},
+		abort: func() {
+			lan.abort()
+			dns.abort()
+		},
+	}, nil
+}
+
+// newProviders creates the added and changed providers of a reloaded
+// configuration. The created providers are closed if any of them fails.
+func (pm *ProxyManager) newProviders(changes config.Changes) (ProxyProviderList, TargetProviderList, error) {
+	cfg := config.Config.Load()
+	proxyProviders := make(ProxyProviderList)
+	targetProviders := make(TargetProviderList)
+
+	fail := func(err error) (ProxyProviderList, TargetProviderList, error) {
+		for _, p := range targetProviders {
+			p.Close()
+		}
+		return nil, nil, err
+	}
+
+	for _, name := range slices.Concat(changes.Tailscale.Added, changes.Tailscale.Changed) {
+		p, err := tailscale.New(pm.log, name, cfg.Tailscale.Providers[name])
+		if err != nil {
+			return fail(fmt.Errorf("error creating Tailscale provider %s: %w", name, err))
+		}
+		proxyProviders[name] = p
+	}
+
+	for _, name := range slices.Concat(changes.Docker.Added, changes.Docker.Changed) {
+		p, err := docker.New(pm.log, name, cfg.Docker[name])
+		if err != nil {
+			return fail(fmt.Errorf("error creating Docker provider %s: %w", name, err))
+		}
+		targetProviders[name] = p
+	}
+
+	for _, name := range slices.Concat(changes.Lists.Added, changes.Lists.Changed) {
+		p, err := list.New(pm.log, name, cfg.Lists[name])
+		if err != nil {
+			return fail(fmt.Errorf("error creating Files provider %s: %w", name, err))
+		}
+		targetProviders[name] = p
+	}
+
+	return proxyProviders, targetProviders, nil
+}
+
+// removeTargetProvider stops watching a target provider, and removes it with
+// its proxies.
+func (pm *ProxyManager) removeTargetProvider(name string) {
+	pm.mtx.Lock()
+	provider, ok := pm.TargetProviders[name]
+	cancel := pm.watchers[name]
+	delete(pm.TargetProviders, name)
+	delete(pm.watchers, name)
+	pm.mtx.Unlock()
+
+	if !ok {
+		return
+	}
+	if cancel != nil {
+		cancel()
+	}
+
+	// events received before are processed first
+	pm.events.wait()
+
+	pm.collisions.forgetProvider(name)
+	for _, proxy := range pm.proxies() {
+		if proxy.GetConfig().TargetProvider != name {
+			continue
+		}
+
+		hostname := proxy.GetConfig().Hostname
+		pm.supervisor.reset(hostname)
+		pm.removeProxy(hostname, "target provider removed")
+		pm.collisions.clear(hostname)
+		pm.releaseHostname(hostname)
+	}
+
+	provider.Close()
+}
+
+// pushTargetEvent recreates or reconfigures the proxy of a target, in order
+// with the events of the target.
+func (pm *ProxyManager) pushTargetEvent(proxy *Proxy, action targetproviders.ActionType) {
+	cfg := proxy.GetConfig()
+
+	pm.mtx.RLock()
+	provider, ok := pm.TargetProviders[cfg.TargetProvider]
+	pm.mtx.RUnlock()
+	if !ok {
+		return
+	}
+
+	pm.events.push(eventKey(cfg.TargetProvider, cfg.TargetID), targetproviders.TargetEvent{
+		TargetProvider: provider,
+		ID:             cfg.TargetID,
+		Action:         action,
+	})
+}
+
+// isDockerTarget returns true if the target of the proxy is a Docker container.
+func (pm *ProxyManager) isDockerTarget(proxy *Proxy) bool {
+	pm.mtx.RLock()
+	defer pm.mtx.RUnlock()
+
+	_, ok := pm.TargetProviders[proxy.GetConfig().TargetProvider].(*docker.Client)
+	return ok
+}
+
+// proxies returns the current proxies.
+func (pm *ProxyManager) proxies() []*Proxy {
+	pm.mtx.RLock()
+	defer pm.mtx.RUnlock()
+
+	return slices.Collect(maps.Values(pm.Proxies))
+}
+
+// eventKey returns the key of the events of a target in the event queue.
+func eventKey(targetProvider, targetID string) string {
+	return targetProvider + "/" + targetID
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"cmp"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+type (
+	// route is a port route with its own targets.
+	route struct {
+		lb      *balancer
+		handler http.Handler
+		cfg     model.Route
+	}
+
+	// router sends each request to the matching route with the longest path,
+	// or to the port targets if no route matches.
+	router struct {
+		fallback http.Handler
+		routes   []*route
+	}
+)
+
+// newRouter returns a router of the port routes. Requests are sent to next
+// with the upstream of the route in the context.
+// Returns nil if the port has no routes.
+func newRouter(pconfig model.PortConfig, lb *balancer, next http.Handler) *router {
+	if len(pconfig.Routes) == 0 {
+		return nil
+	}
+
+	rt := &router{}
+	if len(lb.upstreams) > 0 {
+		rt.fallback = lb.middleware(next)
+	}
+
+	for i, cfg := range pconfig.Routes {
+		lbConfig := pconfig.LoadBalancer
+		// weights are set by port target
+		lbConfig.Weights = nil
+
+		routeLB := newTargetsBalancer(lbConfig, cfg.GetTargets())
+		// each route has its own sticky session
+		routeLB.settings.cookieName += "_r" + strconv.Itoa(i)
+
+		rt.routes = append(rt.routes, &route{
+			cfg:     cfg,
+			lb:      routeLB,
+			handler: routeLB.middleware(rewritePath(cfg, next)),
+		})
+	}
+
+	// longest paths first, routes with the same path keep the configuration order
+	slices.SortStableFunc(rt.routes, func(a, b *route) int {
+		return cmp.Compare(len(b.cfg.Path), len(a.cfg.Path))
+	})
+
+	return rt
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range rt.routes {
+		if route.cfg.Match(r) {
+			route.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	if rt.fallback != nil {
+		rt.fallback.ServeHTTP(w, r)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// balancers returns the balancers of all routes.
+func (rt *router) balancers() []*balancer {
+	if rt == nil {
+		return nil
+	}
+
+	balancers := make([]*balancer, 0, len(rt.routes))
+	for _, route := range rt.routes {
+		balancers = append(balancers, route.lb)
+	}
+	return balancers
+}
+
+// rewritePath strips or replaces the route prefix of the request path.
+func rewritePath(cfg model.Route, next http.Handler) http.Handler {
+	if !cfg.StripPrefix && cfg.ReplacePrefix == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = cfg.RewritePath(r.URL.Path)
+		r2.URL.RawPath = ""
+
+		next.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+// testRoute returns a route to target.
+func testRoute(route model.Route, target string) model.Route {
+	u, _ := url.Parse(target)
+	route.AddTarget(u)
+	return route
+}
+
+func TestRouter(t *testing.T) {
+	routes := []model.Route{
+		testRoute(model.Route{Path: "/api"}, "http://api:8080"),
+		testRoute(model.Route{Path: "/api/v2/"}, "http://api-v2:8080"),
+		testRoute(model.Route{Path: "/admin", Methods: []string{"get"}, Headers: map[string]string{"X-Admin": "1"}}, "http://admin:8080"),
+		testRoute(model.Route{Path: "/static", StripPrefix: true}, "http://static:8080"),
+		testRoute(model.Route{Path: "/old", ReplacePrefix: "/new"}, "http://new:8080"),
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     http.Header
+		noFallback bool
+		wantTarget string
+		wantPath   string
+		wantStatus int
+	}{
+		{
+			name:       "route path",
+			path:       "/api",
+			wantTarget: "http://api:8080",
+			wantPath:   "/api",
+		},
+		{
+			name:       "inside route path",
+			path:       "/api/users",
+			wantTarget: "http://api:8080",
+			wantPath:   "/api/users",
+		},
+		{
+			name:       "longest path first",
+			path:       "/api/v2/users",
+			wantTarget: "http://api-v2:8080",
+			wantPath:   "/api/v2/users",
+		},
+		{
+			name:       "path prefix is not a route",
+			path:       "/apis",
+			wantTarget: "http://app:8080",
+			wantPath:   "/apis",
+		},
+		{
+			name:       "method and headers",
+			method:     http.MethodGet,
+			path:       "/admin/users",
+			header:     http.Header{"X-Admin": {"1"}},
+			wantTarget: "http://admin:8080",
+			wantPath:   "/admin/users",
+		},
+		{
+			name:       "method not matched",
+			method:     http.MethodPost,
+			path:       "/admin/users",
+			header:     http.Header{"X-Admin": {"1"}},
+			wantTarget: "http://app:8080",
+			wantPath:   "/admin/users",
+		},
+		{
+			name:       "header not matched",
+			method:     http.MethodGet,
+			path:       "/admin/users",
+			wantTarget: "http://app:8080",
+			wantPath:   "/admin/users",
+		},
+		{
+			name:       "strip prefix",
+			path:       "/static/css/app.css",
+			wantTarget: "http://static:8080",
+			wantPath:   "/css/app.css",
+		},
+		{
+			name:       "strip whole path",
+			path:       "/static",
+			wantTarget: "http://static:8080",
+			wantPath:   "/",
+		},
+		{
+			name:       "replace prefix",
+			path:       "/old/page",
+			wantTarget: "http://new:8080",
+			wantPath:   "/new/page",
+		},
+		{
+			name:       "no route without port targets",
+			path:       "/other",
+			noFallback: true,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pconfig := model.PortConfig{Routes: routes}
+			if !tt.noFallback {
+				u, _ := url.Parse("http://app:8080")
+				pconfig.AddTarget(u)
+			}
+
+			var gotTarget, gotPath string
+			next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				if u, ok := upstreamFromContext(r.Context()); ok {
+					gotTarget = u.url.String()
+				}
+				gotPath = r.URL.Path
+			})
+			rt := newRouter(pconfig, newBalancer(pconfig), next)
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+			rt.ServeHTTP(rec, req)
+
+			wantStatus := tt.wantStatus
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if rec.Code != wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, wantStatus)
+			}
+			if gotTarget != tt.wantTarget {
+				t.Errorf("got target %q, want %q", gotTarget, tt.wantTarget)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("got path %q, want %q", gotPath, tt.wantPath)
+			}
+		})
+	}
+}
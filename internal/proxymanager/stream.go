@@ -0,0 +1,334 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/accesslog"
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+const streamDialTimeout = 10 * time.Second
+
+type (
+	// streamServer proxies raw TCP connections to the port upstreams.
+	streamServer struct {
+		log         zerolog.Logger
+		ctx         context.Context
+		lb          *balancer
+		whois       func(ctx context.Context, remoteAddr string) model.Whois
+		access      *accessControl
+		rateLimiter *rateLimiter
+		stats       *portMetrics
+		listener    net.Listener
+		conns       map[net.Conn]struct{}
+		idleTimeout time.Duration
+		proxyHeader model.ProxyHeader
+		wg          sync.WaitGroup
+		mtx         sync.Mutex
+		accessLog   accesslog.Logger
+		closed      atomic.Bool
+	}
+
+	// closeWriter is implemented by connections that support half-close.
+	closeWriter interface {
+		CloseWrite() error
+	}
+
+	// activity tracks the last time a connection had traffic
+	// and counts the bytes read.
+	activity struct {
+		net.Conn
+		last  *atomic.Int64
+		bytes prometheus.Counter
+	}
+)
+
+func newPortStream(
+	ctx context.Context,
+	pconfig model.PortConfig,
+	log zerolog.Logger,
+	accessLog accesslog.Logger,
+	access *accessControl,
+	stats *portMetrics,
+	whoisFunc func(ctx context.Context, remoteAddr string) model.Whois,
+) *port {
+	ctxPort, cancel := context.WithCancel(ctx)
+
+	lb := newBalancer(pconfig)
+	rl := newRateLimiter(ctxPort, log, pconfig.RateLimit, stats.throttled)
+
+	server := &streamServer{
+		log:         log,
+		ctx:         ctxPort,
+		lb:          lb,
+		whois:       whoisFunc,
+		access:      access,
+		rateLimiter: rl,
+		stats:       stats,
+		idleTimeout: pconfig.IdleTimeout,
+		proxyHeader: pconfig.ProxyHeader,
+		accessLog:   accessLog,
+		conns:       make(map[net.Conn]struct{}),
+	}
+
+	p := &port{
+		log:         log,
+		ctx:         ctxPort,
+		cancel:      cancel,
+		server:      server,
+		lb:          lb,
+		rateLimiter: rl,
+	}
+
+	if pconfig.HealthCheck.Type != "" {
+		p.healthChecker = newHealthChecker(log, pconfig.HealthCheck, pconfig.TLSValidate, pconfig.ProxyHeader, p.changed)
+	}
+
+	return p
+}
+
+// Serve accepts connections from the listener until it's closed.
+func (s *streamServer) Serve(l net.Listener) error {
+	s.mtx.Lock()
+	s.listener = l
+	s.mtx.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.closed.Load() {
+				return net.ErrClosed
+			}
+			return err
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and waits for active connections to finish.
+// When ctx is done, remaining connections are closed.
+func (s *streamServer) Shutdown(ctx context.Context) error {
+	s.closed.Store(true)
+
+	s.mtx.Lock()
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.mtx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		if n := s.closeConns(); n > 0 {
+			s.log.Warn().Int("connections", n).Msg("Closing active connections")
+		}
+		<-done
+		return err
+	}
+}
+
+func (s *streamServer) handle(client net.Conn) {
+	s.stats.active.Inc()
+	defer s.stats.active.Dec()
+
+	start := time.Now()
+	remoteAddr := client.RemoteAddr().String()
+
+	log := s.log.With().Str("client", remoteAddr).Logger()
+	var who model.Whois
+	if s.whois != nil {
+		who = s.whois(s.ctx, remoteAddr)
+		log = log.With().Str("username", who.Username).Str("displayName", who.DisplayName).Logger()
+	}
+
+	if !s.access.allowed(who) {
+		log.Info().Str("node", who.NodeName).Msg("access denied")
+		client.Close()
+		return
+	}
+
+	if !s.rateLimiter.allowed(who, remoteAddr) {
+		log.Debug().Msg("rate limit exceeded, connection closed")
+		client.Close()
+		return
+	}
+
+	u := s.lb.choose()
+	if u == nil {
+		log.Error().Msg("no healthy target available")
+		client.Close()
+		return
+	}
+
+	log = log.With().Str("target", u.url.String()).Logger()
+
+	u.active.Add(1)
+	defer u.active.Add(-1)
+
+	dialCtx, cancel := context.WithTimeout(s.ctx, streamDialTimeout)
+	defer cancel()
+
+	var d net.Dialer
+	target, err := d.DialContext(dialCtx, "tcp", targetHostPort(u.url))
+	if err != nil {
+		log.Error().Err(err).Msg("upstream dial error")
+		client.Close()
+		return
+	}
+
+	if s.proxyHeader.Version != 0 {
+		if err := writeProxyHeader(target, s.proxyHeader, client, who.Username); err != nil {
+			log.Error().Err(err).Msg("error writing proxy protocol header")
+			client.Close()
+			target.Close()
+			return
+		}
+	}
+
+	s.track(client, true)
+	s.track(target, true)
+	defer s.track(client, false)
+	defer s.track(target, false)
+
+	log.Debug().Msg("stream connected")
+
+	sent, received := s.splice(client, target)
+
+	log.Debug().
+		Int64("bytesIn", sent).
+		Int64("bytesOut", received).
+		Dur("duration", time.Since(start)).
+		Msg("stream closed")
+
+	if s.accessLog != nil {
+		entry := connectionLogEntry(s.stats, "TCP", remoteAddr, who, start)
+		entry.Target = u.url.String()
+		entry.BytesIn = sent
+		entry.BytesOut = received
+		entry.Latency = time.Since(start)
+		s.accessLog.Log(entry)
+	}
+}
+
+// splice copies data in both directions until both sides are done or the
+// connection is idle for longer than idleTimeout.
+func (s *streamServer) splice(client, target net.Conn) (int64, int64) {
+	last := new(atomic.Int64)
+	last.Store(time.Now().UnixNano())
+
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2) //nolint:mnd
+
+	go func() {
+		defer wg.Done()
+		sent = pipe(target, &activity{Conn: client, last: last, bytes: s.stats.received})
+	}()
+	go func() {
+		defer wg.Done()
+		received = pipe(client, &activity{Conn: target, last: last, bytes: s.stats.sent})
+	}()
+
+	done := make(chan struct{})
+	if s.idleTimeout > 0 {
+		go s.watchIdle(last, done, client, target)
+	}
+
+	wg.Wait()
+	close(done)
+
+	client.Close()
+	target.Close()
+
+	return sent, received
+}
+
+// watchIdle closes the connections if there is no traffic for idleTimeout.
+func (s *streamServer) watchIdle(last *atomic.Int64, done chan struct{}, conns ...net.Conn) {
+	ticker := time.NewTicker(s.idleTimeout / 2) //nolint:mnd
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, last.Load())) >= s.idleTimeout {
+				s.log.Debug().Dur("idleTimeout", s.idleTimeout).Msg("closing idle stream")
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			}
+		}
+	}
+}
+
+func (s *streamServer) track(conn net.Conn, add bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if add {
+		s.conns[conn] = struct{}{}
+	} else {
+		delete(s.conns, conn)
+	}
+}
+
+// closeConns closes the active connections and returns how many were closed.
+func (s *streamServer) closeConns() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for c := range s.conns {
+		c.Close()
+	}
+
+	return len(s.conns)
+}
+
+// pipe copies src to dst and half-closes dst when src is done.
+func pipe(dst net.Conn, src io.Reader) int64 {
+	n, _ := io.Copy(dst, src)
+
+	if cw, ok := dst.(closeWriter); ok {
+		_ = cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+
+	return n
+}
+
+func (a *activity) Read(b []byte) (int, error) {
+	n, err := a.Conn.Read(b)
+	if n > 0 {
+		a.last.Store(time.Now().UnixNano())
+		a.bytes.Add(float64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// startEcho starts an upstream that echoes the data of each connection, and
+// half-closes it when the client is done writing.
+func startEcho(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+				_ = conn.(*net.TCPConn).CloseWrite()
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestStreamServer(t *testing.T) {
+	upstream := startEcho(t)
+
+	tests := []struct {
+		name        string
+		idleTimeout time.Duration
+		writes      []string
+		pause       time.Duration
+		closeWrite  bool
+		want        string
+		// wantIdle is true if the connection is closed by the idle timeout
+		wantIdle bool
+	}{
+		{
+			name:       "half-close",
+			writes:     []string{"hello", " world"},
+			closeWrite: true,
+			want:       "hello world",
+		},
+		{
+			name:        "idle timeout closes the connection",
+			idleTimeout: 50 * time.Millisecond,
+			wantIdle:    true,
+		},
+		{
+			name:        "traffic keeps the connection",
+			idleTimeout: 150 * time.Millisecond,
+			writes:      []string{"a", "b", "c", "d", "e"},
+			pause:       40 * time.Millisecond,
+			closeWrite:  true,
+			want:        "abcde",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pconfig := testPort(t, "5000/tcp", "tcp://"+upstream)
+			pconfig.IdleTimeout = tt.idleTimeout
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			p := newPortStream(ctx, pconfig, zerolog.Nop(), nil, nil, newPortMetrics("test", "5000/tcp"), nil)
+			server := p.server.(*streamServer)
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() { _ = server.Serve(l) }()
+			defer func() { _ = server.Shutdown(closedContext()) }()
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			start := time.Now()
+			for _, w := range tt.writes {
+				if _, err := conn.Write([]byte(w)); err != nil {
+					t.Fatalf("error writing: %v", err)
+				}
+				time.Sleep(tt.pause)
+			}
+			if tt.closeWrite {
+				if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			got, err := io.ReadAll(conn)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("connection wasn't closed")
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if tt.wantIdle && time.Since(start) < tt.idleTimeout {
+				t.Errorf("got connection closed after %s, want after %s", time.Since(start), tt.idleTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+
+	"github.com/rs/zerolog"
+)
+
+// maxBackoffShift limits the exponent of the backoff to avoid overflows.
+const maxBackoffShift = 30
+
+type (
+	// supervisor retries the proxies that failed to start, with exponential
+	// backoff and jitter.
+	supervisor struct {
+		log       zerolog.Logger
+		retries   map[string]*retry
+		retryFunc func(hostname string)
+		cfg       config.RetryConfig
+		mtx       sync.Mutex
+	}
+
+	// retry is the retry state of a proxy.
+	retry struct {
+		timer *time.Timer
+		state model.RetryState
+	}
+)
+
+func newSupervisor(log zerolog.Logger, cfg config.RetryConfig, retryFunc func(hostname string)) *supervisor {
+	return &supervisor{
+		log:       log.With().Str("module", "supervisor").Logger(),
+		cfg:       cfg,
+		retries:   make(map[string]*retry),
+		retryFunc: retryFunc,
+	}
+}
+
+// failed records a start failure of the proxy and schedules the next retry.
+// Returns the retry state of the proxy.
+func (s *supervisor) failed(hostname string, err error) model.RetryState {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	r, ok := s.retries[hostname]
+	if !ok {
+		r = &retry{}
+		s.retries[hostname] = r
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+
+	r.state.LastError = err.Error()
+	r.state.NextRetry = time.Time{}
+
+	log := s.log.With().Str("proxy", hostname).Int("attempt", r.state.Attempt).Logger()
+
+	if !s.cfg.Enabled {
+		return r.state
+	}
+	if s.cfg.MaxAttempts > 0 && r.state.Attempt >= s.cfg.MaxAttempts {
+		log.Error().Msg("proxy failed to start, giving up")
+		return r.state
+	}
+
+	delay := s.backoff(r.state.Attempt)
+	r.state.NextRetry = time.Now().Add(delay)
+	r.timer = time.AfterFunc(delay, func() {
+		s.retryFunc(hostname)
+	})
+
+	log.Info().Dur("delay", delay).Msg("proxy failed to start, retrying")
+
+	return r.state
+}
+
+// next records a new attempt to start the proxy and cancels the scheduled retry.
+func (s *supervisor) next(hostname string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	r, ok := s.retries[hostname]
+	if !ok {
+		r = &retry{}
+		s.retries[hostname] = r
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+
+	r.state.Attempt++
+	r.state.NextRetry = time.Time{}
+}
+
+// state returns the retry state of the proxy.
+func (s *supervisor) state(hostname string) (model.RetryState, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	r, ok := s.retries[hostname]
+	if !ok {
+		return model.RetryState{}, false
+	}
+	return r.state, true
+}
+
+// reset cancels the retries of the proxy, when it's running or removed.
+func (s *supervisor) reset(hostname string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if r, ok := s.retries[hostname]; ok {
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+		delete(s.retries, hostname)
+	}
+}
+
+// stop cancels all retries.
+func (s *supervisor) stop() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for hostname, r := range s.retries {
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+		delete(s.retries, hostname)
+	}
+}
+
+// setConfig changes the configuration of the next retries.
+func (s *supervisor) setConfig(cfg config.RetryConfig) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.cfg = cfg
+}
+
+// backoff returns the delay before the retry of attempt. The delay doubles
+// on each attempt up to MaxDelay, and half of it is random.
+func (s *supervisor) backoff(attempt int) time.Duration {
+	delay := s.cfg.MaxDelay
+	if attempt < maxBackoffShift {
+		if d := s.cfg.InitialDelay << attempt; d > 0 && d < delay {
+			delay = d
+		}
+	}
+
+	half := delay / 2
+	return half + rand.N(delay-half+1) //nolint:gosec
+}
@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSupervisorBackoff(t *testing.T) {
+	s := newSupervisor(zerolog.Nop(), config.RetryConfig{
+		Enabled:      true,
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+	}, nil)
+
+	tests := []struct {
+		name    string
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{
+			name:    "first attempt",
+			attempt: 0,
+			min:     500 * time.Millisecond,
+			max:     time.Second,
+		},
+		{
+			name:    "doubles",
+			attempt: 1,
+			min:     time.Second,
+			max:     2 * time.Second,
+		},
+		{
+			name:    "doubles again",
+			attempt: 3,
+			min:     4 * time.Second,
+			max:     8 * time.Second,
+		},
+		{
+			name:    "max delay",
+			attempt: 4,
+			min:     5 * time.Second,
+			max:     10 * time.Second,
+		},
+		{
+			name:    "shift overflow",
+			attempt: 100,
+			min:     5 * time.Second,
+			max:     10 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				if got := s.backoff(tt.attempt); got < tt.min || got > tt.max {
+					t.Fatalf("got delay %s, want between %s and %s", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestSupervisorFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RetryConfig
+		// attempts are the attempts to start the proxy before it failed
+		attempts  int
+		wantRetry bool
+	}{
+		{
+			name:      "retried",
+			cfg:       config.RetryConfig{Enabled: true, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			attempts:  1,
+			wantRetry: true,
+		},
+		{
+			name:     "disabled",
+			cfg:      config.RetryConfig{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			attempts: 1,
+		},
+		{
+			name:      "below max attempts",
+			cfg:       config.RetryConfig{Enabled: true, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxAttempts: 3},
+			attempts:  2,
+			wantRetry: true,
+		},
+		{
+			name:     "max attempts reached",
+			cfg:      config.RetryConfig{Enabled: true, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxAttempts: 3},
+			attempts: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retried := make(chan string, 1)
+			s := newSupervisor(zerolog.Nop(), tt.cfg, func(hostname string) { retried <- hostname })
+			defer s.stop()
+
+			for range tt.attempts {
+				s.next("app")
+			}
+			state := s.failed("app", errors.New("start error"))
+
+			if state.Attempt != tt.attempts {
+				t.Errorf("got attempt %d, want %d", state.Attempt, tt.attempts)
+			}
+			if state.LastError != "start error" {
+				t.Errorf("got last error %q, want %q", state.LastError, "start error")
+			}
+			if state.NextRetry.IsZero() == tt.wantRetry {
+				t.Errorf("got next retry %v, want retry %v", state.NextRetry, tt.wantRetry)
+			}
+
+			select {
+			case hostname := <-retried:
+				if !tt.wantRetry {
+					t.Errorf("got retry of %s, want none", hostname)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantRetry {
+					t.Error("proxy wasn't retried")
+				}
+			}
+
+			s.reset("app")
+			if _, ok := s.state("app"); ok {
+				t.Error("got retry state after reset")
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package proxymanager
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+// Span attributes added by the proxy.
+const (
+	attrProxy           = attribute.Key("tsdproxy.proxy")
+	attrPort            = attribute.Key("tsdproxy.port")
+	attrUserLogin       = attribute.Key("tailscale.user.login")
+	attrUserDisplayName = attribute.Key("tailscale.user.display_name")
+	attrNodeName        = attribute.Key("tailscale.node.name")
+	attrNodeTags        = attribute.Key("tailscale.node.tags")
+)
+
+// tracingMiddleware creates the server span of the requests of a port.
+// Incoming W3C trace context is used as the parent of the span.
+func tracingMiddleware(proxy, port string, next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, proxy,
+		otelhttp.WithSpanOptions(trace.WithAttributes(
+			attrProxy.String(proxy),
+			attrPort.String(port),
+		)),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + proxy
+		}),
+	)
+}
+
+// tracingTransport creates the upstream client span of the requests and
+// propagates the trace context to the upstream.
+func tracingTransport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " upstream"
+		}),
+	)
+}
+
+// tracingUserAttributes adds the tailnet user of the request to the server span.
+func tracingUserAttributes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		if who, ok := model.WhoisFromContext(r.Context()); ok && span.IsRecording() {
+			span.SetAttributes(
+				attrUserLogin.String(who.Username),
+				attrUserDisplayName.String(who.DisplayName),
+				attrNodeName.String(who.NodeName),
+				attrNodeTags.StringSlice(who.Tags),
+			)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -22,11 +22,15 @@ type (
 	ProxyInterface interface {
 		Start(context.Context) error
 		Close() error
-		GetListener(port string) (net.Listener, error)
+		// GetListener and GetPacketListener listen on the proxy port of a
+		// port configuration
+		GetListener(port model.PortConfig) (net.Listener, error)
+		GetPacketListener(port model.PortConfig) (net.PacketConn, error)
 		GetTLSCertificate(serverName string) (*tls.Certificate, error)
 		GetURL() string
 		GetAuthURL() string
 		WatchEvents() chan model.ProxyEvent
 		Whois(r *http.Request) model.Whois
+		WhoisAddr(ctx context.Context, remoteAddr string) model.Whois
 	}
 )
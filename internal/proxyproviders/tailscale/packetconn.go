@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package tailscale
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxPacketSize is the biggest UDP payload.
+const maxPacketSize = 65535
+
+type (
+	// dualPacketConn is a net.PacketConn bound to both tailscale IPs of the
+	// node. Packets of both conns are read by ReadFrom, and replies are sent
+	// through the conn of the client address family, the one that received
+	// the client packets.
+	dualPacketConn struct {
+		ip4      net.PacketConn
+		ip6      net.PacketConn
+		packets  chan packet
+		done     chan struct{}
+		deadline time.Time
+		once     sync.Once
+		mtx      sync.Mutex
+	}
+
+	// packet is a packet read from one of the conns.
+	packet struct {
+		addr net.Addr
+		err  error
+		data []byte
+	}
+)
+
+var _ net.PacketConn = (*dualPacketConn)(nil)
+
+func newDualPacketConn(ip4, ip6 net.PacketConn) *dualPacketConn {
+	c := &dualPacketConn{
+		ip4:     ip4,
+		ip6:     ip6,
+		packets: make(chan packet),
+		done:    make(chan struct{}),
+	}
+
+	go c.read(ip4)
+	go c.read(ip6)
+
+	return c
+}
+
+// read reads the packets of a conn until it's closed.
+func (c *dualPacketConn) read(conn net.PacketConn) {
+	for {
+		buf := make([]byte, maxPacketSize)
+		n, addr, err := conn.ReadFrom(buf)
+
+		select {
+		case c.packets <- packet{data: buf[:n], addr: addr, err: err}:
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *dualPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.mtx.Lock()
+	deadline := c.deadline
+	c.mtx.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case p := <-c.packets:
+		if p.err != nil {
+			return 0, nil, p.err
+		}
+		return copy(b, p.data), p.addr, nil
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	case <-c.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *dualPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if udpAddr, ok := addr.(*net.UDPAddr); ok && udpAddr.IP.To4() == nil {
+		return c.ip6.WriteTo(b, addr)
+	}
+	return c.ip4.WriteTo(b, addr)
+}
+
+func (c *dualPacketConn) Close() error {
+	err := net.ErrClosed
+	c.once.Do(func() {
+		close(c.done)
+		err = errors.Join(c.ip4.Close(), c.ip6.Close())
+	})
+	return err
+}
+
+func (c *dualPacketConn) LocalAddr() net.Addr {
+	return c.ip4.LocalAddr()
+}
+
+func (c *dualPacketConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *dualPacketConn) SetReadDeadline(t time.Time) error {
+	c.mtx.Lock()
+	c.deadline = t
+	c.mtx.Unlock()
+	return nil
+}
+
+func (c *dualPacketConn) SetWriteDeadline(t time.Time) error {
+	return errors.Join(c.ip4.SetWriteDeadline(t), c.ip6.SetWriteDeadline(t))
+}
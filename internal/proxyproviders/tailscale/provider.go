@@ -41,7 +41,7 @@ type (
 var _ proxyproviders.Provider = (*Client)(nil)
 
 func New(log zerolog.Logger, name string, provider *config.TailscaleServerConfig) (*Client, error) {
-	datadir := filepath.Join(config.Config.Tailscale.DataDir, name)
+	datadir := filepath.Join(config.Config.Load().Tailscale.DataDir, name)
 
 	return &Client{
 		log:          log.With().Str("tailscale", name).Logger(),
@@ -91,7 +91,6 @@ func (c *Client) NewProxy(config *model.Config) (proxyproviders.ProxyInterface,
 
 	return &Proxy{
 		log:      log,
-		config:   config,
 		tsServer: tserver,
 		events:   make(chan model.ProxyEvent),
 		certs:    make(map[string]*tls.Certificate),
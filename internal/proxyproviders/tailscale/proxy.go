@@ -9,6 +9,7 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,7 +26,6 @@ import (
 // Proxy struct implements proxyconfig.Proxy.
 type Proxy struct {
 	log      zerolog.Logger
-	config   *model.Config
 	tsServer *tsnet.Server
 	lc       *local.Client
 	ctx      context.Context
@@ -40,11 +40,7 @@ type Proxy struct {
 	mtx sync.Mutex
 }
 
-var (
-	_ proxyproviders.ProxyInterface = (*Proxy)(nil)
-
-	ErrProxyPortNotFound = errors.New("proxy port not found")
-)
+var _ proxyproviders.ProxyInterface = (*Proxy)(nil)
 
 // Start method implements proxyconfig.Proxy Start method.
 func (p *Proxy) Start(ctx context.Context) error {
@@ -85,27 +81,65 @@ func (p *Proxy) Close() error {
 	return nil
 }
 
-func (p *Proxy) GetListener(port string) (net.Listener, error) {
-	portCfg, ok := p.config.Ports[port]
-	if !ok {
-		return nil, ErrProxyPortNotFound
-	}
-
+// GetListener method implements proxyconfig.Proxy GetListener method.
+func (p *Proxy) GetListener(portCfg model.PortConfig) (net.Listener, error) {
 	network := portCfg.ProxyProtocol
-	if portCfg.ProxyProtocol == "http" || portCfg.ProxyProtocol == "https" {
-		network = "tcp"
+	if portCfg.IsHTTP() {
+		network = model.ProtocolTCP
 	}
 	addr := ":" + strconv.Itoa(portCfg.ProxyPort)
 
 	if portCfg.Tailscale.Funnel {
 		return p.tsServer.ListenFunnel(network, addr)
 	}
-	if portCfg.ProxyProtocol == "https" {
+	if portCfg.ProxyProtocol == model.ProtocolHTTPS {
 		return p.tsServer.ListenTLS(network, addr)
 	}
 	return p.tsServer.Listen(network, addr)
 }
 
+// GetPacketListener method implements proxyconfig.Proxy GetPacketListener method.
+// It waits until the tailscale node is up, since packet listeners must be bound
+// to the node tailscale IPs. When the node has both an IPv4 and an IPv6 address,
+// the port is bound to both.
+func (p *Proxy) GetPacketListener(portCfg model.PortConfig) (net.PacketConn, error) {
+	p.mtx.Lock()
+	ctx := p.ctx
+	p.mtx.Unlock()
+	if ctx == nil {
+		return nil, errors.New("tailscale proxy not started")
+	}
+
+	if _, err := p.tsServer.Up(ctx); err != nil {
+		return nil, err
+	}
+
+	var conns []net.PacketConn
+	ip4, ip6 := p.tsServer.TailscaleIPs()
+	for _, ip := range []netip.Addr{ip4, ip6} {
+		if !ip.IsValid() {
+			continue
+		}
+		conn, err := p.tsServer.ListenPacket(portCfg.ProxyProtocol, net.JoinHostPort(ip.String(), strconv.Itoa(portCfg.ProxyPort)))
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+
+	switch len(conns) {
+	case 0:
+		return nil, errors.New("tailscale IP not available")
+	case 1:
+		return conns[0], nil
+	default:
+		return newDualPacketConn(conns[0], conns[1]), nil
+	}
+}
+
 func (p *Proxy) WatchEvents() chan model.ProxyEvent {
 	return p.events
 }
@@ -153,17 +187,28 @@ func (p *Proxy) GetAuthURL() string {
 }
 
 func (p *Proxy) Whois(r *http.Request) model.Whois {
-	who, err := p.lc.WhoIs(r.Context(), r.RemoteAddr)
+	return p.WhoisAddr(r.Context(), r.RemoteAddr)
+}
+
+// WhoisAddr returns the identity of the tailscale node connecting from remoteAddr.
+func (p *Proxy) WhoisAddr(ctx context.Context, remoteAddr string) model.Whois {
+	who, err := p.lc.WhoIs(ctx, remoteAddr)
 	if err != nil {
 		return model.Whois{}
 	}
 
-	return model.Whois{
+	whois := model.Whois{
 		DisplayName:   who.UserProfile.DisplayName,
 		Username:      who.UserProfile.LoginName,
 		ID:            who.UserProfile.ID.String(),
 		ProfilePicURL: who.UserProfile.ProfilePicURL,
 	}
+	if who.Node != nil {
+		whois.NodeName = strings.TrimSuffix(who.Node.Name, ".")
+		whois.Tags = who.Node.Tags
+	}
+
+	return whois
 }
 
 func (p *Proxy) watchStatus() {
@@ -185,6 +230,11 @@ func (p *Proxy) watchStatus() {
 
 		if n.ErrMessage != nil {
 			p.log.Error().Str("error", *n.ErrMessage).Msg("tailscale.watchStatus: backend")
+			p.events <- model.ProxyEvent{
+				Status: model.ProxyStatusError,
+				Reason: "tailscale backend error",
+				Error:  *n.ErrMessage,
+			}
 			return
 		}
 
@@ -197,12 +247,12 @@ func (p *Proxy) watchStatus() {
 		switch status.BackendState {
 		case "NeedsLogin":
 			if status.AuthURL != "" {
-				p.setStatus(model.ProxyStatusAuthenticating, "", status.AuthURL)
+				p.setStatus(model.ProxyStatusAuthenticating, "", status.AuthURL, "tailscale login required")
 			}
 		case "Starting":
-			p.setStatus(model.ProxyStatusStarting, "", "")
+			p.setStatus(model.ProxyStatusStarting, "", "", "tailscale is starting")
 		case "Running":
-			p.setStatus(model.ProxyStatusRunning, strings.TrimRight(status.Self.DNSName, "."), "")
+			p.setStatus(model.ProxyStatusRunning, strings.TrimRight(status.Self.DNSName, "."), "", "connected to the tailnet")
 			if p.status != model.ProxyStatusRunning {
 				p.getTLSCertificates()
 			}
@@ -210,7 +260,7 @@ func (p *Proxy) watchStatus() {
 	}
 }
 
-func (p *Proxy) setStatus(status model.ProxyStatus, url string, authURL string) {
+func (p *Proxy) setStatus(status model.ProxyStatus, url string, authURL string, reason string) {
 	if p.status == status && p.url == url && p.authURL == authURL {
 		return
 	}
@@ -229,6 +279,7 @@ func (p *Proxy) setStatus(status model.ProxyStatus, url string, authURL string)
 
 	p.events <- model.ProxyEvent{
 		Status: status,
+		Reason: reason,
 	}
 }
 
@@ -18,6 +18,18 @@ const (
 	LabelContainerAccessLog = LabelPrefix + "containeraccesslog"
 	LabelProxyProvider      = LabelPrefix + "proxyprovider"
 	LabelPort               = LabelPrefix + "port."
+	// Access control, used as tsdproxy.access.allow or tsdproxy.port.<index>.access.allow
+	LabelAccessAllow = "access.allow"
+	LabelAccessDeny  = "access.deny"
+	// Routes, used as tsdproxy.port.<index>.route.<name>
+	LabelRoute = "route."
+	// Headers, used as tsdproxy.port.<index>.headers.<request|response>.<set|add|remove>[.<header>]
+	LabelHeaders         = "headers."
+	LabelHeadersRequest  = "request"
+	LabelHeadersResponse = "response"
+	LabelHeadersSet      = "set"
+	LabelHeadersAdd      = "add"
+	LabelHeadersRemove   = "remove"
 	// Tailscale
 	LabelEphemeral    = LabelPrefix + "ephemeral"
 	LabelRunWebClient = LabelPrefix + "runwebclient"
@@ -41,6 +53,9 @@ const (
 	// docker only defaults
 	DefaultTargetScheme = "http"
 
+	// hostname of targets defined by container port, ex: 8080/http
+	containerPortHostname = "0.0.0.0"
+
 	// auto detect
 	dialTimeout     = 2 * time.Second
 	autoDetectTries = 5
@@ -49,4 +64,24 @@ const (
 	// Port options
 	PortOptionNoTLSValidate   = "no_tlsvalidate"
 	PortOptionTailscaleFunnel = "tailscale_funnel"
+	// Port options with values, ex: healthcheck=http
+	PortOptionHealthCheck          = "healthcheck"
+	PortOptionHealthCheckPath      = "healthcheck_path"
+	PortOptionHealthCheckInterval  = "healthcheck_interval"
+	PortOptionHealthCheckTimeout   = "healthcheck_timeout"
+	PortOptionHealthCheckHealthy   = "healthcheck_healthy"
+	PortOptionHealthCheckUnhealthy = "healthcheck_unhealthy"
+	PortOptionIdleTimeout          = "idle_timeout"
+	PortOptionMaxSessions          = "max_sessions"
+	PortOptionProxyProtocol        = "proxy_protocol"
+	PortOptionProxyProtocolTLV     = "proxy_protocol_tlv"
+	PortOptionRateLimit            = "ratelimit"
+	PortOptionRateLimitBurst       = "ratelimit_burst"
+	PortOptionRateLimitKey         = "ratelimit_key"
+
+	// Route options
+	RouteOptionStripPrefix   = "strip_prefix"
+	RouteOptionReplacePrefix = "replace_prefix"
+	RouteOptionMethods       = "methods"
+	RouteOptionHeader        = "header"
 )
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/almeidapaulopt/tsdproxy/internal/config"
 	"github.com/almeidapaulopt/tsdproxy/internal/model"
 	"github.com/almeidapaulopt/tsdproxy/web"
 
@@ -143,9 +145,10 @@ func (c *container) newProxyConfig() (*model.Config, error) {
 	pcfg.TargetProvider = c.targetProviderName
 	pcfg.Tailscale = *tailscale
 	pcfg.ProxyProvider = c.getLabelString(LabelProxyProvider, model.DefaultProxyProvider)
-	pcfg.ProxyAccessLog = c.getLabelBool(LabelContainerAccessLog, model.DefaultProxyAccessLog)
+	pcfg.ProxyAccessLog = c.getLabelBool(LabelContainerAccessLog, config.Config.Load().ProxyAccessLog)
 	pcfg.Dashboard.Visible = c.getLabelBool(LabelDashboardVisible, model.DefaultDashboardVisible)
 	pcfg.Dashboard.Label = c.getLabelString(LabelDashboardLabel, pcfg.Hostname)
+	pcfg.Access = c.getLabelAccess(LabelPrefix)
 
 	pcfg.Dashboard.Icon = c.getLabelString(LabelDashboardIcon, "")
 	if pcfg.Dashboard.Icon == "" {
@@ -173,6 +176,11 @@ func (c *container) getPorts() model.PortConfigList {
 		if !strings.HasPrefix(k, LabelPort) {
 			continue
 		}
+		// skip port sub labels, ex: tsdproxy.port.1.access.allow
+		index := strings.TrimPrefix(k, LabelPort)
+		if strings.Contains(index, ".") {
+			continue
+		}
 
 		parts := strings.Split(v, ",")
 
@@ -183,15 +191,15 @@ func (c *container) getPorts() model.PortConfigList {
 		}
 
 		for _, v := range parts[1:] {
-			v = strings.TrimSpace(v)
-			switch v {
-			case PortOptionNoTLSValidate:
-				port.TLSValidate = false
-			case PortOptionTailscaleFunnel:
-				port.Tailscale.Funnel = true
+			if err := c.setPortOption(&port, strings.TrimSpace(v)); err != nil {
+				c.log.Warn().Err(err).Str("port", k).Str("option", v).Msg("invalid port option")
 			}
 		}
 
+		port.Access = c.getLabelAccess(LabelPort + index + ".")
+		port.Routes = c.getRoutes(LabelPort + index + "." + LabelRoute)
+		port.Headers = c.getHeaders(LabelPort + index + "." + LabelHeaders)
+
 		if !port.IsRedirect {
 			port, err = c.generateTargetFromFirstTarget(port)
 			if err == nil {
@@ -205,6 +213,99 @@ func (c *container) getPorts() model.PortConfigList {
 	return ports
 }
 
+// getRoutes method returns the routes from the labels with prefix, sorted by name.
+func (c *container) getRoutes(prefix string) []model.Route {
+	c.log.Trace().Msg("getRoutes")
+	defer c.log.Trace().Msg("End getRoutes")
+
+	var routes []model.Route
+	for k, v := range c.labels {
+		name, ok := strings.CutPrefix(k, prefix)
+		if !ok || name == "" {
+			continue
+		}
+
+		parts := strings.Split(v, ",")
+
+		route, err := model.NewRouteLabel(name, parts[0])
+		if err != nil {
+			c.log.Error().Err(err).Str("route", k).Msg("error creating route config")
+			continue
+		}
+
+		for _, v := range parts[1:] {
+			if err := c.setRouteOption(&route, strings.TrimSpace(v)); err != nil {
+				c.log.Warn().Err(err).Str("route", k).Str("option", v).Msg("invalid route option")
+			}
+		}
+
+		// targets defined by container port
+		for _, target := range route.GetTargets() {
+			if target.Hostname() != containerPortHostname {
+				continue
+			}
+			targetURL, err := c.getTargetURL(target)
+			if err != nil {
+				c.log.Error().Err(err).Str("route", k).Msg("error generating target")
+				continue
+			}
+			route.ReplaceTarget(target, targetURL)
+		}
+
+		routes = append(routes, route)
+	}
+
+	slices.SortFunc(routes, func(a, b model.Route) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return routes
+}
+
+// getHeaders method returns the header rules from the labels with prefix.
+func (c *container) getHeaders(prefix string) model.Headers {
+	var headers model.Headers
+
+	for k, v := range c.labels {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if !ok {
+			continue
+		}
+
+		parts := strings.SplitN(rest, ".", 3) //nolint:mnd
+
+		var rules *model.HeaderRules
+		switch parts[0] {
+		case LabelHeadersRequest:
+			rules = &headers.Request
+		case LabelHeadersResponse:
+			rules = &headers.Response
+		default:
+			c.log.Warn().Str("label", k).Msg("invalid headers label")
+			continue
+		}
+
+		switch {
+		case len(parts) == 2 && parts[1] == LabelHeadersRemove:
+			rules.Remove = append(rules.Remove, c.getLabelList(k)...)
+		case len(parts) == 3 && parts[1] == LabelHeadersSet: //nolint:mnd
+			if rules.Set == nil {
+				rules.Set = make(map[string]string)
+			}
+			rules.Set[parts[2]] = v
+		case len(parts) == 3 && parts[1] == LabelHeadersAdd: //nolint:mnd
+			if rules.Add == nil {
+				rules.Add = make(map[string]string)
+			}
+			rules.Add[parts[2]] = v
+		default:
+			c.log.Warn().Str("label", k).Msg("invalid headers label")
+		}
+	}
+
+	return headers
+}
+
 func (c *container) generateTargetFromFirstTarget(port model.PortConfig) (model.PortConfig, error) {
 	c.log.Trace().Msg("generateTargetFromFirstTarget")
 	defer c.log.Trace().Msg("End generateTargetFromFirstTarget")
@@ -276,8 +377,8 @@ func (c *container) getTargetURL(iPort *url.URL) (*url.URL, error) {
 		return url.Parse("http://127.0.0.1:" + internalPort)
 	}
 
-	// set autodetect
-	if c.autodetect {
+	// set autodetect, udp targets can't be detected with a tcp dial
+	if c.autodetect && iPort.Scheme != model.ProtocolUDP {
 		// repeat auto detect in case the container is not ready
 		for try := range autoDetectTries {
 			c.log.Info().Int("try", try).Msg("Trying to auto detect target URL")
@@ -152,7 +152,14 @@ func (c *Client) WatchEvents(ctx context.Context, eventsChan chan targetprovider
 				}
 
 			case err := <-dockererrChan:
+				// the provider was removed
+				if ctx.Err() != nil {
+					return
+				}
 				errChan <- err
+
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
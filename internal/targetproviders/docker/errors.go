@@ -19,4 +19,6 @@ var (
 	ErrNoPortFoundInContainer              = errors.New("no port found in container")
 	ErrNoValidTargetFoundForInternalPorts  = errors.New("no valid target found for internal ports")
 	ErrNoValidTargetFoundForPublishedPorts = errors.New("no valid target found for exposed ports")
+	ErrUnknownPortOption                   = errors.New("unknown port option")
+	ErrUnknownRouteOption                  = errors.New("unknown route option")
 )
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2025 Paulo Almeida <almeidapaulopt@gmail.com>
+// SPDX-License-Identifier: MIT
+
+package docker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
+)
+
+// setPortOption method applies a port option from the tsdproxy.port label.
+// Options are flags (ex: no_tlsvalidate) or key=value pairs (ex: healthcheck=http).
+func (c *container) setPortOption(port *model.PortConfig, option string) error {
+	key, value, _ := strings.Cut(option, "=")
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+
+	var err error
+
+	switch key {
+	case "":
+		return nil
+	case PortOptionNoTLSValidate:
+		port.TLSValidate = false
+	case PortOptionTailscaleFunnel:
+		port.Tailscale.Funnel = true
+
+	// health check
+	case PortOptionHealthCheck:
+		switch value {
+		case "", model.HealthCheckHTTP:
+			port.HealthCheck.Type = model.HealthCheckHTTP
+		case model.HealthCheckTCP:
+			port.HealthCheck.Type = model.HealthCheckTCP
+		default:
+			err = fmt.Errorf("unknown health check type %q", value)
+		}
+	case PortOptionHealthCheckPath:
+		port.HealthCheck.Path = value
+	case PortOptionHealthCheckInterval:
+		port.HealthCheck.Interval, err = time.ParseDuration(value)
+	case PortOptionHealthCheckTimeout:
+		port.HealthCheck.Timeout, err = time.ParseDuration(value)
+	case PortOptionHealthCheckHealthy:
+		port.HealthCheck.HealthyThreshold, err = strconv.Atoi(value)
+	case PortOptionHealthCheckUnhealthy:
+		port.HealthCheck.UnhealthyThreshold, err = strconv.Atoi(value)
+
+	// tcp streams and udp sessions
+	case PortOptionIdleTimeout:
+		port.IdleTimeout, err = time.ParseDuration(value)
+	case PortOptionMaxSessions:
+		port.MaxSessions, err = strconv.Atoi(value)
+
+	// PROXY protocol
+	case PortOptionProxyProtocol:
+		switch value {
+		case "v1", "1":
+			port.ProxyHeader.Version = 1
+		case "", "v2", "2":
+			port.ProxyHeader.Version = 2
+		default:
+			err = fmt.Errorf("unknown proxy protocol version %q", value)
+		}
+	case PortOptionProxyProtocolTLV:
+		port.ProxyHeader.TailscaleTLV = true
+
+	// rate limit
+	case PortOptionRateLimit:
+		var rl model.RateLimit
+		if rl, err = model.ParseRateLimit(value); err == nil {
+			port.RateLimit.Requests = rl.Requests
+			port.RateLimit.Period = rl.Period
+		}
+	case PortOptionRateLimitBurst:
+		port.RateLimit.Burst, err = strconv.Atoi(value)
+	case PortOptionRateLimitKey:
+		switch value {
+		case model.RateLimitUser, model.RateLimitIP, model.RateLimitGlobal:
+			port.RateLimit.Key = value
+		default:
+			err = fmt.Errorf("unknown rate limit key %q", value)
+		}
+
+	default:
+		return ErrUnknownPortOption
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// setRouteOption method applies a route option from the tsdproxy.port.<index>.route.<name> label.
+func (c *container) setRouteOption(route *model.Route, option string) error {
+	key, value, _ := strings.Cut(option, "=")
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "":
+		return nil
+	case RouteOptionStripPrefix:
+		route.StripPrefix = true
+	case RouteOptionReplacePrefix:
+		if !strings.HasPrefix(value, "/") {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		route.ReplacePrefix = value
+	case RouteOptionMethods:
+		for m := range strings.SplitSeq(value, "|") {
+			if m = strings.TrimSpace(m); m != "" {
+				route.Methods = append(route.Methods, strings.ToUpper(m))
+			}
+		}
+	case RouteOptionHeader:
+		name, headerValue, ok := strings.Cut(value, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		if route.Headers == nil {
+			route.Headers = make(map[string]string)
+		}
+		route.Headers[strings.TrimSpace(name)] = strings.TrimSpace(headerValue)
+	default:
+		return ErrUnknownRouteOption
+	}
+
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/almeidapaulopt/tsdproxy/internal/model"
 )
 
 // getLabelBool method returns a bool from a container label.
@@ -37,6 +39,26 @@ func (c *container) getLabelString(label string, defaultValue string) string {
 	return value
 }
 
+// getLabelList method returns a list from a comma separated container label.
+func (c *container) getLabelList(label string) []string {
+	var list []string
+	for v := range strings.SplitSeq(c.labels[label], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// getLabelAccess method returns the access rules from the allow and deny labels with prefix.
+func (c *container) getLabelAccess(prefix string) model.Access {
+	return model.Access{
+		Allow: c.getLabelList(prefix + LabelAccessAllow),
+		Deny:  c.getLabelList(prefix + LabelAccessDeny),
+	}
+}
+
 // getAuthKeyFromAuthFile method returns a auth key from a file.
 func (c *container) getAuthKeyFromAuthFile(authKey string) (string, error) {
 	authKeyFile, ok := c.labels[LabelAuthKeyFile]
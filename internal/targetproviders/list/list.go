@@ -9,7 +9,9 @@ import (
 	"maps"
 	"net/url"
 	"reflect"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/almeidapaulopt/tsdproxy/internal/config"
 	"github.com/almeidapaulopt/tsdproxy/internal/model"
@@ -41,13 +43,28 @@ type (
 		Ports         map[string]port `yaml:"ports"`
 		ProxyProvider string          `yaml:"proxyProvider"`
 		Tailscale     model.Tailscale `yaml:"tailscale"`
+		Access        model.Access    `validate:"dive" yaml:"access"`
 	}
 
 	port struct {
-		Targets     []string            `yaml:"targets,omitempty"`
-		Tailscale   model.TailscalePort `validate:"dive" yaml:"tailscale"`
-		IsRedirect  bool                `default:"false" validate:"boolean" yaml:"isRedirect,omitempty"`
-		TLSValidate bool                `validate:"boolean" default:"true" yaml:"tlsValidate"`
+		Targets      []string            `yaml:"targets,omitempty"`
+		Tailscale    model.TailscalePort `validate:"dive" yaml:"tailscale"`
+		LoadBalancer model.LoadBalancer  `validate:"dive" yaml:"loadBalancer,omitempty"`
+		HealthCheck  model.HealthCheck   `validate:"dive" yaml:"healthCheck,omitempty"`
+		IdleTimeout  time.Duration       `validate:"min=0" yaml:"idleTimeout,omitempty"`
+		MaxSessions  int                 `validate:"min=0" yaml:"maxSessions,omitempty"`
+		ProxyHeader  model.ProxyHeader   `validate:"dive" yaml:"proxyHeader,omitempty"`
+		Access       model.Access        `validate:"dive" yaml:"access,omitempty"`
+		Routes       []route             `validate:"dive" yaml:"routes,omitempty"`
+		Headers      model.Headers       `validate:"dive" yaml:"headers,omitempty"`
+		RateLimit    model.RateLimit     `validate:"dive" yaml:"rateLimit,omitempty"`
+		IsRedirect   bool                `default:"false" validate:"boolean" yaml:"isRedirect,omitempty"`
+		TLSValidate  bool                `validate:"boolean" default:"true" yaml:"tlsValidate"`
+	}
+
+	route struct {
+		model.Route `yaml:",inline"`
+		Targets     []string `yaml:"targets"`
 	}
 )
 
@@ -120,13 +137,10 @@ func (c *Client) GetDefaultProxyProviderName() string {
 	return c.config.DefaultProxyProvider
 }
 
+// Close stops watching the list file.
 func (c *Client) Close() {
-	for name := range c.proxies {
-		c.eventsChan <- targetproviders.TargetEvent{
-			ID:             name,
-			TargetProvider: c,
-			Action:         targetproviders.ActionStopProxy,
-		}
+	if err := c.file.Close(); err != nil {
+		c.log.Error().Err(err).Msg("error closing file watcher")
 	}
 }
 
@@ -179,6 +193,7 @@ func (c *Client) newProxyConfig(name string, p proxyConfig) (*model.Config, erro
 	pcfg.ProxyAccessLog = proxyAccessLog
 	pcfg.Ports = c.getPorts(p.Ports)
 	pcfg.Dashboard = p.Dashboard
+	pcfg.Access = p.Access
 
 	c.addTarget(p, name)
 
@@ -221,7 +236,8 @@ func (c *Client) onFileChange(e fsnotify.Event) {
 			}
 			continue
 		}
-		// restart if the proxy configuration changed
+		// reconfigure if the proxy configuration changed,
+		// the proxy manager only restarts what changed
 		//
 		if !reflect.DeepEqual(c.configProxies[name], oldConfigProxies[name]) {
 			c.eventsChan <- targetproviders.TargetEvent{
@@ -263,15 +279,56 @@ func (c *Client) getPorts(l map[string]port) model.PortConfigList {
 			port.AddTarget(targetURL)
 		}
 
-		if len(port.GetTargets()) == 0 {
+		port.Routes = c.getRoutes(k, v.Routes)
+
+		// ports with routes can have no targets
+		if len(port.GetTargets()) == 0 && len(port.Routes) == 0 {
 			c.log.Error().Str("port", k).Msg("no targets found for port")
 			continue
 		}
 
 		port.TLSValidate = v.TLSValidate
 		port.Tailscale = v.Tailscale
+		port.LoadBalancer = v.LoadBalancer
+		if slices.ContainsFunc(v.LoadBalancer.Weights, func(w int) bool { return w < 1 }) {
+			c.log.Error().Str("port", k).Ints("weights", v.LoadBalancer.Weights).Msg("Invalid target weights, must be at least 1")
+			continue
+		}
+		port.HealthCheck = v.HealthCheck
+		port.IdleTimeout = v.IdleTimeout
+		port.MaxSessions = v.MaxSessions
+		port.ProxyHeader = v.ProxyHeader
+		port.Access = v.Access
+		port.Headers = v.Headers
+		port.RateLimit = v.RateLimit
 
 		ports[k] = port
 	}
 	return ports
 }
+
+// getRoutes returns the routes of a port from the config
+func (c *Client) getRoutes(portName string, l []route) []model.Route {
+	routes := make([]model.Route, 0, len(l))
+	for _, v := range l {
+		r := v.Route
+
+		for _, target := range v.Targets {
+			targetURL, err := url.Parse(target)
+			if err != nil || targetURL.Scheme == "" || targetURL.Host == "" {
+				c.log.Error().Err(err).Str("port", portName).Str("route", r.Path).Str("targetUrl", target).Msg("Invalid target URL")
+				continue
+			}
+
+			r.AddTarget(targetURL)
+		}
+
+		if len(r.GetTargets()) == 0 {
+			c.log.Error().Str("port", portName).Str("route", r.Path).Msg("no targets found for route")
+			continue
+		}
+
+		routes = append(routes, r)
+	}
+	return routes
+}
@@ -27,6 +27,9 @@ const (
 	ActionStartProt
 	ActionStopPrort
 	ActionRestartPort
+	// ActionRetryProxy is pushed by the proxy manager to retry a proxy that
+	// failed to start.
+	ActionRetryProxy
 )
 
 type (
@@ -38,3 +41,21 @@ type (
 		Action         ActionType
 	}
 )
+
+var actionTypeStrings = []string{
+	"unknown",
+	"start_proxy",
+	"stop_proxy",
+	"restart_proxy",
+	"start_port",
+	"stop_port",
+	"restart_port",
+	"retry_proxy",
+}
+
+func (a ActionType) String() string {
+	if int(a) < 0 || int(a) >= len(actionTypeStrings) {
+		return actionTypeStrings[0]
+	}
+	return actionTypeStrings[a]
+}
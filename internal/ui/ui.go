@@ -16,8 +16,13 @@ import (
 //go:generate templ generate
 
 func RenderTempl(w http.ResponseWriter, r *http.Request, cmp templ.Component) error {
+	return RenderTemplStatus(w, r, http.StatusOK, cmp)
+}
+
+// RenderTemplStatus renders the component with the given http status code.
+func RenderTemplStatus(w http.ResponseWriter, r *http.Request, status int, cmp templ.Component) error {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	err := cmp.Render(r.Context(), w)
 	if err != nil {